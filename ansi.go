@@ -0,0 +1,159 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Log lines keep their SGR (color) sequences so panes can render them.
+// Everything that reads the text — search, filters, rules, selection and
+// copying — works on the line with the sequences stripped.
+
+// ansiEscapeRegexp matches CSI sequences, OSC sequences (titles,
+// hyperlinks) and the remaining two-byte escapes.
+var ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// dropNonSGR removes every escape sequence but SGR ones.
+func dropNonSGR(line string) string {
+	if !strings.Contains(line, "\x1b") {
+		return line
+	}
+	return ansiEscapeRegexp.ReplaceAllStringFunc(line, func(seq string) string {
+		if strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+			return seq
+		}
+		return ""
+	})
+}
+
+// stripANSI returns the text of a line without escape sequences.
+func stripANSI(line string) string {
+	if !strings.Contains(line, "\x1b") {
+		return line
+	}
+	return ansiEscapeRegexp.ReplaceAllString(line, "")
+}
+
+// styledRune is a rune of a line and the SGR parameters in effect for it
+// ("" for the default rendition).
+type styledRune struct {
+	r   rune
+	sgr string
+}
+
+// parseStyledLines splits a wrapped block into its visual lines of styled
+// runes. Colors carry over line breaks, as they do in a terminal.
+func parseStyledLines(block string) [][]styledRune {
+	var lines [][]styledRune
+	var line []styledRune
+	sgr := ""
+	for i := 0; i < len(block); {
+		if block[i] == '\x1b' {
+			if loc := ansiEscapeRegexp.FindStringIndex(block[i:]); loc != nil && loc[0] == 0 {
+				seq := block[i : i+loc[1]]
+				if strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+					sgr = applySGR(sgr, seq[2:len(seq)-1])
+				}
+				i += loc[1]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(block[i:])
+		i += size
+		if r == '\n' {
+			lines = append(lines, line)
+			line = nil
+			continue
+		}
+		line = append(line, styledRune{r: r, sgr: sgr})
+	}
+	return append(lines, line)
+}
+
+// applySGR updates the SGR parameters in effect with those of a sequence.
+// Later parameters override earlier ones, so they are simply appended; a
+// reset starts over.
+func applySGR(state, params string) string {
+	switch {
+	case params == "" || params == "0":
+		return ""
+	case strings.HasPrefix(params, "0;"):
+		return params[2:]
+	case state == "":
+		return params
+	}
+	return state + ";" + params
+}
+
+func styledPlain(line []styledRune) string {
+	var b strings.Builder
+	for _, c := range line {
+		b.WriteRune(c.r)
+	}
+	return b.String()
+}
+
+// renderStyledLine renders a visual line with its own colors (when colors
+// is set), the color of its level where it has none, the search matches
+// and the runes [selStart, selEnd) selected.
+func renderStyledLine(line []styledRune, needle *regexp.Regexp, level lineLevel, selStart, selEnd int, colors bool) string {
+	plain := styledPlain(line)
+
+	// Runes inside search matches.
+	highlighted := make([]bool, len(line))
+	if needle != nil && strings.TrimSpace(plain) != "" {
+		runeAt := make([]int, len(plain)+1)
+		n := 0
+		for i := range plain {
+			runeAt[i] = n
+			n++
+		}
+		runeAt[len(plain)] = n
+		for _, loc := range needle.FindAllStringIndex(plain, -1) {
+			// Empty matches (e.g. `x*`) have nothing to highlight.
+			for r := runeAt[loc[0]]; r < runeAt[loc[1]]; r++ {
+				highlighted[r] = true
+			}
+		}
+	}
+
+	type cellKind struct {
+		sgr     string
+		hl, sel bool
+	}
+	kindAt := func(i int) cellKind {
+		k := cellKind{hl: highlighted[i], sel: i >= selStart && i < selEnd}
+		if colors {
+			k.sgr = line[i].sgr
+		}
+		return k
+	}
+	levelStyle, hasLevel := level.style()
+
+	var b strings.Builder
+	for start := 0; start < len(line); {
+		kind := kindAt(start)
+		end := start + 1
+		for end < len(line) && kindAt(end) == kind {
+			end++
+		}
+		text := styledPlain(line[start:end])
+		switch {
+		case kind.sel && kind.hl:
+			b.WriteString(tailSelectionStyle.Render(searchHighlightStyle.Render(text)))
+		case kind.sel:
+			b.WriteString(tailSelectionStyle.Render(text))
+		case kind.hl:
+			b.WriteString(searchHighlightStyle.Render(text))
+		case kind.sgr != "":
+			b.WriteString("\x1b[" + kind.sgr + "m" + text + "\x1b[0m")
+		case hasLevel:
+			b.WriteString(levelStyle.Render(text))
+		default:
+			b.WriteString(text)
+		}
+		start = end
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCleanLogLineKeepsOnlyColors(t *testing.T) {
+	line := "\x1b]8;;https://example.com\x07link\x1b]8;;\x07 \x1b[2K\x1b[1;32mPASSED\x1b[0m \x1b[?25lok"
+	if got, want := cleanLogLine(line), "link \x1b[1;32mPASSED\x1b[0m ok"; got != want {
+		t.Fatalf("cleanLogLine = %q, want %q", got, want)
+	}
+	if got := stripANSI(cleanLogLine(line)); got != "link PASSED ok" {
+		t.Fatalf("stripANSI = %q", got)
+	}
+}
+
+func TestParseStyledLinesCarriesColorsAcrossWraps(t *testing.T) {
+	lines := parseStyledLines("\x1b[31mred\nstill red\x1b[0m plain")
+	if len(lines) != 2 || styledPlain(lines[1]) != "still red plain" {
+		t.Fatalf("unexpected lines %v", lines)
+	}
+	if lines[1][0].sgr != "31" || lines[1][len(lines[1])-1].sgr != "" {
+		t.Fatalf("expected the color to carry over the wrap and end at the reset")
+	}
+	if got := applySGR("1", "31"); got != "1;31" {
+		t.Fatalf("applySGR = %q", got)
+	}
+}
+
+func TestTailRendersLogColorsAndSearchesText(t *testing.T) {
+	m := NewTailModel("1", "", "", 80, 14, TailModeStdout)
+	m.appendLogLine("stdout", &m.stdoutLines, &m.wrappedStdout, m.stdoutBuilder, &m.stdoutView,
+		"test_a \x1b[32mPAS\x1b[1mSED\x1b[0m", "test_b \x1b[31mFAILED\x1b[0m")
+
+	if !strings.Contains(m.stdoutBuilder.String(), "\x1b[32mPAS\x1b[0m") {
+		t.Fatalf("expected the log's own colors in the pane: %q", m.stdoutBuilder.String())
+	}
+	// Matches span color changes; escapes never match.
+	re, _ := compileSearch("PASSED", searchOptions{})
+	if got := m.findMatches("stdout", 0, re); len(got) != 1 || got[0] != 0 {
+		t.Fatalf("matches = %v", got)
+	}
+	re, _ = compileSearch("32m", searchOptions{})
+	if got := m.findMatches("stdout", 0, re); len(got) != 0 {
+		t.Fatalf("expected escape sequences not to match, got %v", got)
+	}
+
+	m.selectionPane = "stdout"
+	m.selectionAnchor = selectionPoint{line: 0, col: 7}
+	m.selectionCursor = selectionPoint{line: 1, col: 13}
+	if got := m.selectedText(); got != "PASSED\ntest_b FAILED" {
+		t.Fatalf("selected text = %q", got)
+	}
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'C'}})
+	m = model.(TailModel)
+	if strings.Contains(m.stdoutBuilder.String(), "\x1b[32m") {
+		t.Fatalf("expected colors to be stripped after toggling")
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	archiveModeCopy     = "copy"
+	archiveModeHardlink = "hardlink"
+	archiveQueueSize    = 1024
+	archiveGzipSuffix   = ".gz"
+)
+
+// archiveNamePattern matches the files the archive convention owns
+// (<jobid>.out, <jobid>_<task>.err.gz, ...). Only these are ever pruned.
+var archiveNamePattern = regexp.MustCompile(`^[0-9]+(_[0-9]+)?\.(out|err)(\.gz|\.zst|\.bz2)?$`)
+
+// ArchiveConfig is the "archive" section of the config file. When enabled,
+// the logs of jobs seen reaching a terminal state are copied into the log
+// archive directory as <jobid>.out / <jobid>.err, so the archive convention
+// fallback works without pointing sbatch --output at it.
+type ArchiveConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Mode is "copy" (default) or "hardlink". Hardlinks cost no space but only
+	// work on the same filesystem; the archiver falls back to copying.
+	Mode     string `json:"mode"`
+	Compress bool   `json:"compress"` // gzip archived logs (implies copy)
+
+	// Logs larger than MaxFileMB keep only their last MaxFileMB MiB.
+	MaxFileMB int64 `json:"max_file_mb"`
+	// Oldest archived logs are pruned once the archive exceeds MaxTotalMB MiB
+	// or they are older than RetentionDays. Zero disables each limit.
+	MaxTotalMB    int64 `json:"max_total_mb"`
+	RetentionDays int   `json:"retention_days"`
+}
+
+func (c ArchiveConfig) validate() error {
+	switch c.Mode {
+	case "", archiveModeCopy, archiveModeHardlink:
+	default:
+		return fmt.Errorf("invalid mode %q (want %q or %q)", c.Mode, archiveModeCopy, archiveModeHardlink)
+	}
+	if c.MaxFileMB < 0 || c.MaxTotalMB < 0 || c.RetentionDays < 0 {
+		return errors.New("max_file_mb, max_total_mb and retention_days must not be negative")
+	}
+	return nil
+}
+
+// LogArchiver copies the logs of finished jobs into the archive directory in
+// the background.
+type LogArchiver struct {
+	cfg     ArchiveConfig
+	dir     string
+	resolve func(jobID string) (string, string, error)
+	errf    func(error)
+	now     func() time.Time
+
+	queue chan Job
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewLogArchiver starts the archive worker. errf receives failures; it may be
+// nil. Returns nil when archiving is disabled, and all methods are safe to
+// call on a nil archiver.
+func NewLogArchiver(cfg ArchiveConfig, errf func(error)) *LogArchiver {
+	if !cfg.Enabled {
+		return nil
+	}
+	dir := logArchiveDir()
+	if dir == "" {
+		return nil
+	}
+	if errf == nil {
+		errf = func(error) {}
+	}
+	a := newLogArchiver(cfg, dir, ResolveLogPaths, errf)
+	go a.run()
+	return a
+}
+
+func newLogArchiver(cfg ArchiveConfig, dir string, resolve func(string) (string, string, error), errf func(error)) *LogArchiver {
+	return &LogArchiver{
+		cfg:     cfg,
+		dir:     dir,
+		resolve: resolve,
+		errf:    errf,
+		now:     time.Now,
+		queue:   make(chan Job, archiveQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Archive queues the jobs of terminal transitions. It never blocks.
+func (a *LogArchiver) Archive(events []JobEvent) {
+	if a == nil {
+		return
+	}
+	for _, ev := range events {
+		if !ev.IsTerminal() {
+			continue
+		}
+		select {
+		case a.queue <- ev.Job:
+		default:
+			a.errf(fmt.Errorf("archive: queue full, skipped logs of job %s", ev.Job.JobID))
+		}
+	}
+}
+
+// Close archives the queued jobs and waits for the worker to finish.
+func (a *LogArchiver) Close() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() { close(a.queue) })
+	<-a.done
+}
+
+func (a *LogArchiver) run() {
+	defer close(a.done)
+	if err := a.prune(); err != nil {
+		a.errf(fmt.Errorf("archive: pruning %s: %w", a.dir, err))
+	}
+	for job := range a.queue {
+		if err := a.archiveJob(job); err != nil {
+			a.errf(fmt.Errorf("archive: job %s: %w", job.JobID, err))
+		}
+		// Prune once the burst of finished jobs has been archived.
+		if len(a.queue) > 0 {
+			continue
+		}
+		if err := a.prune(); err != nil {
+			a.errf(fmt.Errorf("archive: pruning %s: %w", a.dir, err))
+		}
+	}
+}
+
+// archiveJob archives stdout and stderr of a job. A merged log is archived
+// once as <jobid>.out; the convention lookup falls back to it for stderr.
+func (a *LogArchiver) archiveJob(job Job) error {
+	stdoutPath, stderrPath, err := a.resolve(job.JobID)
+	if err != nil {
+		return err
+	}
+	if err := a.archiveFile(stdoutPath, job.JobID+".out"); err != nil {
+		return err
+	}
+	if stderrPath == stdoutPath {
+		return nil
+	}
+	return a.archiveFile(stderrPath, job.JobID+".err")
+}
+
+func (a *LogArchiver) archiveFile(src, name string) error {
+	if src == "" || a.insideArchive(src) {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// The job never wrote this stream.
+			return nil
+		}
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	dst := filepath.Join(a.dir, name)
+	if a.cfg.Compress {
+		dst += archiveGzipSuffix
+	}
+	if fileExists(dst) {
+		// Already archived, e.g. by another dashboard or a watch process.
+		return nil
+	}
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return err
+	}
+
+	maxBytes := a.cfg.MaxFileMB << 20
+	fits := maxBytes == 0 || info.Size() <= maxBytes
+	if a.cfg.Mode == archiveModeHardlink && !a.cfg.Compress && fits {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+		// Different filesystem or no permission to link: copy instead.
+	}
+	return copyLogFile(src, dst, info, maxBytes, a.cfg.Compress)
+}
+
+// insideArchive reports whether a log already lives in the archive directory
+// (sbatch --output pointed there), in which case there is nothing to do.
+func (a *LogArchiver) insideArchive(path string) bool {
+	rel, err := filepath.Rel(a.dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyLogFile writes src to dst through a temporary file, so readers never see
+// a partial archive. Logs over maxBytes (when non-zero) keep only their tail,
+// starting at a line boundary, behind a marker line. The source mode and
+// modification time are preserved; the latter drives retention.
+func copyLogFile(src, dst string, info os.FileInfo, maxBytes int64, compress bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(tmp)
+		w = zw
+	}
+
+	var r io.Reader = in
+	if maxBytes > 0 && info.Size() > maxBytes {
+		if _, err := in.Seek(info.Size()-maxBytes, io.SeekStart); err != nil {
+			return err
+		}
+		br := bufio.NewReader(in)
+		if _, err := br.ReadString('\n'); err != nil && err != io.EOF {
+			return err
+		}
+		fmt.Fprintf(w, "[slurm-dashboard: archive truncated to the last %d MiB of %s (%d bytes)]\n", maxBytes>>20, src, info.Size())
+		r = br
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// prune applies the retention policy to the archive directory: logs older
+// than RetentionDays go first, then the oldest logs until the archive fits
+// in MaxTotalMB.
+func (a *LogArchiver) prune() error {
+	if a.cfg.RetentionDays == 0 && a.cfg.MaxTotalMB == 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(a.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type archived struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []archived
+	var total int64
+	cutoff := a.now().AddDate(0, 0, -a.cfg.RetentionDays)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !archiveNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(a.dir, entry.Name())
+		if a.cfg.RetentionDays > 0 && info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		files = append(files, archived{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	limit := a.cfg.MaxTotalMB << 20
+	if limit == 0 || total <= limit {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testArchiver(t *testing.T, cfg ArchiveConfig, logs map[string][2]string) (*LogArchiver, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "archive")
+	resolve := func(id string) (string, string, error) {
+		paths := logs[id]
+		return paths[0], paths[1], nil
+	}
+	return newLogArchiver(cfg, dir, resolve, func(err error) { t.Errorf("archive error: %v", err) }), dir
+}
+
+func writeLog(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+}
+
+func TestLogArchiverCopiesCompressesAndTruncates(t *testing.T) {
+	src := t.TempDir()
+	out := filepath.Join(src, "train-42.out")
+	errPath := filepath.Join(src, "train-42.err")
+	big := strings.Repeat("x", 1<<20) + "\n" + "last line\n"
+	writeLog(t, out, big, time.Time{})
+	writeLog(t, errPath, "Traceback\n", time.Time{})
+
+	a, dir := testArchiver(t, ArchiveConfig{Enabled: true, Compress: true, MaxFileMB: 1}, map[string][2]string{"42": {out, errPath}})
+	if err := a.archiveJob(Job{JobID: "42"}); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	lines, err := readLogTail(filepath.Join(dir, "42.out.gz"), 0)
+	if err != nil {
+		t.Fatalf("read archived stdout: %v", err)
+	}
+	if len(lines) != 2 || !strings.Contains(lines[0], "truncated") || lines[1] != "last line" {
+		t.Fatalf("expected truncation marker and the log tail, got %d lines starting %.80q", len(lines), lines)
+	}
+	if lines, _ := readLogTail(filepath.Join(dir, "42.err.gz"), 0); len(lines) != 1 || lines[0] != "Traceback" {
+		t.Fatalf("unexpected archived stderr %q", lines)
+	}
+
+	stdoutPath, stderrPath, ok := withArchiveDir(t, dir, "42")
+	if !ok || !strings.HasSuffix(stdoutPath, "42.out.gz") || !strings.HasSuffix(stderrPath, "42.err.gz") {
+		t.Fatalf("archive convention did not find compressed logs: %q %q", stdoutPath, stderrPath)
+	}
+}
+
+func withArchiveDir(t *testing.T, dir, jobID string) (string, string, bool) {
+	t.Helper()
+	t.Setenv("SLURM_DASHBOARD_LOG_ARCHIVE_DIR", dir)
+	return resolveArchiveConventionPaths(jobID)
+}
+
+func TestLogArchiverHardlinksMergedLogOnceAndSkipsArchivedSources(t *testing.T) {
+	src := t.TempDir()
+	merged := filepath.Join(src, "slurm-7.out")
+	writeLog(t, merged, "hello\n", time.Time{})
+
+	a, dir := testArchiver(t, ArchiveConfig{Enabled: true, Mode: archiveModeHardlink}, map[string][2]string{
+		"7": {merged, merged},
+		"8": {"", ""},
+	})
+	if err := a.archiveJob(Job{JobID: "7"}); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	srcInfo, _ := os.Stat(merged)
+	dstInfo, err := os.Stat(filepath.Join(dir, "7.out"))
+	if err != nil || !os.SameFile(srcInfo, dstInfo) {
+		t.Fatalf("expected 7.out to be a hardlink of the source log (err=%v)", err)
+	}
+	if fileExists(filepath.Join(dir, "7.err")) {
+		t.Fatalf("merged log must only be archived once")
+	}
+
+	// A log written straight into the archive is left alone.
+	inArchive := filepath.Join(dir, "8.out")
+	writeLog(t, inArchive, "direct\n", time.Time{})
+	a.resolve = func(string) (string, string, error) { return inArchive, "", nil }
+	if err := a.archiveJob(Job{JobID: "8"}); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if data, _ := os.ReadFile(inArchive); string(data) != "direct\n" {
+		t.Fatalf("log inside the archive was modified: %q", data)
+	}
+}
+
+func TestLogArchiverPrunesByRetentionAndTotalSize(t *testing.T) {
+	a, dir := testArchiver(t, ArchiveConfig{Enabled: true, RetentionDays: 30, MaxTotalMB: 1}, nil)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	half := strings.Repeat("x", 600<<10)
+	writeLog(t, filepath.Join(dir, "1.out"), "expired\n", now.AddDate(0, 0, -40))
+	writeLog(t, filepath.Join(dir, "2.out.gz"), half, now.Add(-2*time.Hour))
+	writeLog(t, filepath.Join(dir, "3_1.err"), half, now.Add(-time.Hour))
+	writeLog(t, filepath.Join(dir, "notes.txt"), "mine\n", now.AddDate(0, 0, -40))
+
+	if err := a.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	for name, want := range map[string]bool{"1.out": false, "2.out.gz": false, "3_1.err": true, "notes.txt": true} {
+		if got := fileExists(filepath.Join(dir, name)); got != want {
+			t.Errorf("%s exists=%v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseConfigValidatesArchive(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"archive": {"enabled": true, "mode": "move"}}`), "config.json"); err == nil {
+		t.Fatalf("expected invalid archive mode to be rejected")
+	}
+	cfg, err := parseConfig([]byte(`{"archive": {"enabled": true, "compress": true, "retention_days": 90}}`), "config.json")
+	if err != nil || !cfg.Archive.Enabled || cfg.Archive.RetentionDays != 90 {
+		t.Fatalf("unexpected archive config %+v (err=%v)", cfg.Archive, err)
+	}
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Bookmarks mark log lines to come back to, optionally with a note. They are
+// kept per job and log in ~/.slurm-dashboard/bookmarks/<job>.json, so they
+// survive closing the log view and the dashboard.
+
+// bookmarkGutterWidth is the column left of each pane marking bookmarked
+// lines.
+const bookmarkGutterWidth = 1
+
+var (
+	bookmarkStyle    = lipgloss.NewStyle().Foreground(accentBlue).Bold(true)
+	bookmarkMark     = bookmarkStyle.Render("●")
+	bookmarkNoteMark = bookmarkStyle.Render("✎")
+)
+
+// bookmark marks a line of a log by its line number; Text tells when the log
+// was replaced since.
+type bookmark struct {
+	Line int    `json:"line,omitempty"`
+	Text string `json:"text"`
+	Note string `json:"note,omitempty"`
+}
+
+// matches reports whether the bookmark is on a line; line is its number, or
+// 0 when not known. Logs repeat lines, so the text alone never matches.
+func (b bookmark) matches(text string, line int) bool {
+	return line > 0 && b.Line == line && b.Text == text
+}
+
+// jobBookmarks are the bookmarks of a job by log path, in line order.
+type jobBookmarks map[string][]bookmark
+
+// bookmarkStore holds the bookmarks of the jobs viewed. It is shared by the
+// copies of a log view.
+type bookmarkStore struct {
+	jobs map[string]jobBookmarks
+}
+
+func newBookmarkStore() *bookmarkStore {
+	return &bookmarkStore{jobs: map[string]jobBookmarks{}}
+}
+
+// bookmarksPath returns the file holding a job's bookmarks.
+func bookmarksPath(job string) string {
+	dir := dashboardDir()
+	if dir == "" {
+		return ""
+	}
+	name := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(job)
+	return filepath.Join(dir, "bookmarks", name+".json")
+}
+
+// job returns the bookmarks of a job, reading them on first use. A missing
+// or unreadable file holds none.
+func (s *bookmarkStore) job(id string) jobBookmarks {
+	if marks, ok := s.jobs[id]; ok {
+		return marks
+	}
+	marks := jobBookmarks{}
+	if path := bookmarksPath(id); path != "" {
+		if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &marks) != nil {
+			marks = jobBookmarks{}
+		}
+	}
+	s.jobs[id] = marks
+	return marks
+}
+
+// find returns the index of the bookmark on the line b marks, or -1.
+func (s *bookmarkStore) find(id, path string, b bookmark) int {
+	return slices.IndexFunc(s.job(id)[path], func(o bookmark) bool {
+		return o.matches(b.Text, b.Line)
+	})
+}
+
+// add inserts a bookmark in line order; lines without a number go last.
+func (s *bookmarkStore) add(id, path string, b bookmark) {
+	marks := s.job(id)
+	list := marks[path]
+	i := slices.IndexFunc(list, func(o bookmark) bool {
+		return b.Line > 0 && (o.Line == 0 || o.Line > b.Line)
+	})
+	if i < 0 {
+		i = len(list)
+	}
+	marks[path] = slices.Insert(list, i, b)
+}
+
+// remove deletes the i-th bookmark of a log.
+func (s *bookmarkStore) remove(id, path string, i int) {
+	marks := s.job(id)
+	marks[path] = slices.Delete(marks[path], i, i+1)
+	if len(marks[path]) == 0 {
+		delete(marks, path)
+	}
+}
+
+// save writes a job's bookmarks, replacing the file atomically. The file is
+// removed once the job has no bookmarks left.
+func (s *bookmarkStore) save(id string) error {
+	path := bookmarksPath(id)
+	if path == "" {
+		return errors.New("no home directory")
+	}
+	marks := s.job(id)
+	if len(marks) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".bookmarks-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveBookmarks saves a job's bookmarks and reports the outcome in the pane
+// header.
+func (m *TailModel) saveBookmarks(id, done string) {
+	if err := m.bookmarks.save(id); err != nil {
+		m.notice = fmt.Sprintf("bookmarks not saved: %v", err)
+		return
+	}
+	m.notice = done
+}
+
+// paneBookmarks returns the bookmarks of the log a pane shows. The merged
+// pane shows two logs and has none.
+func (m *TailModel) paneBookmarks(pane string) []bookmark {
+	path := m.panePath(pane)
+	if pane == "merged" || path == "" || m.bookmarks == nil {
+		return nil
+	}
+	return m.bookmarks.job(m.paneJobID(pane))[path]
+}
+
+// lineNumber returns the line number in its log of a pane's line, or 0 when
+// it is not known.
+func (m *TailModel) lineNumber(pane string, raw int) int {
+	if sb := m.paneRefs(pane).scrollback; sb != nil && sb.numbered {
+		return max(sb.firstLine+raw+1, 0)
+	}
+	return 0
+}
+
+// numberBookmarkedLines makes the line numbers of a pane known when its log
+// has bookmarks, so they can be shown.
+func (m *TailModel) numberBookmarkedLines(pane string) {
+	if len(m.paneBookmarks(pane)) > 0 {
+		m.numberLines(pane)
+	}
+}
+
+// bookmarkAt returns the index of the bookmark on a line of a pane, or -1.
+func (m *TailModel) bookmarkAt(pane string, raw int) int {
+	lines := *m.paneRefs(pane).lines
+	if raw < 0 || raw >= len(lines) {
+		return -1
+	}
+	text, n := stripANSI(lines[raw]), m.lineNumber(pane, raw)
+	return slices.IndexFunc(m.paneBookmarks(pane), func(b bookmark) bool {
+		return b.matches(text, n)
+	})
+}
+
+// bookmarkTarget returns a bookmark for the line at the top of the focused
+// pane.
+func (m *TailModel) bookmarkTarget() (string, bookmark, bool) {
+	pane := m.focusedPane()
+	if pane == "merged" || m.panePath(pane) == "" {
+		m.notice = "bookmarks are kept per log: show stdout or stderr"
+		return pane, bookmark{}, false
+	}
+	refs := m.paneRefs(pane)
+	raw := m.rawIndex(pane, lineAtOffset(*refs.wrapped, refs.view.YOffset))
+	if !m.numberLines(pane) {
+		m.notice = "the line numbers of this log are not known"
+		return pane, bookmark{}, false
+	}
+	if raw < 0 || raw >= len(*refs.lines) || m.lineNumber(pane, raw) == 0 {
+		m.notice = "no log line at the top of the pane"
+		return pane, bookmark{}, false
+	}
+	return pane, bookmark{Line: m.lineNumber(pane, raw), Text: stripANSI((*refs.lines)[raw])}, true
+}
+
+// toggleBookmark bookmarks the line at the top of the focused pane, or
+// removes its bookmark.
+func (m *TailModel) toggleBookmark() {
+	pane, b, ok := m.bookmarkTarget()
+	if !ok {
+		return
+	}
+	id, path := m.paneJobID(pane), m.panePath(pane)
+	if i := m.bookmarks.find(id, path, b); i >= 0 {
+		m.bookmarks.remove(id, path, i)
+		m.saveBookmarks(id, "bookmark removed")
+		return
+	}
+	m.bookmarks.add(id, path, b)
+	m.saveBookmarks(id, "bookmarked")
+}
+
+// showBookmark shows a bookmarked line of a pane at its top, with its note
+// in the pane header.
+func (m *TailModel) showBookmark(pane string, shown int) {
+	refs := m.paneRefs(pane)
+	m.following = false
+	refs.view.SetYOffset(lineOffset(*refs.wrapped, shown))
+	if i := m.bookmarkAt(pane, m.rawIndex(pane, shown)); i >= 0 {
+		m.notice = m.paneBookmarks(pane)[i].Note
+	}
+}
+
+// jumpToBookmark shows the next or previous bookmarked line of the focused
+// pane, continuing through the log on disk beyond the window.
+func (m *TailModel) jumpToBookmark(forward bool) tea.Cmd {
+	pane := m.focusedPane()
+	marks := m.paneBookmarks(pane)
+	if len(marks) == 0 {
+		m.notice = "no bookmarks in this log"
+		return nil
+	}
+	m.numberLines(pane)
+	refs := m.paneRefs(pane)
+	shown := m.displayLines(pane)
+	if len(shown) == 0 || len(*refs.wrapped) != len(shown) {
+		return nil
+	}
+	marked := func(i int) bool { return m.bookmarkAt(pane, m.rawIndex(pane, i)) >= 0 }
+	current := lineAtOffset(*refs.wrapped, refs.view.YOffset)
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for i := current + step; i >= 0 && i < len(shown); i += step {
+		if marked(i) {
+			m.showBookmark(pane, i)
+			return nil
+		}
+	}
+	if sb := refs.scrollback; sb != nil && !sb.wholeLogLoaded() && len(shown) > 0 {
+		if line := nextBookmarkLine(marks, m.lineNumber(pane, m.rawIndex(pane, current)), forward); line > 0 {
+			return m.lineCmd(pane, line)
+		}
+	}
+	for n := 1; n <= len(shown); n++ {
+		if i := ((current+step*n)%len(shown) + len(shown)) % len(shown); marked(i) {
+			m.showBookmark(pane, i)
+			return nil
+		}
+	}
+	return nil
+}
+
+// nextBookmarkLine returns the line of the bookmark after (or before) a line,
+// wrapping around; marks are in line order. It is 0 without numbered marks.
+func nextBookmarkLine(marks []bookmark, line int, forward bool) int {
+	var lines []int
+	for _, b := range marks {
+		if b.Line > 0 {
+			lines = append(lines, b.Line)
+		}
+	}
+	if len(lines) == 0 {
+		return 0
+	}
+	if forward {
+		for _, l := range lines {
+			if l > line {
+				return l
+			}
+		}
+		return lines[0]
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] < line {
+			return lines[i]
+		}
+	}
+	return lines[len(lines)-1]
+}
+
+// annotatePrompt is the note prompt of a bookmark.
+type annotatePrompt struct {
+	input textinput.Model
+	pane  string
+	mark  bookmark
+}
+
+// openAnnotate opens the note prompt for the line at the top of the focused
+// pane.
+func (m *TailModel) openAnnotate() tea.Cmd {
+	pane, b, ok := m.bookmarkTarget()
+	if !ok {
+		return nil
+	}
+	ti := textinput.New()
+	ti.CharLimit = 500
+	ti.Width = m.searchInput.Width
+	ti.Prompt = ""
+	ti.Placeholder = "note"
+	ti.TextStyle = lipgloss.NewStyle().Foreground(textStrong)
+	ti.PlaceholderStyle = lipgloss.NewStyle().Foreground(subtle)
+	ti.Cursor.Style = lipgloss.NewStyle().Foreground(highlight)
+	id, path := m.paneJobID(pane), m.panePath(pane)
+	if i := m.bookmarks.find(id, path, b); i >= 0 {
+		b = m.bookmarks.job(id)[path][i]
+		ti.SetValue(b.Note)
+		ti.CursorEnd()
+	}
+	m.annotate = &annotatePrompt{input: ti, pane: pane, mark: b}
+	m.recalculateLayout()
+	return m.annotate.input.Focus()
+}
+
+// saveAnnotation sets the note of the prompt's bookmark, bookmarking the
+// line first if needed.
+func (m *TailModel) saveAnnotation() {
+	a := m.annotate
+	id, path := m.paneJobID(a.pane), m.panePath(a.pane)
+	note := strings.TrimSpace(a.input.Value())
+	if i := m.bookmarks.find(id, path, a.mark); i >= 0 {
+		m.bookmarks.job(id)[path][i].Note = note
+	} else {
+		a.mark.Note = note
+		m.bookmarks.add(id, path, a.mark)
+	}
+	m.saveBookmarks(id, "note saved")
+}
+
+func (m *TailModel) closeAnnotate() {
+	m.annotate = nil
+	m.recalculateLayout()
+}
+
+// updateAnnotate handles the keys of the note prompt.
+func (m TailModel) updateAnnotate(msg tea.KeyMsg) (TailModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, dialogKeys.Confirm):
+		m.saveAnnotation()
+		m.closeAnnotate()
+		return m, nil
+	case key.Matches(msg, dialogKeys.Back):
+		m.closeAnnotate()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.annotate.input, cmd = m.annotate.input.Update(msg)
+	return m, cmd
+}
+
+func (m TailModel) renderAnnotateOverlay(content string) string {
+	where := "this line"
+	if m.annotate.mark.Line > 0 {
+		where = fmt.Sprintf("line %d", m.annotate.mark.Line)
+	}
+	line := m.annotate.mark.Text
+	if avail := m.width - 30; runeLen(line) > avail {
+		line = runeSlice(line, 0, max(avail-1, 0)) + "…"
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\n%s Note on %s: ", tailKeys.Annotate.Help().Key, where))
+	b.WriteString(m.annotate.input.View())
+	b.WriteString("\n" + hints(", ", hint("save", dialogKeys.Confirm), hint("cancel", dialogKeys.Back)) + " · ")
+	b.WriteString(line)
+	b.WriteString("\n\n")
+	b.WriteString(content)
+	return b.String()
+}
+
+// bookmarkEntry is a row of the bookmark list.
+type bookmarkEntry struct {
+	pane string // pane showing the log, "" when the view does not show it
+	path string
+	mark bookmark
+}
+
+// bookmarkList is the list of a job's bookmarks.
+type bookmarkList struct {
+	job     string
+	entries []bookmarkEntry
+	cursor  int
+}
+
+// bookmarkEntries lists the bookmarks of a job, by log and line.
+func (m *TailModel) bookmarkEntries(job string) []bookmarkEntry {
+	marks := m.bookmarks.job(job)
+	paths := make([]string, 0, len(marks))
+	for path := range marks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var entries []bookmarkEntry
+	for _, path := range paths {
+		pane := ""
+		for _, p := range []string{"stdout", "stderr"} {
+			if m.panePath(p) == path && m.paneJobID(p) == job {
+				pane = p
+				break
+			}
+		}
+		for _, b := range marks[path] {
+			entries = append(entries, bookmarkEntry{pane: pane, path: path, mark: b})
+		}
+	}
+	return entries
+}
+
+// openBookmarkList lists the bookmarks of the focused pane's job.
+func (m *TailModel) openBookmarkList() {
+	job := m.paneJobID(m.focusedPane())
+	m.bookmarkList = &bookmarkList{job: job, entries: m.bookmarkEntries(job)}
+}
+
+// openBookmark shows the pane of the selected bookmark and its line.
+func (m *TailModel) openBookmark() tea.Cmd {
+	l := m.bookmarkList
+	if l.cursor < 0 || l.cursor >= len(l.entries) {
+		return nil
+	}
+	e := l.entries[l.cursor]
+	if e.pane == "" {
+		m.notice = filepath.Base(e.path) + " is not shown here"
+		return nil
+	}
+	switch {
+	case m.mode == TailModeBoth:
+		m.activePane = 0
+		if e.pane == "stderr" {
+			m.activePane = 1
+		}
+	case e.pane == "stdout" && m.mode != TailModeStdout:
+		m.mode = TailModeStdout
+		m.recalculateLayout()
+	case e.pane == "stderr" && m.mode != TailModeStderr:
+		m.mode = TailModeStderr
+		m.recalculateLayout()
+	}
+
+	refs := m.paneRefs(e.pane)
+	m.numberLines(e.pane)
+	for i := range m.displayLines(e.pane) {
+		raw := m.rawIndex(e.pane, i)
+		if raw >= 0 && e.mark.matches(stripANSI((*refs.lines)[raw]), m.lineNumber(e.pane, raw)) {
+			m.showBookmark(e.pane, i)
+			return nil
+		}
+	}
+	if sb := refs.scrollback; sb != nil && !sb.wholeLogLoaded() && e.mark.Line > 0 {
+		return m.lineCmd(e.pane, e.mark.Line)
+	}
+	m.notice = "bookmarked line not found"
+	return nil
+}
+
+// updateBookmarkList handles the keys of the bookmark list.
+func (m TailModel) updateBookmarkList(msg tea.KeyMsg) (TailModel, tea.Cmd) {
+	l := m.bookmarkList
+	page := m.height - 4
+	switch {
+	case key.Matches(msg, scrollKeys.Up):
+		l.cursor--
+	case key.Matches(msg, scrollKeys.Down):
+		l.cursor++
+	case key.Matches(msg, scrollKeys.PageUp):
+		l.cursor -= page
+	case key.Matches(msg, scrollKeys.PageDown):
+		l.cursor += page
+	case key.Matches(msg, dialogKeys.Home):
+		l.cursor = 0
+	case key.Matches(msg, dialogKeys.End):
+		l.cursor = len(l.entries) - 1
+	case key.Matches(msg, dialogKeys.Confirm):
+		cmd := m.openBookmark()
+		m.bookmarkList = nil
+		return m, cmd
+	case key.Matches(msg, dialogKeys.Delete):
+		if l.cursor >= 0 && l.cursor < len(l.entries) {
+			e := l.entries[l.cursor]
+			if i := m.bookmarks.find(l.job, e.path, e.mark); i >= 0 {
+				m.bookmarks.remove(l.job, e.path, i)
+				m.saveBookmarks(l.job, "bookmark removed")
+			}
+			l.entries = m.bookmarkEntries(l.job)
+		}
+	case key.Matches(msg, dialogKeys.Back, dialogKeys.Close, tailKeys.Bookmarks):
+		m.bookmarkList = nil
+		return m, nil
+	}
+	l.cursor = max(min(l.cursor, len(l.entries)-1), 0)
+	return m, nil
+}
+
+// renderBookmarkList draws the bookmark list over the whole view.
+func (m TailModel) renderBookmarkList() string {
+	l := m.bookmarkList
+	height := max(m.height-4, 3)
+	first := max(min(l.cursor-height/2, len(l.entries)-height), 0)
+	width := max(m.width-2, 20)
+
+	var b strings.Builder
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("Bookmarks of job %s: %d", l.job, len(l.entries))))
+	b.WriteString("\n\n")
+	if len(l.entries) == 0 {
+		b.WriteString("No bookmarks yet: " + hints(", ",
+			hint("bookmarks the line at the top of the pane", tailKeys.Bookmark),
+			hint("adds a note", tailKeys.Annotate)) + ".\n")
+	}
+	for i := first; i < len(l.entries) && i < first+height; i++ {
+		e := l.entries[i]
+		line := "-"
+		if e.mark.Line > 0 {
+			line = fmt.Sprint(e.mark.Line)
+		}
+		label := fmt.Sprintf("%-16s %7s  ", shortenText(filepath.Base(e.path), 16), line)
+		text := e.mark.Text
+		if e.mark.Note != "" {
+			text = e.mark.Note + " · " + text
+		}
+		if avail := width - runeLen(label); runeLen(text) > avail {
+			text = runeSlice(text, 0, max(avail-1, 0)) + "…"
+		}
+		if i == l.cursor {
+			b.WriteString(tailSelectionStyle.Render(label + text))
+		} else {
+			b.WriteString(label + text)
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("\n" + hints("  ",
+		hint("select", scrollKeys.Up, scrollKeys.Down),
+		hint("jump", dialogKeys.Confirm),
+		hint("delete", dialogKeys.Delete),
+		hint("close", dialogKeys.Back)))
+	return b.String()
+}
+
+// renderBookmarkGutter draws the gutter of a pane: a mark beside the first
+// row of each bookmarked line in view.
+func (m TailModel) renderBookmarkGutter(pane string) string {
+	refs := m.paneRefs(pane)
+	wrapped, vp := *refs.wrapped, refs.view
+	if vp.Height <= 0 {
+		return ""
+	}
+	rows := make([]string, vp.Height)
+	for r := range rows {
+		rows[r] = " "
+	}
+	if marks := m.paneBookmarks(pane); len(marks) > 0 {
+		line := lineAtOffset(wrapped, vp.YOffset)
+		row := lineOffset(wrapped, line) - vp.YOffset
+		for ; line < len(wrapped) && row < vp.Height; line++ {
+			if i := m.bookmarkAt(pane, m.rawIndex(pane, line)); i >= 0 && row >= 0 {
+				rows[row] = bookmarkMark
+				if marks[i].Note != "" {
+					rows[row] = bookmarkNoteMark
+				}
+			}
+			row += visualLineCount(wrapped[line])
+		}
+	}
+	return strings.Join(rows, "\n")
+}
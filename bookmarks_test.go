@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestBookmarksPersistAcrossLogViews(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var lines []string
+	for i := 1; i <= 60; i++ {
+		lines = append(lines, fmt.Sprintf("step %02d", i))
+	}
+	open := func() TailModel {
+		m := NewTailModel("42", "/logs/train.out", "/logs/train.err", 100, 20, TailModeStdout)
+		model, _ := m.Update(tailStartMsg{pane: "stdout", initialLines: lines, scrollback: &paneScrollback{atStart: true, numbered: true}})
+		return model.(TailModel)
+	}
+	m := open()
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	press := func(keys string) {
+		for _, r := range keys {
+			update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	m.stdoutView.SetYOffset(10)
+	press("B")
+	if m.notice != "bookmarked" {
+		t.Fatalf("expected the top line to be bookmarked, got %q", m.notice)
+	}
+	m.stdoutView.SetYOffset(30)
+	press("A")
+	if !m.InOverlay() || !strings.Contains(m.View(), "Note on line 31") {
+		t.Fatalf("expected the note prompt")
+	}
+	press("loss spike")
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	data, err := os.ReadFile(bookmarksPath("42"))
+	if err != nil || !strings.Contains(string(data), `"line": 11`) || !strings.Contains(string(data), `"note": "loss spike"`) {
+		t.Fatalf("expected both bookmarks on disk, got %s (%v)", data, err)
+	}
+
+	// Re-opening the log finds them again.
+	m = open()
+	m.stdoutView.SetYOffset(0)
+	press("}")
+	if m.stdoutView.YOffset != 10 || !strings.Contains(stripANSI(m.View()), "●step 11") {
+		t.Fatalf("expected a jump to the first bookmark, at %d:\n%s", m.stdoutView.YOffset, stripANSI(m.View()))
+	}
+	press("}")
+	if view := stripANSI(m.View()); m.stdoutView.YOffset != 30 || !strings.Contains(view, "✎step 31") || !strings.Contains(view, "[loss spike]") {
+		t.Fatalf("expected the annotated bookmark with its note:\n%s", view)
+	}
+	press("{")
+	if m.stdoutView.YOffset != 10 {
+		t.Fatalf("expected a jump back, at %d", m.stdoutView.YOffset)
+	}
+
+	press("'")
+	if view := m.View(); !strings.Contains(view, "Bookmarks of job 42: 2") || !strings.Contains(view, "loss spike · step 31") {
+		t.Fatalf("expected the bookmark list:\n%s", view)
+	}
+	press("jd")
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.InOverlay() || m.stdoutView.YOffset != 10 {
+		t.Fatalf("expected Enter to jump to the remaining bookmark")
+	}
+	if data, _ := os.ReadFile(bookmarksPath("42")); strings.Contains(string(data), "loss spike") {
+		t.Fatalf("expected the deleted bookmark to be gone from disk, got %s", data)
+	}
+	press("B")
+	if _, err := os.Stat(bookmarksPath("42")); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be removed with the last bookmark")
+	}
+}
+
+func TestBookmarksTellRepeatedLinesApart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "train.out")
+	var data string
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		line := fmt.Sprintf("epoch %d", i)
+		if i%2 == 0 {
+			line = "Epoch done"
+		}
+		data += line + "\n"
+		lines = append(lines, line)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The window holds lines 4 to 10, without their line numbers.
+	start := logPos{offset: int64(len("epoch 1\nEpoch done\nepoch 3\n"))}
+	m := NewTailModel("42", path, "", 100, 20, TailModeStdout)
+	model, _ := m.Update(tailStartMsg{pane: "stdout", initialLines: lines[3:], scrollback: &paneScrollback{source: newLogSource(path), path: path, start: start}})
+	m = model.(TailModel)
+
+	m.stdoutView.SetYOffset(0)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'B'}})
+	m = model.(TailModel)
+	if marks := m.paneBookmarks("stdout"); len(marks) != 1 || marks[0].Line != 4 {
+		t.Fatalf("expected a bookmark on line 4, got %+v", marks)
+	}
+	if view := stripANSI(m.View()); strings.Count(view, "●Epoch done") != 1 {
+		t.Fatalf("expected only the bookmarked line to be marked:\n%s", view)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+)
+
+// Besides its logs, a job leaves checkpoints, configs and other output in
+// its working directory. The file browser lists that directory, newest
+// first, previews the selected file and opens files in the log view.
+
+// browserPreviewBytes is how much of a file the preview reads.
+const browserPreviewBytes = 32 * 1024
+
+// browserEntry is a file or directory listed by the file browser.
+type browserEntry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// fileBrowser browses the working directory of a job. It never leaves the
+// directory it is rooted at.
+type fileBrowser struct {
+	jobID      string
+	root, dir  string
+	entries    []browserEntry
+	cursor     int
+	showHidden bool
+	err        error
+
+	// The first lines of the selected file, or why there are none.
+	preview     []string
+	previewNote string
+}
+
+// workDirMsg carries the working directory of a job, for the file browser.
+type workDirMsg struct {
+	jobID string
+	dir   string
+	err   error
+}
+
+func newFileBrowser(jobID, root string) *fileBrowser {
+	root = filepath.Clean(root)
+	b := &fileBrowser{jobID: jobID, root: root, dir: root}
+	b.load()
+	return b
+}
+
+// load lists the current directory, newest first, below ".." when the
+// directory is below the root.
+func (b *fileBrowser) load() {
+	b.entries, b.err = nil, nil
+	if b.dir != b.root {
+		b.entries = append(b.entries, browserEntry{name: "..", dir: true})
+	}
+	dirEntries, err := os.ReadDir(b.dir)
+	if err != nil {
+		b.err = err
+	}
+	var listed []browserEntry
+	for _, de := range dirEntries {
+		if !b.showHidden && strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		e := browserEntry{name: de.Name(), dir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Checkpoint directories are often symlinked.
+			if target, err := os.Stat(filepath.Join(b.dir, de.Name())); err == nil {
+				e.dir, e.size = target.IsDir(), target.Size()
+			}
+		}
+		listed = append(listed, e)
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		if !listed[i].modTime.Equal(listed[j].modTime) {
+			return listed[i].modTime.After(listed[j].modTime)
+		}
+		return listed[i].name < listed[j].name
+	})
+	b.entries = append(b.entries, listed...)
+	b.cursor = max(min(b.cursor, len(b.entries)-1), 0)
+	b.loadPreview()
+}
+
+func (b *fileBrowser) selected() (browserEntry, bool) {
+	if b.cursor < 0 || b.cursor >= len(b.entries) {
+		return browserEntry{}, false
+	}
+	return b.entries[b.cursor], true
+}
+
+func (b *fileBrowser) move(delta int) {
+	b.cursor = max(min(b.cursor+delta, len(b.entries)-1), 0)
+	b.loadPreview()
+}
+
+// open enters the selected directory, or returns the selected file.
+func (b *fileBrowser) open() (string, bool) {
+	e, ok := b.selected()
+	switch {
+	case !ok:
+		return "", false
+	case e.name == "..":
+		b.up()
+		return "", false
+	case e.dir:
+		b.dir, b.cursor = filepath.Join(b.dir, e.name), 0
+		b.load()
+		return "", false
+	}
+	return filepath.Join(b.dir, e.name), true
+}
+
+// up goes to the parent directory, selecting the directory left.
+func (b *fileBrowser) up() {
+	if b.dir == b.root {
+		return
+	}
+	left := filepath.Base(b.dir)
+	b.dir, b.cursor = filepath.Dir(b.dir), 0
+	b.load()
+	for i, e := range b.entries {
+		if e.name == left {
+			b.move(i)
+			break
+		}
+	}
+}
+
+// loadPreview reads the start of the selected file. Compressed files are
+// previewed decompressed; other binary files are not previewed.
+func (b *fileBrowser) loadPreview() {
+	b.preview, b.previewNote = nil, ""
+	e, ok := b.selected()
+	if !ok {
+		return
+	}
+	if e.dir {
+		b.previewNote = "directory"
+		return
+	}
+	lines, err := readPreview(filepath.Join(b.dir, e.name))
+	switch {
+	case err != nil:
+		b.previewNote = err.Error()
+	case lines == nil:
+		b.previewNote = fmt.Sprintf("binary file, %s", formatMem(float64(e.size)))
+	case len(lines) == 0:
+		b.previewNote = "empty file"
+	}
+	b.preview = lines
+}
+
+// readPreview returns the first lines of a text file, nil for binary files.
+func readPreview(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openDecompressed(f, sniffLogCompression(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	defer r.Close()
+	buf, err := io.ReadAll(io.LimitReader(r, browserPreviewBytes))
+	if err != nil && len(buf) == 0 {
+		return nil, err
+	}
+	// A rune cut at the end of the preview does not make a file binary.
+	valid := buf
+	for i := 0; i < utf8.UTFMax && len(valid) > 0 && !utf8.Valid(valid); i++ {
+		valid = valid[:len(valid)-1]
+	}
+	if bytes.IndexByte(buf, 0) >= 0 || !utf8.Valid(valid) {
+		return nil, nil
+	}
+	if len(valid) == 0 {
+		return []string{}, nil
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(valid), "\n"), "\n") {
+		lines = append(lines, stripANSI(cleanLogLine(line)))
+	}
+	return lines, nil
+}
+
+// formatAge formats how long ago a file was modified.
+func formatAge(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case t.Year() == now.Year():
+		return t.Format("Jan 02 15:04")
+	}
+	return t.Format("2006-01-02")
+}
+
+// renderList draws the rows of the listing around the cursor.
+func (b *fileBrowser) renderList(width, height int) string {
+	if b.err != nil && len(b.entries) == 0 {
+		return fmt.Sprintf("⚠ %v", b.err)
+	}
+	if len(b.entries) == 0 {
+		return lipgloss.NewStyle().Foreground(subtle).Render("(empty directory)")
+	}
+	first := max(min(b.cursor-height/2, len(b.entries)-height), 0)
+	now := time.Now()
+	var rows []string
+	for i := first; i < len(b.entries) && i < first+height; i++ {
+		e := b.entries[i]
+		name, size, age := e.name, formatMem(float64(e.size)), formatAge(e.modTime, now)
+		if e.dir {
+			name += "/"
+			size = ""
+		}
+		if e.name == ".." {
+			age = ""
+		}
+		meta := fmt.Sprintf("  %7s  %12s", size, age)
+		nameWidth := max(width-lipgloss.Width(meta), 8)
+		row := fmt.Sprintf("%-*s", nameWidth, truncate.StringWithTail(name, uint(nameWidth), "…")) + meta
+		switch {
+		case i == b.cursor:
+			row = tailSelectionStyle.Render(row)
+		case e.dir:
+			row = lipgloss.NewStyle().Foreground(accentBlue).Render(row)
+		}
+		rows = append(rows, row)
+	}
+	return strings.Join(rows, "\n")
+}
+
+// renderPreview draws the preview of the selected file.
+func (b *fileBrowser) renderPreview(width, height int) string {
+	if b.previewNote != "" {
+		return lipgloss.NewStyle().Foreground(subtle).Render("(" + b.previewNote + ")")
+	}
+	var rows []string
+	for i := 0; i < len(b.preview) && i < height; i++ {
+		rows = append(rows, truncate.StringWithTail(b.preview[i], uint(width), "…"))
+	}
+	return strings.Join(rows, "\n")
+}
+
+// resolveWorkDirCmd resolves the working directory of a job; for jobs
+// Slurm no longer knows, it is the directory of their log.
+func (m Model) resolveWorkDirCmd(id string) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := ResolveWorkDir(id)
+		if err != nil {
+			if out, _, logErr := m.resolveJobLogPaths(id); logErr == nil && out != "" {
+				dir, err = filepath.Dir(out), nil
+			}
+		}
+		return workDirMsg{jobID: id, dir: dir, err: err}
+	}
+}
+
+// updateBrowser handles the keys of the file browser.
+func (m Model) updateBrowser(msg tea.KeyMsg) (Model, tea.Cmd) {
+	b := m.browser
+	page := max(m.browserListHeight(), 1)
+	switch {
+	case key.Matches(msg, scrollKeys.Up):
+		b.move(-1)
+	case key.Matches(msg, scrollKeys.Down):
+		b.move(1)
+	case key.Matches(msg, scrollKeys.PageUp):
+		b.move(-page)
+	case key.Matches(msg, scrollKeys.PageDown):
+		b.move(page)
+	case key.Matches(msg, dialogKeys.Home):
+		b.move(-len(b.entries))
+	case key.Matches(msg, dialogKeys.End):
+		b.move(len(b.entries))
+	case key.Matches(msg, dialogKeys.Confirm, dialogKeys.Open):
+		if path, ok := b.open(); ok {
+			// Files open in the log view, followed; leaving it returns here.
+			return m, m.openTailView(NewTailModel(b.jobID, path, "", m.width, m.height, TailModeStdout))
+		}
+	case key.Matches(msg, dialogKeys.Parent):
+		b.up()
+	case key.Matches(msg, dialogKeys.ShowHidden):
+		b.showHidden = !b.showHidden
+		b.load()
+	case key.Matches(msg, dialogKeys.Reload):
+		b.load()
+	case key.Matches(msg, dialogKeys.Back, dialogKeys.Close):
+		m.browser = nil
+	}
+	return m, nil
+}
+
+// browserListHeight is the number of rows of the listing; the preview gets
+// the rest of the screen.
+func (m Model) browserListHeight() int {
+	return max((m.height-8)/2, 3)
+}
+
+func (m Model) viewBrowser() string {
+	b := m.browser
+	dir := b.dir
+	if rel, err := filepath.Rel(b.root, b.dir); err == nil && rel != "." {
+		dir = filepath.Join(filepath.Base(b.root), rel)
+	}
+	title := metaPillStyle.Copy().
+		Foreground(textStrong).
+		BorderForeground(panelBorder).
+		Render(fmt.Sprintf("Job %s · %s", b.jobID, dir))
+	hint := metaMutedPillStyle.Render(hints("  •  ",
+		hint("open", dialogKeys.Confirm),
+		hint("up", dialogKeys.Parent),
+		hint("hidden", dialogKeys.ShowHidden),
+		hint("reload", dialogKeys.Reload),
+		hint("close", dialogKeys.Back)))
+	var top string
+	if m.width < 90 {
+		top = lipgloss.JoinVertical(lipgloss.Left, title, hint)
+	} else {
+		top = joinWithGap([]string{title, hint}, 1)
+	}
+	top = lipgloss.NewStyle().MaxWidth(m.width).Render(top)
+
+	padY, padX := m.panelPadding()
+	inner := max(m.width-4-2*padX, 10)
+	listHeight := m.browserListHeight()
+	previewHeight := max(m.height-lipgloss.Height(top)-listHeight-4-4*padY, 1)
+	list := m.detailsBoxStyle().Width(m.width - 2).Render(b.renderList(inner, listHeight))
+	preview := m.detailsBoxStyle().Width(m.width - 2).Height(previewHeight).Render(b.renderPreview(inner, previewHeight))
+
+	view := lipgloss.JoinVertical(lipgloss.Left, top, list, preview)
+	view = clampViewHeight(view, m.height)
+	view = clampViewWidth(view, m.width)
+	return lipgloss.Place(m.width, m.height, lipgloss.Left, lipgloss.Top, view)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFileBrowserListsPreviewsAndOpensFiles(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	write := func(name, content string, age time.Duration) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config.yaml", "lr: 0.1\nepochs: 3\n", time.Hour)
+	write("train.log", "epoch 1\nepoch 2\n", time.Minute)
+	write("model.ckpt", "\x00\x01weights", 2*time.Hour)
+	write(".env", "SECRET=1\n", 0)
+	write("ckpt/step-100.txt", "step 100\n", 3*time.Hour)
+	os.Chtimes(filepath.Join(root, "ckpt"), now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+
+	m := Model{width: 120, height: 30, browser: newFileBrowser("42", root)}
+	names := func() []string {
+		var got []string
+		for _, e := range m.browser.entries {
+			got = append(got, e.name)
+		}
+		return got
+	}
+	press := func(keys ...tea.KeyMsg) tea.Cmd {
+		var cmd tea.Cmd
+		for _, k := range keys {
+			m, cmd = m.updateBrowser(k)
+		}
+		return cmd
+	}
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	if got := names(); !reflect.DeepEqual(got, []string{"train.log", "config.yaml", "model.ckpt", "ckpt"}) {
+		t.Fatalf("expected the newest files first without hidden ones, got %v", got)
+	}
+	if view := m.View(); !strings.Contains(view, "epoch 2") || !strings.Contains(view, "Job 42") {
+		t.Fatalf("expected a preview of the newest file:\n%s", view)
+	}
+	press(runes("j"), runes("j"))
+	if !strings.Contains(m.browser.previewNote, "binary file") {
+		t.Fatalf("expected the checkpoint not to be previewed, got %q", m.browser.previewNote)
+	}
+
+	// Directories open in place; the root cannot be left.
+	press(runes("j"), tea.KeyMsg{Type: tea.KeyEnter})
+	if got := names(); !reflect.DeepEqual(got, []string{"..", "step-100.txt"}) {
+		t.Fatalf("expected the checkpoint directory, got %v", got)
+	}
+	press(tea.KeyMsg{Type: tea.KeyBackspace}, tea.KeyMsg{Type: tea.KeyBackspace})
+	if m.browser.dir != root || m.browser.cursor != 3 {
+		t.Fatalf("expected to stay at the root with the directory selected, at %s %d", m.browser.dir, m.browser.cursor)
+	}
+	press(runes("."))
+	if got := names(); got[0] != ".env" {
+		t.Fatalf("expected hidden files to be shown, got %v", got)
+	}
+
+	press(runes("."), runes("g"))
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.inTailView || m.tailModel.stdoutPath != filepath.Join(root, "train.log") || m.browser == nil {
+		t.Fatalf("expected the file to open in the log view over the browser")
+	}
+}
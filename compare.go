@@ -0,0 +1,520 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Compare mode shows the same stream of two jobs side by side, in the
+// panes of the dual view: the first job on the left (the "stdout" pane),
+// the second on the right (the "stderr" pane). Scrolling can be
+// synchronized, and the diff mode aligns the two logs line by line and
+// marks the lines that differ.
+
+// compareState is what a log view comparing two jobs knows about them.
+// It is shared by the copies of the model.
+type compareState struct {
+	jobs   [2]string
+	stdout [2]string
+	stderr [2]string
+	stream string // "stdout" or "stderr"
+
+	sync    bool
+	offsets [2]int // scroll offsets of the panes after the last sync
+
+	diffOn bool
+	diff   *logDiff // nil unless diffOn
+	// The lines diff was computed from, to recompute it only when they change.
+	diffOf [2]linesKey
+}
+
+// linesKey identifies the lines of a pane cheaply: lines are appended,
+// dropped from the front or replaced, and the last one may be rewritten.
+type linesKey struct {
+	n     int
+	first *string
+	last  string
+}
+
+func keyOfLines(lines []string) linesKey {
+	if len(lines) == 0 {
+		return linesKey{}
+	}
+	return linesKey{n: len(lines), first: &lines[0], last: lines[len(lines)-1]}
+}
+
+// paths returns the logs shown in the left and right panes.
+func (c *compareState) paths() (string, string) {
+	if c.stream == "stderr" {
+		return c.stderr[0], c.stderr[1]
+	}
+	return c.stdout[0], c.stdout[1]
+}
+
+// title names the job shown in a pane.
+func (c *compareState) title(side int) string {
+	return fmt.Sprintf("JOB %s %s", c.jobs[side], strings.ToUpper(c.stream))
+}
+
+// NewCompareTailModel opens a log view comparing the stdout of two jobs.
+func NewCompareTailModel(jobs, stdout, stderr [2]string, width, height int) TailModel {
+	c := &compareState{jobs: jobs, stdout: stdout, stderr: stderr, stream: "stdout"}
+	return newCompareTailModel(c, width, height)
+}
+
+func newCompareTailModel(c *compareState, width, height int) TailModel {
+	left, right := c.paths()
+	m := NewTailModel(c.jobs[0], left, right, width, height, TailModeBoth)
+	m.compare = c
+	return m
+}
+
+// switchCompareStream compares the other stream of the two jobs, keeping
+// the view's settings.
+func (m TailModel) switchCompareStream(stream string) (TailModel, tea.Cmd) {
+	if m.compare.stream == stream {
+		return m, nil
+	}
+	c := &compareState{
+		jobs:   m.compare.jobs,
+		stdout: m.compare.stdout,
+		stderr: m.compare.stderr,
+		stream: stream,
+		sync:   m.compare.sync,
+		diffOn: m.compare.diffOn,
+	}
+	next := newCompareTailModel(c, m.width, m.height)
+	m.carrySettings(&next)
+	return next, tea.Batch(
+		closeFollowerCmd(m.stdoutFollower),
+		closeFollowerCmd(m.stderrFollower),
+		next.Init(),
+	)
+}
+
+// otherPane returns the other pane of the dual view.
+func otherPane(pane string) string {
+	if pane == "stderr" {
+		return "stdout"
+	}
+	return "stderr"
+}
+
+// status is the pane header status of compare mode.
+func (c *compareState) status() string {
+	status := ""
+	if c.sync {
+		status += " [SYNC]"
+	}
+	if c.diff != nil {
+		status += fmt.Sprintf(" [DIFF %d]", c.diff.changes)
+	}
+	return status
+}
+
+// syncScroll scrolls the pane that did not move to the line shown at the
+// top of the one that did. While following, both panes keep to the end of
+// their logs instead.
+func (m *TailModel) syncScroll() {
+	c := m.compare
+	defer func() {
+		c.offsets = [2]int{m.stdoutView.YOffset, m.stderrView.YOffset}
+	}()
+	if m.following && !m.paused {
+		return
+	}
+	moved := [2]bool{m.stdoutView.YOffset != c.offsets[0], m.stderrView.YOffset != c.offsets[1]}
+	leader := m.activePane
+	if moved[0] != moved[1] {
+		leader = 0
+		if moved[1] {
+			leader = 1
+		}
+	} else if !moved[0] {
+		return
+	}
+	from, to := m.paneRefs("stdout"), m.paneRefs("stderr")
+	if leader == 1 {
+		from, to = to, from
+	}
+	line := lineAtOffset(*from.wrapped, from.view.YOffset)
+	to.view.SetYOffset(lineOffset(*to.wrapped, line))
+}
+
+// volatileRegexp matches what differs between runs of the same job even
+// when they behave the same: timestamps, durations, addresses, hashes and
+// numbers.
+var volatileRegexp = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}[T ]\d{1,2}:\d{2}(?::\d{2})?(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?` +
+		`|\d{1,2}:\d{2}(?::\d{2})?(?:[.,]\d+)?` +
+		`|0[xX][0-9a-fA-F]+|\b[0-9a-f]{8,}\b` +
+		`|\d+(?:\.\d+)?(?:[eE][-+]?\d+)?`)
+
+// maskVolatile returns the text of a line that the diff compares.
+func maskVolatile(line string) string {
+	return volatileRegexp.ReplaceAllString(strings.TrimRight(stripANSI(line), " \t"), "#")
+}
+
+// logDiff is the alignment of two logs: rows of the two panes, each either
+// a line of its log or a gap where the other log has lines this one
+// lacks.
+type logDiff struct {
+	shown   [2][]string
+	raw     [2][]int // -1 for gaps
+	changed []bool
+	changes int // rows that differ
+}
+
+// diffLogs aligns two logs.
+func diffLogs(a, b []string) *logDiff {
+	keys := [2][]string{make([]string, len(a)), make([]string, len(b))}
+	for i, line := range a {
+		keys[0][i] = maskVolatile(line)
+	}
+	for i, line := range b {
+		keys[1][i] = maskVolatile(line)
+	}
+	var pairs [][2]int
+	matchLines(keys[0], keys[1], 0, len(a), 0, len(b), &pairs)
+
+	d := &logDiff{}
+	row := func(i, j int, changed bool) {
+		for side, k := range [2]int{i, j} {
+			lines := a
+			if side == 1 {
+				lines = b
+			}
+			text := ""
+			if k >= 0 {
+				text = lines[k]
+			}
+			d.shown[side] = append(d.shown[side], text)
+			d.raw[side] = append(d.raw[side], k)
+		}
+		d.changed = append(d.changed, changed)
+		if changed {
+			d.changes++
+		}
+	}
+	i, j := 0, 0
+	for _, p := range append(pairs, [2]int{len(a), len(b)}) {
+		// Lines between matches are paired up as changed lines.
+		for i < p[0] || j < p[1] {
+			ai, bj := -1, -1
+			if i < p[0] {
+				ai, i = i, i+1
+			}
+			if j < p[1] {
+				bj, j = j, j+1
+			}
+			row(ai, bj, true)
+		}
+		if p[0] < len(a) {
+			row(p[0], p[1], false)
+			i, j = p[0]+1, p[1]+1
+		}
+	}
+	return d
+}
+
+// maxDiffLCSCells bounds the table of the exact diff of a region without
+// unique lines to anchor on; larger regions are left unmatched.
+const maxDiffLCSCells = 1 << 18
+
+// matchLines appends the pairs of equal lines of a[aLo:aHi] and b[bLo:bHi]
+// to pairs, in order. It is a patience diff: lines unique to both sides
+// anchor the alignment, and the regions between anchors are matched the
+// same way.
+func matchLines(a, b []string, aLo, aHi, bLo, bHi int, pairs *[][2]int) {
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		*pairs = append(*pairs, [2]int{aLo, bLo})
+		aLo, bLo = aLo+1, bLo+1
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && a[aHi-suffix-1] == b[bHi-suffix-1] {
+		suffix++
+	}
+	aEnd, bEnd := aHi-suffix, bHi-suffix
+
+	if aLo < aEnd && bLo < bEnd {
+		anchors := uniqueAnchors(a, b, aLo, aEnd, bLo, bEnd)
+		if len(anchors) > 0 {
+			i, j := aLo, bLo
+			for _, p := range anchors {
+				matchLines(a, b, i, p[0], j, p[1], pairs)
+				*pairs = append(*pairs, p)
+				i, j = p[0]+1, p[1]+1
+			}
+			matchLines(a, b, i, aEnd, j, bEnd, pairs)
+		} else if (aEnd-aLo)*(bEnd-bLo) <= maxDiffLCSCells {
+			*pairs = append(*pairs, lcsPairs(a, b, aLo, aEnd, bLo, bEnd)...)
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		*pairs = append(*pairs, [2]int{aEnd + k, bEnd + k})
+	}
+}
+
+// uniqueAnchors returns the lines occurring once on each side of the
+// regions, in order on both sides (the longest such sequence).
+func uniqueAnchors(a, b []string, aLo, aHi, bLo, bHi int) [][2]int {
+	type count struct{ a, b, aAt, bAt int }
+	counts := make(map[string]*count)
+	for i := aLo; i < aHi; i++ {
+		c := counts[a[i]]
+		if c == nil {
+			c = &count{}
+			counts[a[i]] = c
+		}
+		c.a++
+		c.aAt = i
+	}
+	for j := bLo; j < bHi; j++ {
+		if c := counts[b[j]]; c != nil {
+			c.b++
+			c.bAt = j
+		}
+	}
+	var unique [][2]int
+	for _, c := range counts {
+		if c.a == 1 && c.b == 1 {
+			unique = append(unique, [2]int{c.aAt, c.bAt})
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i][0] < unique[j][0] })
+	return longestIncreasing(unique)
+}
+
+// longestIncreasing returns the longest subsequence of pairs (sorted by
+// their first index) whose second indexes increase too.
+func longestIncreasing(pairs [][2]int) [][2]int {
+	if len(pairs) == 0 {
+		return nil
+	}
+	// tails[k] is the pair ending the best subsequence of length k+1.
+	var tails []int
+	prev := make([]int, len(pairs))
+	for i, p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool { return pairs[tails[k]][1] >= p[1] })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	seq := make([][2]int, len(tails))
+	for i, k := tails[len(tails)-1], len(tails)-1; k >= 0; i, k = prev[i], k-1 {
+		seq[k] = pairs[i]
+	}
+	return seq
+}
+
+// lcsPairs matches a region exactly, by longest common subsequence.
+func lcsPairs(a, b []string, aLo, aHi, bLo, bHi int) [][2]int {
+	n, m := aHi-aLo, bHi-bLo
+	// lengths[i][j] is the LCS of a[aLo+i:aHi] and b[bLo+j:bHi].
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[aLo+i] == b[bLo+j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[aLo+i] == b[bLo+j]:
+			pairs = append(pairs, [2]int{aLo + i, bLo + j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// sameAlignment reports whether two diffs align the logs the same way.
+func (d *logDiff) sameAlignment(other *logDiff) bool {
+	if d == nil || other == nil {
+		return d == other
+	}
+	for side := range d.raw {
+		if len(d.raw[side]) != len(other.raw[side]) {
+			return false
+		}
+		for i, r := range d.raw[side] {
+			if other.raw[side][i] != r {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// displayIndex returns the row at or after a line of one side.
+func (d *logDiff) displayIndex(side, raw int) int {
+	for i, r := range d.raw[side] {
+		if r >= raw {
+			return i
+		}
+	}
+	return len(d.raw[side])
+}
+
+// paneDiff returns the diff a pane shows and its side of it, or nil when
+// the pane shows its lines as they are.
+func (m *TailModel) paneDiff(pane string) (*logDiff, int) {
+	if m.compare == nil || m.compare.diff == nil {
+		return nil, 0
+	}
+	switch pane {
+	case "stdout":
+		return m.compare.diff, 0
+	case "stderr":
+		return m.compare.diff, 1
+	}
+	return nil, 0
+}
+
+// updateDiff realigns the compared logs in diff mode, when their lines
+// changed since the last diff, and reports whether the alignment changed.
+func (m *TailModel) updateDiff() bool {
+	c := m.compare
+	if c == nil || !c.diffOn {
+		return false
+	}
+	of := [2]linesKey{keyOfLines(m.stdoutLines), keyOfLines(m.stderrLines)}
+	if c.diff != nil && of == c.diffOf {
+		return false
+	}
+	d := diffLogs(m.stdoutLines, m.stderrLines)
+	changed := !d.sameAlignment(c.diff)
+	c.diff, c.diffOf = d, of
+	return changed
+}
+
+// markDiffLevels marks the changed rows of a pane that no log rule marks.
+func (m *TailModel) markDiffLevels(pane string) {
+	d, _ := m.paneDiff(pane)
+	if d == nil {
+		return
+	}
+	levels := *m.paneRefs(pane).levels
+	for i, changed := range d.changed {
+		if changed && i < len(levels) && levels[i] == levelNone {
+			levels[i] = levelChanged
+		}
+	}
+}
+
+// toggleDiff turns the diff mode on or off.
+func (m *TailModel) toggleDiff() {
+	c := m.compare
+	c.diffOn = !c.diffOn
+	c.diff = nil
+	m.clearSelection()
+	m.refreshStdoutContent()
+	m.refreshStderrContent()
+}
+
+// comparePathsMsg carries the logs of the two jobs to compare.
+type comparePathsMsg struct {
+	jobs           [2]string
+	stdout, stderr [2]string
+	err            error
+}
+
+// resolveComparePathsCmd resolves the logs of two jobs.
+func (m Model) resolveComparePathsCmd(a, b string) tea.Cmd {
+	return func() tea.Msg {
+		msg := comparePathsMsg{jobs: [2]string{a, b}}
+		for side, id := range msg.jobs {
+			out, errPath, err := m.resolveJobLogPaths(id)
+			msg.stdout[side], msg.stderr[side] = out, errPath
+			if err != nil && msg.err == nil {
+				msg.err = fmt.Errorf("job %s: %w", id, err)
+			}
+		}
+		return msg
+	}
+}
+
+// markOrCompare handles the compare key on the selected job: the first
+// press marks it, a press on another job compares the two, and a second
+// press on the marked job asks for the ID of the job to compare it with.
+func (m Model) markOrCompare(job *Job) (Model, tea.Cmd) {
+	switch {
+	case m.compareBase == "":
+		m.compareBase = job.JobID
+	case m.compareBase != job.JobID:
+		a := m.compareBase
+		m.compareBase = ""
+		m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
+		return m, m.resolveComparePathsCmd(a, job.JobID)
+	default:
+		ti := textinput.New()
+		ti.Placeholder = "Job ID"
+		ti.CharLimit = 32
+		ti.Width = 20
+		ti.Prompt = ""
+		ti.TextStyle = lipgloss.NewStyle().Foreground(textStrong)
+		ti.PlaceholderStyle = lipgloss.NewStyle().Foreground(subtle)
+		ti.Cursor.Style = lipgloss.NewStyle().Foreground(highlight)
+		m.compareInput = ti
+		m.comparePrompt = true
+		return m, m.compareInput.Focus()
+	}
+	return m, nil
+}
+
+// updateComparePrompt handles the keys of the job ID prompt.
+func (m Model) updateComparePrompt(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, dialogKeys.Confirm):
+		id := strings.TrimSpace(m.compareInput.Value())
+		if id == "" {
+			return m, nil
+		}
+		a := m.compareBase
+		m.comparePrompt, m.compareBase = false, ""
+		m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
+		return m, m.resolveComparePathsCmd(a, id)
+	case key.Matches(msg, dialogKeys.Back):
+		m.comparePrompt, m.compareBase = false, ""
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.compareInput, cmd = m.compareInput.Update(msg)
+	return m, cmd
+}
+
+func (m Model) viewComparePrompt() string {
+	msg := fmt.Sprintf("Compare the logs of job %s with job:\n\n%s\n\n%s",
+		m.compareBase, filterBoxStyle.Render(m.compareInput.View()),
+		hints(" • ", hint("compare", dialogKeys.Confirm), hint("cancel", dialogKeys.Back)))
+	return lipgloss.Place(m.width, m.height,
+		lipgloss.Center, lipgloss.Center,
+		dialogStyle.Render(msg),
+	)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMaskVolatileIgnoresTimesAndNumbers(t *testing.T) {
+	a := maskVolatile("2024-05-01T12:00:03.123Z step 10 loss=0.52 took 00:01:02 at 0x7ffd2c")
+	b := maskVolatile("2024-06-11T08:41:59.001Z step 11 loss=0.48 took 00:01:10 at 0x7ffe90")
+	if a != b {
+		t.Fatalf("expected equal masks, got %q and %q", a, b)
+	}
+	if maskVolatile("loading model") == maskVolatile("loading data") {
+		t.Fatalf("words must still differ")
+	}
+}
+
+func TestDiffLogsAlignsInsertedAndChangedLines(t *testing.T) {
+	a := []string{"start 1", "load data", "epoch 1 loss=0.5", "done"}
+	b := []string{"start 2", "load data", "warning: slow disk", "epoch 1 loss=0.7", "save", "done"}
+	d := diffLogs(a, b)
+	wantA := []int{0, 1, -1, 2, -1, 3}
+	wantB := []int{0, 1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(d.raw[0], wantA) || !reflect.DeepEqual(d.raw[1], wantB) {
+		t.Fatalf("unexpected alignment %v / %v", d.raw[0], d.raw[1])
+	}
+	if d.changes != 2 || !d.changed[2] || !d.changed[4] || d.changed[3] {
+		t.Fatalf("unexpected changes %v", d.changed)
+	}
+
+	// Lines that differ in words are paired up as changed.
+	d = diffLogs([]string{"a", "using cpu", "b"}, []string{"a", "using gpu", "b"})
+	if len(d.changed) != 3 || !d.changed[1] || d.raw[0][1] != 1 || d.raw[1][1] != 1 {
+		t.Fatalf("expected one changed row, got %v %v", d.raw, d.changed)
+	}
+}
+
+func TestCompareViewDiffAndSyncScroll(t *testing.T) {
+	m := NewCompareTailModel([2]string{"10", "11"}, [2]string{"/logs/10.out", "/logs/11.out"}, [2]string{"/logs/10.err", "/logs/11.err"}, 120, 20)
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	var left, right []string
+	for i := 0; i < 40; i++ {
+		left = append(left, "line "+strings.Repeat("x", i%3))
+		right = append(right, "line "+strings.Repeat("x", i%3))
+	}
+	right = append(right[:5], append([]string{"extra"}, right[5:]...)...)
+	update(tailStartMsg{pane: "stdout", initialLines: left})
+	update(tailStartMsg{pane: "stderr", initialLines: right})
+	if view := m.View(); !strings.Contains(view, "JOB 10 STDOUT") || !strings.Contains(view, "JOB 11 STDOUT") {
+		t.Fatalf("expected the job IDs in the headers:\n%s", view)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'D'}})
+	if got := m.displayLines("stdout"); len(got) != 41 || got[5] != "" || m.rawIndex("stdout", 5) != -1 {
+		t.Fatalf("expected a gap facing the extra line, got %d lines", len(got))
+	}
+	if m.stderrLevels[5] != levelChanged || m.stdoutLevels[4] != levelNone {
+		t.Fatalf("expected the extra line to be marked")
+	}
+	if !strings.Contains(m.View(), "[DIFF 1]") {
+		t.Fatalf("expected the diff status in the header")
+	}
+
+	// New lines realign both panes.
+	update(logLineMsg{pane: "stdout", lines: []string{"only left"}})
+	if got := len(m.displayLines("stderr")); got != 42 {
+		t.Fatalf("expected a gap in the right pane, got %d rows", got)
+	}
+	// Refreshing the same lines keeps the diff.
+	diff := m.compare.diff
+	m.refreshViewportContent()
+	if m.compare.diff != diff {
+		t.Fatalf("expected the diff to be computed only when lines change")
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'S'}})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'g'}})
+	if m.stdoutView.YOffset != 0 || m.stderrView.YOffset != 0 {
+		t.Fatalf("expected both panes at the top")
+	}
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	if m.stdoutView.YOffset != 2 || m.stderrView.YOffset != 2 {
+		t.Fatalf("expected the right pane to follow, got %d and %d", m.stdoutView.YOffset, m.stderrView.YOffset)
+	}
+}
+
+func TestCompareKeyMarksThenAsksForAJob(t *testing.T) {
+	m := NewModel()
+	m.jobs = []Job{{JobID: "1", Status: "RUNNING"}, {JobID: "2", Status: "RUNNING"}}
+	m.updateTable()
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(Model)
+	}
+	compare := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'='}}
+	update(compare)
+	if m.compareBase != "1" || m.comparePrompt {
+		t.Fatalf("expected job 1 to be marked, got %q", m.compareBase)
+	}
+	update(compare)
+	if !m.comparePrompt || !strings.Contains(m.View(), "Compare the logs of job 1") {
+		t.Fatalf("expected the job ID prompt")
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.comparePrompt || m.compareBase != "" {
+		t.Fatalf("expected Esc to cancel the compare")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const envConfigPath = "SLURM_DASHBOARD_CONFIG"
+
+// Config holds the optional settings read from the dashboard config file.
+// Everything that fits in a single value stays an environment variable; the
+// file is for structured settings (hooks, rules, ...).
+type Config struct {
+	Hooks    []HookConfig   `json:"hooks"`
+	Archive  ArchiveConfig  `json:"archive"`
+	LogRules LogRulesConfig `json:"log_rules"`
+	Metrics  MetricsConfig  `json:"metrics"`
+	Keys     KeysConfig     `json:"keys"`
+}
+
+// dashboardDir returns ~/.slurm-dashboard, the root for local state.
+func dashboardDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".slurm-dashboard")
+}
+
+// configPath returns the config file location. SLURM_DASHBOARD_CONFIG
+// overrides the default ~/.slurm-dashboard/config.json.
+func configPath() string {
+	if configured := strings.TrimSpace(os.Getenv(envConfigPath)); configured != "" {
+		return expandHomePath(configured)
+	}
+	dir := dashboardDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// loadConfig reads and validates the config file. A missing file is not an
+// error: it yields the zero Config.
+func loadConfig() (Config, error) {
+	path := configPath()
+	if path == "" {
+		return Config{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("reading config: %w", err)
+	}
+	return parseConfig(data, path)
+}
+
+func parseConfig(data []byte, path string) (Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range cfg.Hooks {
+		if err := cfg.Hooks[i].validate(); err != nil {
+			return Config{}, fmt.Errorf("%s: hook %d: %w", path, i+1, err)
+		}
+	}
+	if err := cfg.Archive.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: archive: %w", path, err)
+	}
+	if err := cfg.LogRules.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: log_rules: %w", path, err)
+	}
+	if err := cfg.Metrics.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: metrics: %w", path, err)
+	}
+	if err := cfg.Keys.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: keys: %w", path, err)
+	}
+	return cfg, nil
+}
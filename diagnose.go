@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// diagnoseTailLines is how much of the end of stderr is scanned for the
+// error that ended a failed job.
+const diagnoseTailLines = 200
+
+// diagnosableStates are the states worth a "why did this fail" diagnosis.
+var diagnosableStates = map[string]bool{"F": true, "TO": true, "OOM": true, "NF": true}
+
+var signalNames = map[int]string{
+	1: "SIGHUP", 2: "SIGINT", 6: "SIGABRT", 7: "SIGBUS", 8: "SIGFPE",
+	9: "SIGKILL", 11: "SIGSEGV", 13: "SIGPIPE", 15: "SIGTERM",
+}
+
+// jobStep is one sacct row of a job: the job itself or one of its steps.
+type jobStep struct {
+	ID          string
+	Name        string
+	State       string
+	ExitCode    string
+	DerivedCode string // DerivedExitCode, only set on the job row
+	MaxRSS      string
+	ReqMem      string
+	Elapsed     string
+	Timelimit   string
+	AllocCPUS   string
+	NNodes      string
+	NodeList    string
+}
+
+type diagnosisMsg struct {
+	jobID string
+	text  string
+}
+
+// FetchJobSteps fetches the sacct rows of a job and its steps.
+func FetchJobSteps(jobID string) ([]jobStep, error) {
+	args := []string{
+		"sacct", "-j", jobID,
+		"--format", "JobID,JobName,State,ExitCode,DerivedExitCode,MaxRSS,ReqMem,Elapsed,Timelimit,AllocCPUS,NNodes,NodeList",
+		"-P", "-n",
+	}
+	out, err := RunCommand(args, 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return parseJobSteps(out), nil
+}
+
+func parseJobSteps(output string) []jobStep {
+	var steps []jobStep
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.Split(line, "|")
+		if len(parts) < 12 {
+			continue
+		}
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		steps = append(steps, jobStep{
+			ID: parts[0], Name: parts[1], State: parts[2], ExitCode: parts[3],
+			DerivedCode: parts[4], MaxRSS: parts[5], ReqMem: parts[6], Elapsed: parts[7],
+			Timelimit: parts[8], AllocCPUS: parts[9], NNodes: parts[10], NodeList: parts[11],
+		})
+	}
+	return steps
+}
+
+// stepLabel names a step for the diagnosis: "step 3", "batch step", ...
+func (s jobStep) stepLabel() string {
+	i := strings.LastIndex(s.ID, ".")
+	if i < 0 {
+		return "job"
+	}
+	name := s.ID[i+1:]
+	if _, err := strconv.Atoi(name); err == nil {
+		return "step " + name
+	}
+	return name + " step"
+}
+
+// exitRank orders failed steps by what their exit tells: steps the job ran
+// (numbered) before the batch and extern steps, signals before exit codes.
+func (s jobStep) exitRank() int {
+	rank := 0
+	if !strings.HasPrefix(s.stepLabel(), "step ") {
+		rank += 2
+	}
+	if _, signal := parseExitCode(s.ExitCode); signal == 0 {
+		rank++
+	}
+	return rank
+}
+
+// parseExitCode splits sacct's "code:signal".
+func parseExitCode(s string) (code, signal int) {
+	c, sig, _ := strings.Cut(s, ":")
+	code, _ = strconv.Atoi(c)
+	signal, _ = strconv.Atoi(sig)
+	return code, signal
+}
+
+func describeExit(s string) string {
+	code, signal := parseExitCode(s)
+	switch {
+	case signal != 0:
+		if name, ok := signalNames[signal]; ok {
+			return fmt.Sprintf("killed by signal %d (%s)", signal, name)
+		}
+		return fmt.Sprintf("killed by signal %d", signal)
+	case code != 0:
+		return fmt.Sprintf("exited with code %d", code)
+	}
+	return ""
+}
+
+// parseSlurmMem parses a sacct memory value ("63.8G", "4000Mc", "512000K")
+// into bytes; bare numbers are in unit. perCPU reports ReqMem's "c" suffix.
+func parseSlurmMem(s string, unit float64) (bytes float64, perCPU bool, ok bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "c") || strings.HasSuffix(s, "n") {
+		perCPU = strings.HasSuffix(s, "c")
+		s = s[:len(s)-1]
+	}
+	if s == "" {
+		return 0, false, false
+	}
+	if i := strings.IndexByte("KMGTP", s[len(s)-1]); i >= 0 {
+		unit = float64(int64(1) << (10 * (i + 1)))
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	return v * unit, perCPU, true
+}
+
+// formatMem formats bytes the way sacct does, e.g. "63.8G".
+func formatMem(bytes float64) string {
+	units := "KMGTP"
+	v, unit := bytes/1024, 0
+	for v >= 1024 && unit < len(units)-1 {
+		v /= 1024
+		unit++
+	}
+	text := strconv.FormatFloat(v, 'f', 1, 64)
+	return strings.TrimSuffix(text, ".0") + units[unit:unit+1]
+}
+
+// diagnoseFailure explains why a job failed from its sacct rows and the end
+// of its stderr. It returns "" without sacct rows.
+func diagnoseFailure(steps []jobStep, stderrTail []string, rules *logRuleSet) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	job := steps[0]
+	for _, s := range steps {
+		if !strings.Contains(s.ID, ".") {
+			job = s
+			break
+		}
+	}
+	state := StateCode(job.State)
+
+	// The step that used the most memory, against what each node asked for.
+	var peak jobStep
+	var peakRSS float64
+	for _, s := range steps {
+		if rss, _, ok := parseSlurmMem(s.MaxRSS, 1); ok && rss > peakRSS {
+			peak, peakRSS = s, rss
+		}
+	}
+	requested, perCPU, hasReq := parseSlurmMem(job.ReqMem, 1<<20)
+	if hasReq && perCPU {
+		cpus, _ := strconv.Atoi(job.AllocCPUS)
+		nodes, _ := strconv.Atoi(job.NNodes)
+		if nodes < 1 {
+			nodes = 1
+		}
+		requested *= float64(cpus) / float64(nodes)
+	}
+	memFull := hasReq && requested > 0 && peakRSS >= 0.95*requested
+
+	// The batch step is killed along with the step it ran: a numbered step
+	// sacct marks says more.
+	var oomStep *jobStep
+	oomMarked, killed := false, false
+	for i, s := range steps {
+		if StateCode(s.State) == "OOM" && strings.Contains(s.ID, ".") {
+			oomMarked = true
+			if oomStep == nil && strings.HasPrefix(s.stepLabel(), "step ") {
+				oomStep = &steps[i]
+			}
+		}
+		if code, signal := parseExitCode(s.ExitCode); signal == 9 || code == 137 {
+			killed = true
+		}
+	}
+	// A step killed with SIGKILL at its memory limit was most likely
+	// killed by the OOM killer; a time limit or node failure says more.
+	oom := state == "OOM" || oomMarked || memFull && killed && state != "TO" && state != "NF"
+
+	var summary string
+	switch {
+	case oom:
+		// The step sacct marks, or else the one that peaked.
+		where, rss := peak, peakRSS
+		if oomStep != nil {
+			where = *oomStep
+			rss, _, _ = parseSlurmMem(oomStep.MaxRSS, 1)
+		}
+		summary = "Out of memory"
+		if label := where.stepLabel(); where.ID != "" && label != "job" {
+			summary += " in " + label
+		}
+		if rss > 0 && hasReq {
+			summary += fmt.Sprintf(": MaxRSS %s of %s requested", formatMem(rss), formatMem(requested))
+		}
+	case state == "TO":
+		summary = "Time limit reached"
+		if job.Elapsed != "" && job.Timelimit != "" {
+			summary += fmt.Sprintf(": ran %s of %s", job.Elapsed, job.Timelimit)
+		}
+	case state == "NF":
+		summary = "Node failure"
+		if job.NodeList != "" && job.NodeList != "None assigned" {
+			summary += " on " + job.NodeList
+		}
+	default:
+		// The batch script usually exits non-zero because a step it ran
+		// crashed: that step says more.
+		var failed jobStep
+		bestRank := -1
+		for _, s := range steps {
+			if !strings.Contains(s.ID, ".") || describeExit(s.ExitCode) == "" {
+				continue
+			}
+			if rank := s.exitRank(); bestRank < 0 || rank < bestRank {
+				failed, bestRank = s, rank
+			}
+		}
+		if bestRank >= 0 {
+			summary = capitalize(failed.stepLabel()) + " " + describeExit(failed.ExitCode)
+		}
+		if summary == "" {
+			if exit := describeExit(job.ExitCode); exit != "" {
+				summary = "Job " + exit
+			} else if exit := describeExit(job.DerivedCode); exit != "" {
+				summary = "A step " + exit
+			} else {
+				summary = "Failed (" + job.State + ")"
+			}
+		}
+	}
+
+	if memFull && !oom {
+		summary += fmt.Sprintf("; MaxRSS %s of %s requested", formatMem(peakRSS), formatMem(requested))
+	}
+	if line := lastErrorLine(stderrTail, rules); line != "" {
+		summary += "; last stderr: " + line
+	}
+	return summary
+}
+
+// lastErrorLine returns the last line the rules mark as an error,
+// shortened. For a traceback that is the exception that ended it.
+func lastErrorLine(lines []string, rules *logRuleSet) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(stripANSI(lines[i]))
+		if rules.classify(line) != levelError {
+			continue
+		}
+		if runeLen(line) > 120 {
+			line = runeSlice(line, 0, 119) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// diagnoseCmd diagnoses the selected job when history mode shows it failed.
+func (m Model) diagnoseCmd(id string) tea.Cmd {
+	if m.appMode != modeHistory {
+		return nil
+	}
+	var job *Job
+	for i := range m.jobs {
+		if m.jobs[i].JobID == id {
+			job = &m.jobs[i]
+			break
+		}
+	}
+	if job == nil || !diagnosableStates[job.State()] {
+		return nil
+	}
+	rules := m.logRules
+	return func() tea.Msg {
+		steps, err := FetchJobSteps(id)
+		if err != nil {
+			return diagnosisMsg{jobID: id}
+		}
+		var stderrPath string
+		if rec, ok := m.store.Lookup(id); ok && (rec.Stdout != "" || rec.Stderr != "") {
+			stderrPath = rec.Stderr
+			if stderrPath == "" {
+				stderrPath = rec.Stdout
+			}
+		} else if out, errPath, err := ResolveLogPaths(id); err == nil {
+			stderrPath = errPath
+			if stderrPath == "" {
+				stderrPath = out
+			}
+		}
+		var tail []string
+		if stderrPath != "" {
+			tail, _ = readLogTail(stderrPath, diagnoseTailLines)
+		}
+		return diagnosisMsg{jobID: id, text: diagnoseFailure(steps, tail, rules)}
+	}
+}
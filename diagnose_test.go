@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseFailureOutOfMemory(t *testing.T) {
+	steps := parseJobSteps(strings.Join([]string{
+		"4242|train|OUT_OF_MEMORY|0:125|0:0||64G|02:10:00|1-00:00:00|8|1|gpu01",
+		"4242.batch|batch|OUT_OF_MEMORY|0:125||1200K|||||8|1|gpu01",
+		"4242.extern|extern|COMPLETED|0:0||0|||||8|1|gpu01",
+		"4242.3|python|OUT_OF_MEMORY|0:125||66900787K|||||8|1|gpu01",
+	}, "\n"))
+	tail := []string{
+		"Traceback (most recent call last):",
+		`  File "train.py", line 10, in <module>`,
+		"torch.cuda.OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB",
+		"epoch 3 done",
+	}
+	got := diagnoseFailure(steps, tail, defaultLogRuleSet)
+	want := "Out of memory in step 3: MaxRSS 63.8G of 64G requested; last stderr: torch.cuda.OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB"
+	if got != want {
+		t.Fatalf("diagnosis = %q\nwant        %q", got, want)
+	}
+}
+
+func TestDiagnoseFailureBlamesTheStepMarkedOutOfMemory(t *testing.T) {
+	steps := parseJobSteps(strings.Join([]string{
+		"4343|train|OUT_OF_MEMORY|0:125|0:0||64G|02:10:00|1-00:00:00|8|1|gpu01",
+		"4343.batch|batch|OUT_OF_MEMORY|0:125||1200K|||||8|1|gpu01",
+		"4343.1|prep|COMPLETED|0:0||60G|||||8|1|gpu01",
+		"4343.3|python|OUT_OF_MEMORY|0:125||50G|||||8|1|gpu01",
+	}, "\n"))
+	got := diagnoseFailure(steps, nil, defaultLogRuleSet)
+	want := "Out of memory in step 3: MaxRSS 50G of 64G requested"
+	if got != want {
+		t.Fatalf("diagnosis = %q\nwant        %q", got, want)
+	}
+}
+
+func TestDiagnoseFailureStates(t *testing.T) {
+	cases := []struct {
+		rows []string
+		want string
+	}{
+		{
+			[]string{"7|sim|TIMEOUT|0:0|0:0||4000Mc|1-00:00:12|1-00:00:00|4|1|cn01"},
+			"Time limit reached: ran 1-00:00:12 of 1-00:00:00",
+		},
+		{
+			[]string{"8|sim|NODE_FAIL|0:0|0:0||16G|00:10:00|01:00:00|4|2|cn[01-02]"},
+			"Node failure on cn[01-02]",
+		},
+		{
+			[]string{
+				"9|sim|FAILED|1:0|0:11||16G|00:10:00|01:00:00|4|1|cn01",
+				"9.batch|batch|FAILED|1:0||100M|||||4|1|cn01",
+				"9.0|sim|FAILED|0:11||200M|||||4|1|cn01",
+			},
+			"Step 0 killed by signal 11 (SIGSEGV)",
+		},
+		{
+			[]string{
+				"11|sim|FAILED|2:0|0:0||16G|00:10:00|01:00:00|4|1|cn01",
+				"11.batch|batch|FAILED|2:0||100M|||||4|1|cn01",
+				"11.0|sim|COMPLETED|0:0||200M|||||4|1|cn01",
+			},
+			"Batch step exited with code 2",
+		},
+		{
+			[]string{
+				"10|sim|FAILED|0:0|0:0||4000Mc|00:10:00|01:00:00|4|1|cn01",
+				"10.0|sim|FAILED|0:9||15.9G|||||4|1|cn01",
+			},
+			"Out of memory in step 0: MaxRSS 15.9G of 15.6G requested",
+		},
+		{
+			// Memory near the limit is a detail of a timeout or a crash.
+			[]string{
+				"12|sim|TIMEOUT|0:0|0:0||16G|01:00:05|01:00:00|4|1|cn01",
+				"12.0|sim|CANCELLED|0:15||15.8G|||||4|1|cn01",
+			},
+			"Time limit reached: ran 01:00:05 of 01:00:00; MaxRSS 15.8G of 16G requested",
+		},
+		{
+			[]string{
+				"13|sim|FAILED|0:0|0:0||16G|00:10:00|01:00:00|4|1|cn01",
+				"13.0|sim|FAILED|0:11||15.8G|||||4|1|cn01",
+			},
+			"Step 0 killed by signal 11 (SIGSEGV); MaxRSS 15.8G of 16G requested",
+		},
+		{
+			// Per-CPU memory counts the CPUs of each node: 3 CPUs on 2 nodes.
+			[]string{
+				"14|sim|FAILED|0:0|0:0||4000Mc|00:10:00|01:00:00|3|2|cn[01-02]",
+				"14.0|sim|FAILED|0:9||5.8G|||||3|2|cn[01-02]",
+			},
+			"Out of memory in step 0: MaxRSS 5.8G of 5.9G requested",
+		},
+	}
+	for _, c := range cases {
+		got := diagnoseFailure(parseJobSteps(strings.Join(c.rows, "\n")), nil, defaultLogRuleSet)
+		if got != c.want {
+			t.Errorf("diagnosis of %q = %q, want %q", c.rows[0], got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JobEvent describes a state transition observed between two polls.
+// PrevState is empty when a job shows up for the first time. A running job
+// whose logs went quiet gets an event with the STALLED pseudo-state.
+type JobEvent struct {
+	Job       Job
+	PrevState string
+	State     string
+	Time      time.Time
+	Quiet     time.Duration // how long a stalled job has written nothing
+}
+
+// IsTerminal reports whether the event moved the job into a finished state.
+func (e JobEvent) IsTerminal() bool {
+	return e.Job.IsHistorical()
+}
+
+// Failed reports whether the job ended in a non-successful terminal state.
+func (e JobEvent) Failed() bool {
+	return e.IsTerminal() && e.State != "CD"
+}
+
+func (e JobEvent) String() string {
+	if e.State == stateStalled {
+		return fmt.Sprintf("Job %s (%s) possibly stalled: no output for %s", e.Job.JobID, e.Job.Name, formatQuiet(e.Quiet))
+	}
+	prev := e.PrevState
+	if prev == "" {
+		prev = "NEW"
+	}
+	text := fmt.Sprintf("Job %s (%s) %s → %s", e.Job.JobID, e.Job.Name, prev, e.State)
+	if e.Job.ExitCode != "" && e.IsTerminal() {
+		text += fmt.Sprintf(" exit %s", e.Job.ExitCode)
+	}
+	return text
+}
+
+// jobTracker remembers the last known state of every job it has seen and
+// turns successive job lists into JobEvents.
+//
+// squeue forgets jobs as soon as they finish, so in live mode a finished job
+// simply disappears. Missing reports those jobs so the caller can ask sacct
+// for their final state and feed it back through Resolve.
+type jobTracker struct {
+	jobs   map[string]Job
+	primed bool
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: map[string]Job{}}
+}
+
+// Observe records a job list and returns the transitions since the previous
+// call. The first call only primes the tracker. Jobs first seen in a terminal
+// state (e.g. old history entries) never produce events since their
+// transition was not observed.
+func (t *jobTracker) Observe(jobs []Job) []JobEvent {
+	now := time.Now()
+	var events []JobEvent
+	for _, job := range jobs {
+		state := job.State()
+		prev, known := t.jobs[job.JobID]
+		t.jobs[job.JobID] = job
+		if !t.primed {
+			continue
+		}
+		switch {
+		case !known && !job.IsHistorical():
+			events = append(events, JobEvent{Job: job, State: state, Time: now})
+		case known && prev.State() != state:
+			events = append(events, JobEvent{Job: job, PrevState: prev.State(), State: state, Time: now})
+		}
+	}
+	t.primed = true
+	return events
+}
+
+// Missing returns the IDs of jobs last seen active that are absent from a
+// live (squeue) job list. A pending array range ("123_[1-100]") that left the
+// queue is missing only when none of the array's tasks are in it: otherwise
+// its tasks started and replace it.
+func (t *jobTracker) Missing(live []Job) []string {
+	present := make(map[string]bool, len(live))
+	for _, job := range live {
+		present[job.JobID] = true
+	}
+	var missing []string
+	for id, job := range t.jobs {
+		if present[id] || job.IsHistorical() {
+			continue
+		}
+		if parent, ok := arrayRangeParent(id); ok && len(matchingJobs(live, parent)) > 0 {
+			delete(t.jobs, id)
+			continue
+		}
+		missing = append(missing, id)
+	}
+	return missing
+}
+
+// arrayRangeParent returns the array job ID of a pending array range
+// ("123" for "123_[1-100]").
+func arrayRangeParent(id string) (string, bool) {
+	i := strings.Index(id, "_[")
+	if i <= 0 {
+		return "", false
+	}
+	return id[:i], true
+}
+
+// sacctIDs returns the IDs to ask sacct for the jobs returned by Missing:
+// sacct cannot be queried for an array range, only for its array job.
+func sacctIDs(ids []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if parent, ok := arrayRangeParent(id); ok {
+			id = parent
+		}
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Resolve applies sacct records for jobs returned by Missing. Jobs sacct no
+// longer knows about are forgotten without an event. An array range is
+// replaced by the tasks sacct knows, each reporting its transition from the
+// range's state.
+func (t *jobTracker) Resolve(ids []string, final []Job) []JobEvent {
+	byID := make(map[string]Job, len(final))
+	for _, job := range final {
+		byID[job.JobID] = job
+	}
+	now := time.Now()
+	var events []JobEvent
+	for _, id := range ids {
+		prev, known := t.jobs[id]
+		if !known {
+			continue
+		}
+		job, ok := byID[id]
+		if !ok {
+			delete(t.jobs, id)
+			if parent, isRange := arrayRangeParent(id); isRange {
+				for _, task := range matchingJobs(final, parent) {
+					if _, tracked := t.jobs[task.JobID]; tracked {
+						continue
+					}
+					t.jobs[task.JobID] = task
+					events = append(events, JobEvent{Job: task, PrevState: prev.State(), State: task.State(), Time: now})
+				}
+			}
+			continue
+		}
+		t.jobs[id] = job
+		if state := job.State(); state != prev.State() {
+			events = append(events, JobEvent{Job: job, PrevState: prev.State(), State: state, Time: now})
+		}
+	}
+	return events
+}
+
+// Job returns the last known record of a tracked job.
+func (t *jobTracker) Job(id string) (Job, bool) {
+	job, ok := t.jobs[id]
+	return job, ok
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestJobTrackerReportsTransitionsAfterPriming(t *testing.T) {
+	tr := newJobTracker()
+	if events := tr.Observe([]Job{{JobID: "1", Status: "PD"}}); len(events) != 0 {
+		t.Fatalf("expected priming observation to produce no events, got %d", len(events))
+	}
+
+	events := tr.Observe([]Job{{JobID: "1", Status: "R"}, {JobID: "2", Status: "PD"}, {JobID: "3", Status: "COMPLETED"}})
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events (transition + new pending job), got %d: %v", len(events), events)
+	}
+	if events[0].PrevState != "PD" || events[0].State != "R" {
+		t.Fatalf("unexpected transition %+v", events[0])
+	}
+	if events[1].Job.JobID != "2" || events[1].PrevState != "" {
+		t.Fatalf("expected new job event for 2, got %+v", events[1])
+	}
+}
+
+func TestJobTrackerResolvesVanishedJobs(t *testing.T) {
+	tr := newJobTracker()
+	tr.Observe([]Job{{JobID: "1", Status: "R"}, {JobID: "2", Status: "R"}, {JobID: "3_[1-4]", Status: "PD"}})
+
+	// The range left the queue for its first task.
+	missing := tr.Missing([]Job{{JobID: "2", Status: "R"}, {JobID: "3_1", Status: "R"}})
+	if len(missing) != 1 || missing[0] != "1" {
+		t.Fatalf("expected job 1 to be missing, got %v", missing)
+	}
+	if _, ok := tr.Job("3_[1-4]"); ok {
+		t.Fatalf("expected the range to give way to its tasks")
+	}
+
+	events := tr.Resolve(missing, []Job{{JobID: "1", Status: "FAILED", ExitCode: "1:0"}})
+	if len(events) != 1 || events[0].State != "F" || !events[0].Failed() {
+		t.Fatalf("expected a failed terminal event, got %v", events)
+	}
+	if again := tr.Missing([]Job{{JobID: "2", Status: "R"}}); len(again) != 0 {
+		t.Fatalf("expected resolved job to no longer be missing, got %v", again)
+	}
+}
+
+func TestJobTrackerResolvesArrayRangesThroughTheirTasks(t *testing.T) {
+	tr := newJobTracker()
+	tr.Observe([]Job{{JobID: "7_[1-2]", Status: "PD"}})
+
+	// Both tasks ran and finished between two polls.
+	missing := tr.Missing(nil)
+	if len(missing) != 1 || missing[0] != "7_[1-2]" {
+		t.Fatalf("expected the range to be missing, got %v", missing)
+	}
+	if ids := sacctIDs(append(missing, "7", "8")); len(ids) != 2 || ids[0] != "7" || ids[1] != "8" {
+		t.Fatalf("expected sacct to be asked for the array job, got %v", ids)
+	}
+	events := tr.Resolve(missing, []Job{{JobID: "7_1", Status: "COMPLETED"}, {JobID: "7_2", Status: "FAILED"}})
+	if len(events) != 2 || events[0].PrevState != "PD" || events[0].State != "CD" || events[1].State != "F" {
+		t.Fatalf("expected an event per task, got %v", events)
+	}
+	if _, ok := tr.Job("7_[1-2]"); ok {
+		t.Fatalf("expected the range to be replaced by its tasks")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Copying goes through OSC52, which terminals cap; excerpts too big to copy,
+// or to be attached to a ticket, are exported to a file instead.
+
+// osc52Limit is the most osc52CopyCmd copies.
+const osc52Limit = 100 * 1024
+
+// exportScope is what part of a pane an export writes.
+type exportScope int
+
+const (
+	exportPane      exportScope = iota // the lines the pane shows, filtered or not
+	exportSelection                    // the selected text
+	exportMatches                      // the lines matching the search
+)
+
+// exportPrompt is the path prompt of an export.
+type exportPrompt struct {
+	input     textinput.Model
+	pane      string
+	scope     exportScope
+	header    bool
+	overwrite string // path the user confirmed to overwrite
+	err       error
+}
+
+// openExport opens the export prompt for the focused pane.
+func (m *TailModel) openExport() tea.Cmd {
+	pane := m.focusedPane()
+	ti := textinput.New()
+	ti.CharLimit = 4096
+	ti.Width = m.searchInput.Width
+	ti.Prompt = ""
+	ti.TextStyle = lipgloss.NewStyle().Foreground(textStrong)
+	ti.Cursor.Style = lipgloss.NewStyle().Foreground(highlight)
+	ti.SetValue(m.defaultExportPath(pane))
+	ti.CursorEnd()
+	m.export = &exportPrompt{input: ti, pane: pane, header: true}
+	if m.selectedText() != "" {
+		m.export.scope = exportSelection
+	}
+	m.recalculateLayout()
+	return m.export.input.Focus()
+}
+
+func (m *TailModel) closeExport() {
+	m.export = nil
+	m.recalculateLayout()
+}
+
+// defaultExportPath names the excerpt of a pane after its log, in the
+// working directory.
+func (m TailModel) defaultExportPath(pane string) string {
+	path := m.panePath(pane)
+	if pane == "merged" || path == "" {
+		return fmt.Sprintf("job-%s-%s-excerpt.txt", m.paneJobID(pane), pane)
+	}
+	return filepath.Base(path) + "-excerpt.txt"
+}
+
+// panePath returns the log a pane shows.
+func (m TailModel) panePath(pane string) string {
+	switch pane {
+	case "stdout":
+		return m.stdoutPath
+	case "stderr":
+		return m.stderrPath
+	}
+	return m.mergedPath()
+}
+
+// paneJobID returns the job whose log a pane shows.
+func (m TailModel) paneJobID(pane string) string {
+	if m.compare != nil && pane == "stderr" {
+		return m.compare.jobs[1]
+	}
+	return m.jobID
+}
+
+// exportScopes returns the parts of the pane that can be exported.
+func (m TailModel) exportScopes() []exportScope {
+	scopes := []exportScope{exportPane}
+	if m.selectedText() != "" {
+		scopes = append(scopes, exportSelection)
+	}
+	if m.lastSearch != "" && len(*m.paneRefs(m.export.pane).matches) > 0 {
+		scopes = append(scopes, exportMatches)
+	}
+	return scopes
+}
+
+// nextExportScope moves on to the next part of the pane that can be
+// exported.
+func (m *TailModel) nextExportScope() {
+	scopes := m.exportScopes()
+	next := scopes[0]
+	for i, s := range scopes {
+		if s == m.export.scope && i+1 < len(scopes) {
+			next = scopes[i+1]
+		}
+	}
+	m.export.scope = next
+}
+
+// excerpt returns the lines an export writes and what they are.
+func (m *TailModel) excerpt() ([]string, string) {
+	pane := m.export.pane
+	switch m.export.scope {
+	case exportSelection:
+		return strings.Split(m.selectedText(), "\n"), "selection"
+	case exportMatches:
+		shown := m.displayLines(pane)
+		var lines []string
+		for _, i := range *m.paneRefs(pane).matches {
+			lines = append(lines, stripANSI(shown[i]))
+		}
+		return lines, fmt.Sprintf("lines matching %q", m.lastSearch)
+	}
+	lines := make([]string, 0, len(m.displayLines(pane)))
+	for _, line := range m.displayLines(pane) {
+		lines = append(lines, stripANSI(line))
+	}
+	if f := m.paneRefs(pane).filter; f.active() {
+		return lines, "filtered view (grep: " + f.String() + ")"
+	}
+	return lines, "whole pane"
+}
+
+// exportHeader describes the job and log an excerpt comes from.
+func (m TailModel) exportHeader(what string, count int) []string {
+	id := m.paneJobID(m.export.pane)
+	header := []string{"# Job:      " + id}
+	for _, j := range m.jobs {
+		if j.JobID != id {
+			continue
+		}
+		if j.Name != "" {
+			header[0] += " (" + j.Name + ")"
+		}
+		header = append(header, "# State:    "+j.Status)
+		if j.NodeList != "" {
+			header = append(header, "# Nodes:    "+j.NodeList)
+		}
+		break
+	}
+	return append(header,
+		"# Log:      "+m.panePath(m.export.pane),
+		fmt.Sprintf("# Excerpt:  %s, %d lines", what, count),
+		"# Exported: "+time.Now().Format("2006-01-02 15:04:05"),
+		"",
+	)
+}
+
+// saveExport writes the excerpt. An existing file is only replaced once the
+// user confirms it with a second Enter.
+func (m *TailModel) saveExport() error {
+	path := expandHomePath(m.export.input.Value())
+	if path == "" {
+		return errors.New("no path given")
+	}
+	lines, what := m.excerpt()
+	count := len(lines)
+	if m.export.header {
+		lines = append(m.exportHeader(what, count), lines...)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if m.export.overwrite == path {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		m.export.overwrite = path
+		return fmt.Errorf("%s exists; %s again to overwrite it", path, dialogKeys.Confirm.Help().Key)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	m.notice = fmt.Sprintf("saved %d lines to %s", count, filepath.Base(path))
+	return nil
+}
+
+// updateExport handles the keys of the export prompt.
+func (m TailModel) updateExport(msg tea.KeyMsg) (TailModel, tea.Cmd) {
+	var cmd tea.Cmd
+	switch {
+	case key.Matches(msg, dialogKeys.Confirm):
+		if err := m.saveExport(); err != nil {
+			m.export.err = err
+			return m, nil
+		}
+		m.closeExport()
+		return m, nil
+	case key.Matches(msg, dialogKeys.Back):
+		m.closeExport()
+		return m, nil
+	case key.Matches(msg, dialogKeys.NextField):
+		m.nextExportScope()
+	case key.Matches(msg, dialogKeys.ExportHeader):
+		m.export.header = !m.export.header
+	default:
+		m.export.input, cmd = m.export.input.Update(msg)
+		m.export.overwrite = ""
+	}
+	m.export.err = nil
+	return m, cmd
+}
+
+func (m TailModel) renderExportOverlay(content string) string {
+	lines, what := m.excerpt()
+	header := "off"
+	if m.export.header {
+		header = "on"
+	}
+	var b strings.Builder
+	b.WriteString("\n" + tailKeys.Export.Help().Key + " Export to: ")
+	b.WriteString(m.export.input.View())
+	b.WriteString("\n")
+	if m.export.err != nil {
+		b.WriteString(fmt.Sprintf("⚠ %v", m.export.err))
+	} else {
+		b.WriteString(hints(" · ",
+			hints(", ", hint("save", dialogKeys.Confirm), hint("cancel", dialogKeys.Back)),
+			hint(fmt.Sprintf("what: %s (%d lines)", what, len(lines)), dialogKeys.NextField),
+			hint("job header: "+header, dialogKeys.ExportHeader)))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(content)
+	return b.String()
+}
+
+// copyTooLarge reports copies OSC52 would truncate.
+func (m *TailModel) copyTooLarge(text string) bool {
+	if len(text) <= osc52Limit {
+		return false
+	}
+	m.notice = fmt.Sprintf("%d KiB is too much to copy", len(text)/1024)
+	if tailKeys.Export.Enabled() {
+		m.notice += fmt.Sprintf("; press %s to export", tailKeys.Export.Help().Key)
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTailExportWritesAnExcerptWithAJobHeader(t *testing.T) {
+	m := NewTailModel("42", "/logs/train.out", "/logs/train.err", 100, 20, TailModeStdout)
+	m.jobs = []Job{{JobID: "42", Name: "train", Status: "FAILED", NodeList: "gpu[01-02]"}}
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	typeText := func(text string) {
+		for _, r := range text {
+			update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+	update(tailStartMsg{pane: "stdout", initialLines: []string{"step 1 loss=2.0", "\x1b[31mnan detected\x1b[0m", "step 2 loss=nan"}})
+	m.lastSearch = "nan"
+	m.refreshViewportContent()
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	if !m.InOverlay() || m.export.input.Value() != "train.out-excerpt.txt" {
+		t.Fatalf("expected the export prompt with a default path")
+	}
+	update(tea.KeyMsg{Type: tea.KeyTab})
+	if m.export.scope != exportMatches {
+		t.Fatalf("expected Tab to pick the search matches")
+	}
+	path := filepath.Join(t.TempDir(), "excerpt.txt")
+	update(tea.KeyMsg{Type: tea.KeyCtrlU})
+	typeText(path)
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.InOverlay() || !strings.Contains(m.View(), "saved 2 lines to excerpt.txt") {
+		t.Fatalf("expected the prompt to close with a notice, err %v", m.export)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{"# Job:      42 (train)\n", "# State:    FAILED\n", "# Nodes:    gpu[01-02]\n", "# Log:      /logs/train.out\n", "# Excerpt:  lines matching \"nan\", 2 lines\n", "\nnan detected\nstep 2 loss=nan\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the excerpt:\n%s", want, got)
+		}
+	}
+
+	// An existing file is only replaced when confirmed.
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	update(tea.KeyMsg{Type: tea.KeyCtrlU})
+	typeText(path)
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}, Alt: true})
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.export == nil || m.export.err == nil {
+		t.Fatalf("expected the export to stop at the existing file")
+	}
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	if data, _ := os.ReadFile(path); string(data) != "step 1 loss=2.0\nnan detected\nstep 2 loss=nan\n" {
+		t.Fatalf("expected the whole pane without header, got %q", data)
+	}
+}
+
+func TestTailCopyAllRefusesWhatOSC52WouldTruncate(t *testing.T) {
+	m := NewTailModel("1", "/logs/job.out", "", 100, 20, TailModeStdout)
+	long := strings.Repeat("x", 1000)
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = long
+	}
+	model, _ := m.Update(tailStartMsg{pane: "stdout", initialLines: lines})
+	model, cmd := model.(TailModel).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'Y'}})
+	m = model.(TailModel)
+	if cmd != nil || !strings.Contains(m.notice, "press w to export") {
+		t.Fatalf("expected a notice instead of a truncated copy, got %q", m.notice)
+	}
+}
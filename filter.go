@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Grep mode: a pane can show only the lines matching (or not matching) a set
+// of patterns, with context lines around matches like `grep -C`. The pane
+// keeps its full window of lines; the filter derives what is displayed, so
+// following and scrollback keep working underneath.
+
+const (
+	filterSeparator  = "--"
+	maxFilterContext = 20
+)
+
+type filterPattern struct {
+	expr    string
+	exclude bool
+	re      *regexp.Regexp
+}
+
+// paneFilter is the filter of one pane and the lines it currently displays.
+// A line is displayed when it matches any include pattern (or there are none)
+// and no exclude pattern.
+type paneFilter struct {
+	patterns []filterPattern
+	context  int
+
+	// Displayed lines and, for each, its index in the pane's lines (-1 for
+	// separators between non-adjacent groups).
+	shown []string
+	raw   []int
+
+	lastRaw   int // index of the last displayed line, -1 if none
+	afterLeft int // context lines still to show after the last match
+}
+
+func newPaneFilter() *paneFilter {
+	return &paneFilter{lastRaw: -1}
+}
+
+func (f *paneFilter) active() bool {
+	return f != nil && len(f.patterns) > 0
+}
+
+// add parses and adds a pattern: "expr" to include, "!expr" to exclude.
+// Patterns are regular expressions; opts decides case and whole words.
+func (f *paneFilter) add(pattern string, opts searchOptions) error {
+	exclude := strings.HasPrefix(pattern, "!")
+	expr := strings.TrimPrefix(pattern, "!")
+	if expr == "" {
+		return fmt.Errorf("empty filter pattern")
+	}
+	opts.regex = true
+	re, err := compileSearch(expr, opts)
+	if err != nil {
+		return err
+	}
+	f.patterns = append(f.patterns, filterPattern{expr: expr, exclude: exclude, re: re})
+	return nil
+}
+
+func (f *paneFilter) clear() {
+	f.patterns = nil
+	f.context = 0
+}
+
+// matches reports whether a line passes the patterns (context aside).
+func (f *paneFilter) matches(line string) bool {
+	line = stripANSI(line)
+	included, hasInclude := false, false
+	for _, p := range f.patterns {
+		if p.exclude {
+			if p.re.MatchString(line) {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if !included && p.re.MatchString(line) {
+			included = true
+		}
+	}
+	return included || !hasInclude
+}
+
+// String describes the filter for the pane title, e.g. "loss= !debug ±2".
+func (f *paneFilter) String() string {
+	parts := make([]string, 0, len(f.patterns)+1)
+	for _, p := range f.patterns {
+		if p.exclude {
+			parts = append(parts, "!"+p.expr)
+		} else {
+			parts = append(parts, p.expr)
+		}
+	}
+	if f.context > 0 {
+		parts = append(parts, fmt.Sprintf("±%d", f.context))
+	}
+	return strings.Join(parts, " ")
+}
+
+// rebuild recomputes the displayed lines from all of the pane's lines.
+func (f *paneFilter) rebuild(lines []string) {
+	f.shown, f.raw = f.shown[:0], f.raw[:0]
+	f.lastRaw, f.afterLeft = -1, 0
+	f.update(lines, 0, len(lines))
+}
+
+// update follows the pane's lines after removed lines were dropped from the
+// front and added lines appended. It returns how many displayed lines were
+// dropped from the front and the displayed lines appended.
+func (f *paneFilter) update(lines []string, removed, added int) (int, []string) {
+	dropped := 0
+	if removed > 0 {
+		for i := range f.raw {
+			if f.raw[i] >= 0 {
+				f.raw[i] -= removed
+			}
+		}
+		f.lastRaw -= removed
+		// Drop lines that left the pane and a separator left leading.
+		for dropped < len(f.raw) && f.raw[dropped] < 0 {
+			dropped++
+		}
+		f.shown, f.raw = f.shown[dropped:], f.raw[dropped:]
+		if f.lastRaw < -1 {
+			f.lastRaw = -1
+		}
+	}
+
+	first := len(f.shown)
+	from := len(lines) - added
+	if from < 0 {
+		from = 0
+	}
+	for i := from; i < len(lines); i++ {
+		if f.matches(lines[i]) {
+			start := i - f.context
+			if start <= f.lastRaw {
+				start = f.lastRaw + 1
+			}
+			if start < 0 {
+				start = 0
+			}
+			if f.context > 0 && len(f.shown) > 0 && start > f.lastRaw+1 {
+				f.show(filterSeparator, -1)
+			}
+			for j := start; j <= i; j++ {
+				f.show(lines[j], j)
+			}
+			f.afterLeft = f.context
+		} else if f.afterLeft > 0 && i == f.lastRaw+1 {
+			f.show(lines[i], i)
+			f.afterLeft--
+		}
+	}
+	return dropped, f.shown[first:]
+}
+
+func (f *paneFilter) show(text string, raw int) {
+	f.shown = append(f.shown, text)
+	f.raw = append(f.raw, raw)
+	if raw >= 0 {
+		f.lastRaw = raw
+	}
+}
+
+// displayIndex returns the displayed line at or after a line of the pane.
+func (f *paneFilter) displayIndex(raw int) int {
+	for i, r := range f.raw {
+		if r >= raw {
+			return i
+		}
+	}
+	return len(f.raw)
+}
+
+// displayLines returns the lines a pane displays.
+func (m *TailModel) displayLines(pane string) []string {
+	if d, side := m.paneDiff(pane); d != nil {
+		return d.shown[side]
+	}
+	refs := m.paneRefs(pane)
+	if refs.filter.active() {
+		return refs.filter.shown
+	}
+	return *refs.lines
+}
+
+// displayIndex maps a line of a pane to the line displayed for it.
+func (m *TailModel) displayIndex(pane string, raw int) int {
+	if d, side := m.paneDiff(pane); d != nil {
+		return d.displayIndex(side, raw)
+	}
+	if f := m.paneRefs(pane).filter; f.active() {
+		return f.displayIndex(raw)
+	}
+	return raw
+}
+
+// rawIndex maps a displayed line back to the pane's lines (-1 for
+// separators and diff gaps).
+func (m *TailModel) rawIndex(pane string, shown int) int {
+	if d, side := m.paneDiff(pane); d != nil {
+		return d.raw[side][shown]
+	}
+	if f := m.paneRefs(pane).filter; f.active() {
+		return f.raw[shown]
+	}
+	return shown
+}
+
+// applyFilterInput handles the filter prompt: a pattern is added to the
+// focused pane's filter, an empty input removes the filter.
+func (m *TailModel) applyFilterInput(input string) error {
+	pane := m.focusedPane()
+	f := m.paneRefs(pane).filter
+	input = strings.TrimSpace(input)
+	if input == "" {
+		f.clear()
+	} else if err := f.add(input, m.searchOpts); err != nil {
+		return err
+	}
+	m.refreshPaneContent(pane)
+	return nil
+}
+
+// changeFilterContext grows or shrinks the context shown around matches.
+func (m *TailModel) changeFilterContext(delta int) {
+	pane := m.focusedPane()
+	f := m.paneRefs(pane).filter
+	if !f.active() {
+		return
+	}
+	f.context += delta
+	if f.context < 0 {
+		f.context = 0
+	}
+	if f.context > maxFilterContext {
+		f.context = maxFilterContext
+	}
+	m.refreshPaneContent(pane)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPaneFilterContextAndSeparators(t *testing.T) {
+	lines := []string{"a", "b", "match 1", "c", "d", "e", "f", "match 2", "g"}
+	f := newPaneFilter()
+	if err := f.add("match", searchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f.context = 1
+	f.rebuild(lines)
+
+	want := []string{"b", "match 1", "c", "--", "f", "match 2", "g"}
+	if !reflect.DeepEqual(f.shown, want) {
+		t.Fatalf("shown = %q, want %q", f.shown, want)
+	}
+	if !reflect.DeepEqual(f.raw, []int{1, 2, 3, -1, 6, 7, 8}) {
+		t.Fatalf("raw = %v", f.raw)
+	}
+
+	// The oldest lines leave the pane: the group they started is cut and
+	// the separator left leading is dropped.
+	lines = append(lines[4:], "h", "i", "match 3")
+	dropped, added := f.update(lines, 4, 3)
+	if dropped != 4 || !reflect.DeepEqual(added, []string{"--", "i", "match 3"}) {
+		t.Fatalf("update dropped %d, added %q", dropped, added)
+	}
+	if !reflect.DeepEqual(f.shown, []string{"f", "match 2", "g", "--", "i", "match 3"}) {
+		t.Fatalf("shown after update = %q", f.shown)
+	}
+}
+
+func TestPaneFilterExcludePatterns(t *testing.T) {
+	f := newPaneFilter()
+	for _, p := range []string{"loss", "!debug"} {
+		if err := f.add(p, searchOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.rebuild([]string{"loss=1", "debug loss=2", "step 3", "LOSS=4"})
+	if !reflect.DeepEqual(f.shown, []string{"loss=1", "LOSS=4"}) {
+		t.Fatalf("shown = %q", f.shown)
+	}
+	if got := f.String(); got != "loss !debug" {
+		t.Fatalf("String() = %q", got)
+	}
+	if err := f.add("!", searchOptions{}); err == nil {
+		t.Fatalf("expected an empty exclude pattern to be rejected")
+	}
+}
+
+func TestTailFilterFollowsAppendedLines(t *testing.T) {
+	m := NewTailModel("1", "", "", 80, 14, TailModeStdout)
+	for i := 0; i < 20; i++ {
+		m.stdoutLines = append(m.stdoutLines, fmt.Sprintf("step %d", i))
+	}
+	m.refreshStdoutContent()
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'&'}})
+	m = model.(TailModel)
+	m.searchInput.SetValue(`step 1\d`)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(TailModel)
+	if m.inSearchMode || len(m.wrappedStdout) != 10 {
+		t.Fatalf("expected 10 filtered lines, got %d", len(m.wrappedStdout))
+	}
+	if !strings.Contains(m.View(), `[grep: step 1\d]`) {
+		t.Fatalf("expected the filter in the pane header")
+	}
+
+	m.appendLogLine("stdout", &m.stdoutLines, &m.wrappedStdout, m.stdoutBuilder, &m.stdoutView, "noise", "step 15 again")
+	if got := m.displayLines("stdout"); len(got) != 11 || got[10] != "step 15 again" {
+		t.Fatalf("expected only the matching appended line, got %q", got)
+	}
+	if len(m.wrappedStdout) != 11 {
+		t.Fatalf("wrapped lines out of step with the filter: %d", len(m.wrappedStdout))
+	}
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'&'}})
+	m = model.(TailModel)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(TailModel)
+	if m.stdoutFilter.active() || len(m.wrappedStdout) != 22 {
+		t.Fatalf("expected an empty pattern to clear the filter")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const followReadChunk = 64 << 10
+
+var (
+	// followPollInterval is how often a log is checked when inotify is not
+	// usable (network filesystems, watch limit reached, missing directory).
+	followPollInterval = time.Second
+	// followRecheckInterval re-checks the log even with inotify, in case an
+	// event was missed or the file was replaced in an unwatched way.
+	followRecheckInterval = 5 * time.Second
+)
+
+// logFollower follows a growing log in-process, like `tail -F`: it waits for
+// the file to appear, notices truncation and replacement (rotation), and
+// hands out complete lines in batches, so chatty logs cost one UI update per
+// batch instead of one per line. An unterminated line that a progress bar
+// keeps redrawing is handed out too, as the live line.
+type logFollower struct {
+	path    string
+	polling bool
+
+	// Owned by the follower goroutine.
+	file    *os.File
+	offset  int64
+	partial []byte
+	readErr error
+
+	mu      sync.Mutex
+	pending []string
+	dropped int
+	live    string // the unterminated line, when it has carriage returns
+	liveSet bool   // live changed since the last Next
+
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// startLogFollower follows path from offset (usually the number of bytes
+// already shown). Local filesystems are watched with inotify; network
+// filesystems, where writes from other nodes raise no events, are polled.
+func startLogFollower(path string, offset int64) *logFollower {
+	return newLogFollower(path, offset, isNetworkFS(filepath.Dir(path)))
+}
+
+func newLogFollower(path string, offset int64, polling bool) *logFollower {
+	f := &logFollower{
+		path:    filepath.Clean(path),
+		polling: polling,
+		offset:  offset,
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var watcher *fsnotify.Watcher
+	if !polling {
+		watcher = f.watch()
+	}
+	go f.run(watcher)
+	return f
+}
+
+// watch watches the log's directory (so creation and rotation are seen too).
+// It returns nil, switching to polling, when inotify is not available.
+func (f *logFollower) watch() *fsnotify.Watcher {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		f.polling = true
+		return nil
+	}
+	if err := watcher.Add(filepath.Dir(f.path)); err != nil {
+		watcher.Close()
+		f.polling = true
+		return nil
+	}
+	return watcher
+}
+
+func (f *logFollower) run(watcher *fsnotify.Watcher) {
+	defer close(f.done)
+	defer func() {
+		if f.file != nil {
+			f.file.Close()
+		}
+	}()
+
+	var events chan fsnotify.Event
+	var watchErrs chan error
+	interval := followPollInterval
+	if watcher != nil {
+		defer watcher.Close()
+		events, watchErrs = watcher.Events, watcher.Errors
+		interval = followRecheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	f.check()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events, watchErrs = nil, nil
+				ticker.Reset(followPollInterval)
+			} else if filepath.Clean(ev.Name) != f.path {
+				// Another file in the same directory.
+				continue
+			}
+			f.check()
+		case <-watchErrs:
+			// Events may have been lost (queue overflow); check anyway.
+			f.check()
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+// check opens the log if needed, reads what was appended and handles
+// truncation and replacement.
+func (f *logFollower) check() {
+	if f.file == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			// Not there yet (job pending) or rotated away: wait.
+			return
+		}
+		f.file = file
+	}
+
+	info, err := f.file.Stat()
+	if err != nil {
+		// E.g. a stale NFS handle: reopen by name on the next check.
+		f.reportReadErr(err)
+		f.file.Close()
+		f.file = nil
+		return
+	}
+	if info.Size() < f.offset {
+		f.offset = 0
+		f.partial = nil
+		f.setLive("")
+		f.push("⚠ Log truncated, following from the start")
+	}
+	f.readAvailable()
+
+	// A new file under the same name (rotation, or deleted and recreated):
+	// finish the old one, then switch over.
+	current, err := os.Stat(f.path)
+	if err != nil || os.SameFile(current, info) {
+		return
+	}
+	f.readAvailable()
+	if len(f.partial) > 0 {
+		f.setLive("")
+		f.push(string(f.partial))
+		f.partial = nil
+	}
+	f.file.Close()
+	f.file = nil
+	f.offset = 0
+	f.push("⚠ Log replaced, following the new file")
+	f.check()
+}
+
+func (f *logFollower) readAvailable() {
+	buf := make([]byte, followReadChunk)
+	for {
+		n, err := f.file.ReadAt(buf, f.offset)
+		if n > 0 {
+			f.offset += int64(n)
+			f.consume(buf[:n])
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				f.reportReadErr(err)
+			}
+			return
+		}
+		f.readErr = nil
+	}
+}
+
+// consume splits data into complete lines. An unterminated last line is kept
+// until the rest of it arrives; when it is a progress bar redrawn with
+// carriage returns, it is collapsed as it grows and shown as the live line.
+func (f *logFollower) consume(data []byte) {
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			f.partial = append(f.partial, data...)
+			break
+		}
+		line := data[:i]
+		if len(f.partial) > 0 {
+			line = append(f.partial, line...)
+			f.partial = nil
+		}
+		lines = append(lines, string(bytes.TrimRight(line, "\r")))
+		data = data[i+1:]
+	}
+	f.partial = compactCR(f.partial)
+	live := ""
+	if bytes.IndexByte(f.partial, '\r') >= 0 {
+		live = collapseCR(string(f.partial))
+	}
+	f.setLive(live)
+	f.push(lines...)
+}
+
+// setLive updates the live line.
+func (f *logFollower) setLive(line string) {
+	f.mu.Lock()
+	changed := line != f.live
+	if changed {
+		f.live, f.liveSet = line, true
+	}
+	f.mu.Unlock()
+	if changed {
+		f.wake()
+	}
+}
+
+// reportReadErr shows a read error once, not on every retry.
+func (f *logFollower) reportReadErr(err error) {
+	if f.readErr != nil && f.readErr.Error() == err.Error() {
+		return
+	}
+	f.readErr = err
+	f.push(fmt.Sprintf("Error reading: %v", err))
+}
+
+// push queues lines for the UI. When the UI falls behind, only the newest
+// MaxLogLines are kept since the pane could not show more anyway.
+func (f *logFollower) push(lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	f.mu.Lock()
+	f.pending = append(f.pending, lines...)
+	if MaxLogLines > 0 && len(f.pending) > MaxLogLines {
+		f.dropped += len(f.pending) - MaxLogLines
+		f.pending = append(f.pending[:0], f.pending[len(f.pending)-MaxLogLines:]...)
+	}
+	f.mu.Unlock()
+	f.wake()
+}
+
+func (f *logFollower) wake() {
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next blocks until new lines are available or the live line changed, and
+// returns all the lines and the live line ("" when there is none). It
+// returns false once the follower is closed.
+func (f *logFollower) Next() ([]string, string, bool) {
+	for {
+		f.mu.Lock()
+		lines, dropped, live, liveSet := f.pending, f.dropped, f.live, f.liveSet
+		f.pending, f.dropped, f.liveSet = nil, 0, false
+		f.mu.Unlock()
+		if dropped > 0 {
+			lines = append([]string{fmt.Sprintf("… %d lines skipped", dropped)}, lines...)
+		}
+		if len(lines) > 0 || liveSet {
+			return lines, live, true
+		}
+
+		select {
+		case <-f.notify:
+		case <-f.stop:
+			return nil, "", false
+		}
+	}
+}
+
+// Close stops following and waits for the follower goroutine to exit.
+func (f *logFollower) Close() {
+	if f == nil {
+		return
+	}
+	f.once.Do(func() { close(f.stop) })
+	<-f.done
+}
@@ -0,0 +1,30 @@
+package main
+
+import "syscall"
+
+// Filesystem magic numbers (statfs f_type) of network and cluster
+// filesystems, where inotify does not see writes made on other nodes.
+var networkFSMagic = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+	0x19830326: "beegfs",
+	0xaad7aaea: "panfs",
+	0x00c36400: "ceph",
+	0x5346414f: "afs",
+	0x65735546: "fuse",
+}
+
+// isNetworkFS reports whether path lives on a filesystem that has to be
+// polled instead of watched.
+func isNetworkFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	_, ok := networkFSMagic[uint32(st.Type)]
+	return ok
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+// isNetworkFS reports whether path lives on a filesystem that has to be
+// polled instead of watched. Only detected on Linux, where cluster
+// filesystems are mounted; elsewhere inotify-like events are trusted and the
+// periodic recheck covers the rest.
+func isNetworkFS(path string) bool {
+	return false
+}
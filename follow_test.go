@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collectLines reads batches from a follower until want lines arrived.
+func collectLines(t *testing.T, f *logFollower, want int) []string {
+	t.Helper()
+	var got []string
+	deadline := time.After(5 * time.Second)
+	for len(got) < want {
+		batch := make(chan []string, 1)
+		go func() {
+			lines, _, _ := f.Next()
+			batch <- lines
+		}()
+		select {
+		case lines := <-batch:
+			got = append(got, lines...)
+		case <-deadline:
+			t.Fatalf("timed out after %d of %d lines: %q", len(got), want, got)
+		}
+	}
+	return got
+}
+
+func appendToFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	file.Close()
+}
+
+func forEachFollowMode(t *testing.T, fn func(t *testing.T, polling bool)) {
+	prev := followPollInterval
+	followPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { followPollInterval = prev })
+
+	t.Run("inotify", func(t *testing.T) { fn(t, false) })
+	t.Run("polling", func(t *testing.T) { fn(t, true) })
+}
+
+func TestLogFollowerAppendsFromOffsetInBatches(t *testing.T) {
+	forEachFollowMode(t, func(t *testing.T, polling bool) {
+		path := filepath.Join(t.TempDir(), "job.out")
+		appendToFile(t, path, "already shown\n")
+
+		f := newLogFollower(path, int64(len("already shown\n")), polling)
+		defer f.Close()
+
+		appendToFile(t, path, "one\ntwo\r\nthr")
+		appendToFile(t, path, "ee\n")
+		if got := collectLines(t, f, 3); !reflect.DeepEqual(got, []string{"one", "two", "three"}) {
+			t.Fatalf("got %q", got)
+		}
+	})
+}
+
+func TestLogFollowerWaitsForFileAndDetectsTruncation(t *testing.T) {
+	forEachFollowMode(t, func(t *testing.T, polling bool) {
+		path := filepath.Join(t.TempDir(), "job.out")
+		f := newLogFollower(path, 0, polling)
+		defer f.Close()
+
+		appendToFile(t, path, "created\nsecond\n")
+		if got := collectLines(t, f, 2); !reflect.DeepEqual(got, []string{"created", "second"}) {
+			t.Fatalf("got %q", got)
+		}
+
+		if err := os.WriteFile(path, []byte("new\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got := collectLines(t, f, 2)
+		if got[len(got)-1] != "new" || got[0] != "⚠ Log truncated, following from the start" {
+			t.Fatalf("expected truncation notice and new content, got %q", got)
+		}
+	})
+}
+
+func TestLogFollowerFollowsRotation(t *testing.T) {
+	forEachFollowMode(t, func(t *testing.T, polling bool) {
+		path := filepath.Join(t.TempDir(), "train.log")
+		appendToFile(t, path, "")
+		f := newLogFollower(path, 0, polling)
+		defer f.Close()
+
+		appendToFile(t, path, "before\n")
+		collectLines(t, f, 1)
+
+		// logrotate: rename, keep writing to the old file briefly, recreate.
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatal(err)
+		}
+		appendToFile(t, path+".1", "late write\n")
+		appendToFile(t, path, "after\n")
+
+		got := collectLines(t, f, 3)
+		want := []string{"late write", "⚠ Log replaced, following the new file", "after"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestLogFollowerKeepsNewestLinesWhenUIFallsBehind(t *testing.T) {
+	// No goroutine: only the hand-off between follower and UI is tested.
+	f := &logFollower{notify: make(chan struct{}, 1), stop: make(chan struct{})}
+
+	lines := make([]string, MaxLogLines+10)
+	for i := range lines {
+		lines[i] = "x"
+	}
+	f.push(lines...)
+	got, _, ok := f.Next()
+	if !ok || len(got) != MaxLogLines+1 || got[0] != "… 10 lines skipped" {
+		t.Fatalf("expected a skip notice plus %d lines, got %d lines starting %q", MaxLogLines, len(got), got[0])
+	}
+}
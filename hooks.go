@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHookTimeout     = 10 * time.Second
+	defaultHookRetries     = 3
+	defaultHookBackoff     = 2 * time.Second
+	maxHookBackoff         = time.Minute
+	defaultHookPerMinute   = 20
+	defaultHookBurst       = 5
+	maxJobsPerHookPayload  = 50
+	hookQueueSize          = 4096
+	hookEventStateChanged  = "job_state_changed"
+	hookEventStatesBatched = "job_states_changed"
+	hookEventStalled       = "job_stalled"
+	hookCommandShell       = "/bin/sh"
+	hookEnvPrefix          = "SLURM_DASHBOARD_"
+	hookDefaultContentType = "application/json"
+	hookUserAgent          = "slurm-dashboard/" + version
+)
+
+// HookConfig is one entry of the "hooks" list in the config file. A hook
+// fires when a job transition matches all of its filters, and either POSTs a
+// JSON payload to URL or runs Command through /bin/sh with the job fields in
+// SLURM_DASHBOARD_* environment variables (and the payload on stdin).
+type HookConfig struct {
+	Name string `json:"name"`
+
+	// Filters. States accepts short codes or full names ("F", "FAILED");
+	// empty means any terminal state, "*" means every transition. JobName and
+	// Partition are shell globs.
+	States    []string `json:"states"`
+	JobName   string   `json:"job_name"`
+	Partition string   `json:"partition"`
+
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Command string            `json:"command"`
+
+	Timeout string `json:"timeout"` // per attempt, default 10s
+	Retries *int   `json:"retries"` // default 3
+	Backoff string `json:"backoff"` // first retry delay, doubled per attempt, default 2s
+
+	// Rate limit: at most PerMinute deliveries with bursts of Burst. Events
+	// over the limit are coalesced into a single batched delivery.
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+func (h HookConfig) label() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	if h.URL != "" {
+		return h.URL
+	}
+	return h.Command
+}
+
+func (h HookConfig) validate() error {
+	if (h.URL == "") == (h.Command == "") {
+		return errors.New("exactly one of url or command must be set")
+	}
+	for _, d := range []string{h.Timeout, h.Backoff} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %q: %w", d, err)
+		}
+	}
+	for _, glob := range []string{h.JobName, h.Partition} {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", glob, err)
+		}
+	}
+	if h.Retries != nil && *h.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	if h.PerMinute < 0 || h.Burst < 0 {
+		return errors.New("per_minute and burst must not be negative")
+	}
+	return nil
+}
+
+// Matches reports whether the hook is interested in a transition.
+func (h HookConfig) Matches(ev JobEvent) bool {
+	if !h.matchesState(ev) {
+		return false
+	}
+	if h.JobName != "" {
+		if ok, _ := filepath.Match(h.JobName, ev.Job.Name); !ok {
+			return false
+		}
+	}
+	if h.Partition != "" {
+		if ok, _ := filepath.Match(h.Partition, ev.Job.Partition); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (h HookConfig) matchesState(ev JobEvent) bool {
+	if len(h.States) == 0 {
+		return ev.IsTerminal()
+	}
+	for _, s := range h.States {
+		if s == "*" || StateCode(s) == ev.State {
+			return true
+		}
+	}
+	return false
+}
+
+type hookJob struct {
+	JobID     string `json:"job_id"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	State     string `json:"state"`
+	PrevState string `json:"prev_state"`
+	Status    string `json:"status"`
+	Partition string `json:"partition"`
+	Elapsed   string `json:"elapsed"`
+	Nodes     string `json:"nodes"`
+	NodeList  string `json:"node_list"`
+	ExitCode  string `json:"exit_code"`
+	Time      string `json:"time"`
+	Quiet     int    `json:"quiet_seconds,omitempty"` // stalled jobs: seconds without output
+}
+
+// hookPayload is the JSON body sent to URL hooks and written to the stdin of
+// command hooks. Text is a human readable summary so chat webhooks (Slack,
+// Mattermost, ...) can consume the payload unchanged.
+type hookPayload struct {
+	Event string    `json:"event"`
+	Hook  string    `json:"hook,omitempty"`
+	Text  string    `json:"text"`
+	Count int       `json:"count"`
+	Jobs  []hookJob `json:"jobs"`
+}
+
+func newHookJob(ev JobEvent) hookJob {
+	return hookJob{
+		JobID:     ev.Job.JobID,
+		Name:      ev.Job.Name,
+		User:      ev.Job.User,
+		State:     ev.State,
+		PrevState: ev.PrevState,
+		Status:    ev.Job.Status,
+		Partition: ev.Job.Partition,
+		Elapsed:   ev.Job.Time,
+		Nodes:     ev.Job.Nodes,
+		NodeList:  ev.Job.NodeList,
+		ExitCode:  ev.Job.ExitCode,
+		Time:      ev.Time.Format(time.RFC3339),
+		Quiet:     int(ev.Quiet.Seconds()),
+	}
+}
+
+func buildHookPayload(name string, events []JobEvent) hookPayload {
+	p := hookPayload{Event: hookEventStateChanged, Hook: name, Count: len(events)}
+	for i, ev := range events {
+		if i >= maxJobsPerHookPayload {
+			break
+		}
+		p.Jobs = append(p.Jobs, newHookJob(ev))
+	}
+	if len(events) == 1 {
+		p.Text = events[0].String()
+		if events[0].State == stateStalled {
+			p.Event = hookEventStalled
+		}
+		return p
+	}
+
+	p.Event = hookEventStatesBatched
+	counts := map[string]int{}
+	for _, ev := range events {
+		counts[ev.State]++
+	}
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+	}
+	p.Text = fmt.Sprintf("%d jobs changed state: %s", len(events), strings.Join(parts, ", "))
+	return p
+}
+
+// hookEnv returns the environment for command hooks. For batched deliveries
+// the job variables describe the first job; the full list is on stdin.
+func hookEnv(p hookPayload) []string {
+	env := os.Environ()
+	env = append(env,
+		hookEnvPrefix+"EVENT="+p.Event,
+		hookEnvPrefix+"EVENT_COUNT="+fmt.Sprint(p.Count),
+		hookEnvPrefix+"EVENT_TEXT="+p.Text,
+	)
+	if len(p.Jobs) == 0 {
+		return env
+	}
+	j := p.Jobs[0]
+	return append(env,
+		hookEnvPrefix+"JOB_ID="+j.JobID,
+		hookEnvPrefix+"JOB_NAME="+j.Name,
+		hookEnvPrefix+"JOB_USER="+j.User,
+		hookEnvPrefix+"JOB_STATE="+j.State,
+		hookEnvPrefix+"JOB_PREV_STATE="+j.PrevState,
+		hookEnvPrefix+"JOB_PARTITION="+j.Partition,
+		hookEnvPrefix+"JOB_ELAPSED="+j.Elapsed,
+		hookEnvPrefix+"JOB_NODES="+j.Nodes,
+		hookEnvPrefix+"JOB_NODELIST="+j.NodeList,
+		hookEnvPrefix+"JOB_EXIT_CODE="+j.ExitCode,
+	)
+}
+
+// HookDispatcher delivers job events to the configured hooks in the
+// background. Each hook has its own queue and worker so a slow endpoint does
+// not hold back the others.
+type HookDispatcher struct {
+	runners []*hookRunner
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// NewHookDispatcher starts one worker per hook. errf receives delivery
+// failures (after retries); it may be nil. Returns nil when there are no
+// hooks, and all methods are safe to call on a nil dispatcher.
+func NewHookDispatcher(hooks []HookConfig, errf func(error)) *HookDispatcher {
+	if len(hooks) == 0 {
+		return nil
+	}
+	if errf == nil {
+		errf = func(error) {}
+	}
+	d := &HookDispatcher{}
+	for _, cfg := range hooks {
+		r := newHookRunner(cfg, errf)
+		d.runners = append(d.runners, r)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			r.run()
+		}()
+	}
+	return d
+}
+
+// Fire queues events for every hook that matches them. It never blocks; if a
+// hook's queue is full the event is dropped for that hook.
+func (d *HookDispatcher) Fire(events []JobEvent) {
+	if d == nil {
+		return
+	}
+	for _, ev := range events {
+		for _, r := range d.runners {
+			if !r.cfg.Matches(ev) {
+				continue
+			}
+			select {
+			case r.queue <- ev:
+			default:
+				r.errf(fmt.Errorf("hook %s: queue full, dropped event for job %s", r.cfg.label(), ev.Job.JobID))
+			}
+		}
+	}
+}
+
+// Close flushes pending events (ignoring the rate limit) and waits for the
+// workers to finish.
+func (d *HookDispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() {
+		for _, r := range d.runners {
+			close(r.queue)
+		}
+	})
+	d.wg.Wait()
+}
+
+type hookRunner struct {
+	cfg     HookConfig
+	queue   chan JobEvent
+	errf    func(error)
+	client  *http.Client
+	limiter *tokenBucket
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+func newHookRunner(cfg HookConfig, errf func(error)) *hookRunner {
+	r := &hookRunner{
+		cfg:     cfg,
+		queue:   make(chan JobEvent, hookQueueSize),
+		errf:    errf,
+		timeout: parseDurationOr(cfg.Timeout, defaultHookTimeout),
+		retries: defaultHookRetries,
+		backoff: parseDurationOr(cfg.Backoff, defaultHookBackoff),
+	}
+	if cfg.Retries != nil {
+		r.retries = *cfg.Retries
+	}
+	perMinute := cfg.PerMinute
+	if perMinute == 0 {
+		perMinute = defaultHookPerMinute
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = defaultHookBurst
+	}
+	r.limiter = newTokenBucket(burst, time.Minute/time.Duration(perMinute))
+	r.client = &http.Client{Timeout: r.timeout}
+	return r
+}
+
+func parseDurationOr(value string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+func (r *hookRunner) run() {
+	for {
+		ev, ok := <-r.queue
+		if !ok {
+			return
+		}
+		batch := []JobEvent{ev}
+		open := true
+
+		// Wait for a delivery slot, coalescing everything that arrives in
+		// the meantime into one payload.
+		for open {
+			wait := r.limiter.reserve(time.Now())
+			if wait <= 0 {
+				break
+			}
+			timer := time.NewTimer(wait)
+		collect:
+			for {
+				select {
+				case ev, ok := <-r.queue:
+					if !ok {
+						open = false
+						break collect
+					}
+					batch = append(batch, ev)
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+		}
+		batch = r.drain(batch)
+
+		if err := r.deliver(buildHookPayload(r.cfg.Name, batch)); err != nil {
+			r.errf(fmt.Errorf("hook %s: %w", r.cfg.label(), err))
+		}
+		if !open {
+			// Queue closed while waiting; deliver whatever is left in one go.
+			if rest := r.drain(nil); len(rest) > 0 {
+				if err := r.deliver(buildHookPayload(r.cfg.Name, rest)); err != nil {
+					r.errf(fmt.Errorf("hook %s: %w", r.cfg.label(), err))
+				}
+			}
+			return
+		}
+	}
+}
+
+// drain appends every event already waiting in the queue without blocking.
+func (r *hookRunner) drain(batch []JobEvent) []JobEvent {
+	for {
+		select {
+		case ev, ok := <-r.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, ev)
+		default:
+			return batch
+		}
+	}
+}
+
+func (r *hookRunner) deliver(p hookPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	delay := r.backoff
+	var lastErr error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+			if delay > maxHookBackoff {
+				delay = maxHookBackoff
+			}
+		}
+		var retry bool
+		if r.cfg.URL != "" {
+			retry, lastErr = r.post(body)
+		} else {
+			retry, lastErr = r.exec(p, body)
+		}
+		if lastErr == nil || !retry {
+			return lastErr
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", r.retries+1, lastErr)
+}
+
+// post sends the payload and reports whether a failure is worth retrying
+// (network errors, 429 and 5xx responses).
+func (r *hookRunner) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", hookDefaultContentType)
+	req.Header.Set("User-Agent", hookUserAgent)
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("POST %s: %s", r.cfg.URL, resp.Status)
+}
+
+func (r *hookRunner) exec(p hookPayload, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hookCommandShell, "-c", r.cfg.Command)
+	cmd.Env = hookEnv(p)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return true, fmt.Errorf("command timed out after %s", r.timeout)
+		}
+		return true, fmt.Errorf("command failed: %v, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return false, nil
+}
+
+// tokenBucket is a minimal rate limiter: capacity tokens, refilled one per
+// interval.
+type tokenBucket struct {
+	capacity int
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, interval time.Duration) *tokenBucket {
+	return &tokenBucket{capacity: capacity, interval: interval, tokens: float64(capacity)}
+}
+
+// reserve takes a token if one is available and returns 0, otherwise it
+// returns how long to wait for the next one.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > float64(b.capacity) {
+			b.tokens = float64(b.capacity)
+		}
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.interval))
+}
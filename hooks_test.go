@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHookMatchesFilters(t *testing.T) {
+	hook := HookConfig{URL: "http://x", States: []string{"FAILED", "TO"}, JobName: "train-*", Partition: "gpu*"}
+	ev := JobEvent{Job: Job{JobID: "1", Name: "train-a", Partition: "gpu-a100", Status: "FAILED"}, PrevState: "R", State: "F"}
+	if !hook.Matches(ev) {
+		t.Fatalf("expected hook to match %+v", ev)
+	}
+	ev.Job.Name = "eval"
+	if hook.Matches(ev) {
+		t.Fatalf("expected name glob to reject %q", ev.Job.Name)
+	}
+
+	defaults := HookConfig{URL: "http://x"}
+	running := JobEvent{Job: Job{JobID: "1", Status: "R"}, PrevState: "PD", State: "R"}
+	if defaults.Matches(running) {
+		t.Fatalf("expected hook without states to only match terminal transitions")
+	}
+}
+
+func TestParseConfigRejectsInvalidHook(t *testing.T) {
+	_, err := parseConfig([]byte(`{"hooks":[{"url":"http://x","command":"echo"}]}`), "config.json")
+	if err == nil {
+		t.Fatalf("expected error when both url and command are set")
+	}
+	_, err = parseConfig([]byte(`{"hooks":[{"url":"http://x","timeout":"soon"}]}`), "config.json")
+	if err == nil {
+		t.Fatalf("expected error for invalid duration")
+	}
+}
+
+type hookRecorder struct {
+	mu       sync.Mutex
+	payloads []hookPayload
+	failures int
+}
+
+func (r *hookRecorder) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p hookPayload
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		r.payloads = append(r.payloads, p)
+	}
+}
+
+func TestHookDispatcherPostsWithRetry(t *testing.T) {
+	rec := &hookRecorder{failures: 2}
+	srv := httptest.NewServer(rec.handler(t))
+	defer srv.Close()
+
+	d := NewHookDispatcher([]HookConfig{{Name: "chat", URL: srv.URL, Backoff: "1ms"}}, func(err error) {
+		t.Errorf("unexpected hook error: %v", err)
+	})
+	d.Fire([]JobEvent{{Job: Job{JobID: "42", Name: "train", Status: "COMPLETED", ExitCode: "0:0"}, PrevState: "R", State: "CD", Time: time.Now()}})
+	d.Close()
+
+	if len(rec.payloads) != 1 {
+		t.Fatalf("expected 1 delivered payload, got %d", len(rec.payloads))
+	}
+	p := rec.payloads[0]
+	if p.Event != hookEventStateChanged || p.Count != 1 || p.Jobs[0].JobID != "42" || p.Jobs[0].ExitCode != "0:0" {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+	if !strings.Contains(p.Text, "R → CD") {
+		t.Fatalf("expected summary text, got %q", p.Text)
+	}
+}
+
+func TestHookDispatcherCoalescesBurstOverRateLimit(t *testing.T) {
+	rec := &hookRecorder{}
+	srv := httptest.NewServer(rec.handler(t))
+	defer srv.Close()
+
+	d := NewHookDispatcher([]HookConfig{{URL: srv.URL, PerMinute: 1, Burst: 2}}, nil)
+	var events []JobEvent
+	for i := 0; i < 1000; i++ {
+		events = append(events, JobEvent{Job: Job{JobID: "7_" + strings.Repeat("1", i%5+1), Status: "COMPLETED"}, PrevState: "R", State: "CD", Time: time.Now()})
+	}
+	d.Fire(events)
+	d.Close()
+
+	if len(rec.payloads) > 3 {
+		t.Fatalf("expected the burst to be coalesced into at most 3 deliveries, got %d", len(rec.payloads))
+	}
+	total := 0
+	for _, p := range rec.payloads {
+		total += p.Count
+		if len(p.Jobs) > maxJobsPerHookPayload {
+			t.Fatalf("payload lists %d jobs, want at most %d", len(p.Jobs), maxJobsPerHookPayload)
+		}
+	}
+	if total != 1000 {
+		t.Fatalf("expected all 1000 events to be accounted for, got %d", total)
+	}
+}
+
+func TestHookDispatcherRunsCommandWithEnv(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.out")
+	cmd := `printf '%s %s %s' "$SLURM_DASHBOARD_JOB_ID" "$SLURM_DASHBOARD_JOB_STATE" "$SLURM_DASHBOARD_JOB_EXIT_CODE" > ` + out
+
+	d := NewHookDispatcher([]HookConfig{{Command: cmd}}, func(err error) {
+		t.Errorf("unexpected hook error: %v", err)
+	})
+	d.Fire([]JobEvent{{Job: Job{JobID: "9", Status: "FAILED", ExitCode: "2:0"}, PrevState: "R", State: "F", Time: time.Now()}})
+	d.Close()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read hook output: %v", err)
+	}
+	if got := string(data); got != "9 F 2:0" {
+		t.Fatalf("unexpected command output %q", got)
+	}
+}
+
+func TestHooksFireWhileTheLogViewIsOpen(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.out")
+	m := NewModel()
+	m.hooks = NewHookDispatcher([]HookConfig{{States: []string{"R"}, Command: `printf '%s %s' "$SLURM_DASHBOARD_JOB_ID" "$SLURM_DASHBOARD_JOB_STATE" > ` + out}}, func(err error) {
+		t.Errorf("unexpected hook error: %v", err)
+	})
+	m.openTailView(NewTailModel("1", "", "", 160, 40, TailModeStdout))
+	for _, status := range []string{"PENDING", "RUNNING"} {
+		model, _ := m.Update(observedJobsMsg{{JobID: "1", Status: status}})
+		m = model.(Model)
+	}
+	m.hooks.Close()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read hook output: %v", err)
+	}
+	if got := string(data); got != "1 R" {
+		t.Fatalf("unexpected command output %q", got)
+	}
+	if !m.inTailView || len(m.jobs) != 0 {
+		t.Fatalf("expected the log view to stay open and the table untouched")
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Besides the keys of the main and log views, two key maps are shared by
+// several views: scrolling (log panes, tables and lists) and dialogs
+// (prompts, overlays and confirmations). All four can be remapped in the
+// "keys" section of the config file, starting from a preset.
+
+// ScrollKeyMap defines the keys that scroll panes and move through lists.
+type ScrollKeyMap struct {
+	Up           key.Binding
+	Down         key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	HalfPageUp   key.Binding
+	HalfPageDown key.Binding
+	Left         key.Binding
+	Right        key.Binding
+}
+
+var scrollKeys = ScrollKeyMap{
+	Up:           key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+	Down:         key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+	PageUp:       key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "page up")),
+	PageDown:     key.NewBinding(key.WithKeys("pgdown", " "), key.WithHelp("pgdn/space", "page down")),
+	HalfPageUp:   key.NewBinding(key.WithKeys("u", "ctrl+u"), key.WithHelp("u", "½ page up")),
+	HalfPageDown: key.NewBinding(key.WithKeys("d", "ctrl+d"), key.WithHelp("d", "½ page down")),
+	Left:         key.NewBinding(key.WithKeys("left"), key.WithHelp("←", "scroll left")),
+	Right:        key.NewBinding(key.WithKeys("right"), key.WithHelp("→", "scroll right")),
+}
+
+// DialogKeyMap defines the keys of prompts, overlays and confirmations.
+// Close only applies where nothing is typed; prompts close with Back.
+type DialogKeyMap struct {
+	Confirm      key.Binding
+	Back         key.Binding
+	Close        key.Binding
+	Yes          key.Binding
+	No           key.Binding
+	Home         key.Binding
+	End          key.Binding
+	Toggle       key.Binding
+	Delete       key.Binding
+	Open         key.Binding
+	Parent       key.Binding
+	ShowHidden   key.Binding
+	Reload       key.Binding
+	Merge        key.Binding
+	HistoryPrev  key.Binding
+	HistoryNext  key.Binding
+	SearchRegex  key.Binding
+	SearchCase   key.Binding
+	SearchWord   key.Binding
+	NextField    key.Binding
+	ExportHeader key.Binding
+}
+
+var dialogKeys = DialogKeyMap{
+	Confirm:      key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "confirm")),
+	Back:         key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel")),
+	Close:        key.NewBinding(key.WithKeys("q"), key.WithHelp("q", "close")),
+	Yes:          key.NewBinding(key.WithKeys("y", "Y"), key.WithHelp("y", "yes")),
+	No:           key.NewBinding(key.WithKeys("n", "N"), key.WithHelp("n", "no")),
+	Home:         key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("g", "first")),
+	End:          key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("G", "last")),
+	Toggle:       key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "toggle")),
+	Delete:       key.NewBinding(key.WithKeys("d", "delete"), key.WithHelp("d", "delete")),
+	Open:         key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("→/l", "open")),
+	Parent:       key.NewBinding(key.WithKeys("backspace", "left", "h"), key.WithHelp("←/h", "up")),
+	ShowHidden:   key.NewBinding(key.WithKeys("."), key.WithHelp(".", "hidden files")),
+	Reload:       key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reload")),
+	Merge:        key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "merge")),
+	HistoryPrev:  key.NewBinding(key.WithKeys("up"), key.WithHelp("↑", "older")),
+	HistoryNext:  key.NewBinding(key.WithKeys("down"), key.WithHelp("↓", "newer")),
+	SearchRegex:  key.NewBinding(key.WithKeys("alt+r"), key.WithHelp("alt+r", "regex")),
+	SearchCase:   key.NewBinding(key.WithKeys("alt+c"), key.WithHelp("alt+c", "case")),
+	SearchWord:   key.NewBinding(key.WithKeys("alt+w"), key.WithHelp("alt+w", "word")),
+	NextField:    key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next")),
+	ExportHeader: key.NewBinding(key.WithKeys("alt+h"), key.WithHelp("alt+h", "job header")),
+}
+
+// viewportKeyMap returns the scroll keys for a viewport.
+func viewportKeyMap() viewport.KeyMap {
+	return viewport.KeyMap{
+		PageDown:     scrollKeys.PageDown,
+		PageUp:       scrollKeys.PageUp,
+		HalfPageUp:   scrollKeys.HalfPageUp,
+		HalfPageDown: scrollKeys.HalfPageDown,
+		Down:         scrollKeys.Down,
+		Up:           scrollKeys.Up,
+		Left:         scrollKeys.Left,
+		Right:        scrollKeys.Right,
+	}
+}
+
+// tableKeyMap returns the keys for a table: rows move with the up and down
+// keys of the main view.
+func tableKeyMap() table.KeyMap {
+	return keyMaps{main: keys, log: tailKeys, scroll: scrollKeys, dialog: dialogKeys}.table()
+}
+
+// table returns the keys of the tables of the main view. The first and
+// last row keys the main view handles itself are left to it: by default "g"
+// cycles the status filter rather than also jumping to the first job.
+func (k keyMaps) table() table.KeyMap {
+	return table.KeyMap{
+		LineUp:       k.main.Up,
+		LineDown:     k.main.Down,
+		PageUp:       k.scroll.PageUp,
+		PageDown:     k.scroll.PageDown,
+		HalfPageUp:   k.scroll.HalfPageUp,
+		HalfPageDown: k.scroll.HalfPageDown,
+		GotoTop:      withoutKeys(k.dialog.Home, &k.main),
+		GotoBottom:   withoutKeys(k.dialog.End, &k.main),
+	}
+}
+
+// withoutKeys returns b without the keys bound in a key map.
+func withoutKeys(b key.Binding, keyMap any) key.Binding {
+	bound := map[string]bool{}
+	for _, a := range keyActions(keyMap) {
+		for _, k := range a.binding.Keys() {
+			bound[k] = true
+		}
+	}
+	var kept []string
+	for _, k := range b.Keys() {
+		if !bound[k] {
+			kept = append(kept, k)
+		}
+	}
+	if len(kept) == 0 {
+		b.Unbind()
+		return b
+	}
+	b.SetKeys(kept...)
+	return b
+}
+
+// KeysConfig is the "keys" section of the config file: a preset, then keys
+// by action for each key map. Actions are the snake_case names of the
+// fields of the key maps ("cancel_job", "next_error", ...); an empty list
+// unbinds an action.
+type KeysConfig struct {
+	Preset string              `json:"preset"` // "default", "vim" or "emacs"
+	Main   map[string][]string `json:"main"`
+	Log    map[string][]string `json:"log"`
+	Scroll map[string][]string `json:"scroll"`
+	Dialog map[string][]string `json:"dialog"`
+}
+
+// keyPresets remap the default keys, in the format of the config file.
+var keyPresets = map[string]KeysConfig{
+	"default": {},
+	// vim: paging with ^f/^b, and only g/G to go to the top and bottom of a
+	// log.
+	"vim": {
+		Log: map[string][]string{
+			"top":    {"g", "home"},
+			"bottom": {"G", "end"},
+		},
+		Scroll: map[string][]string{
+			"page_up":   {"ctrl+b", "pgup"},
+			"page_down": {"ctrl+f", "pgdown", " "},
+		},
+	},
+	// emacs: ^p/^n/^v/M-v to move, ^s/^r to search, ^g to cancel, M-x for
+	// commands.
+	"emacs": {
+		Main: map[string][]string{
+			"up":      {"ctrl+p", "up"},
+			"down":    {"ctrl+n", "down"},
+			"filter":  {"ctrl+s", "/"},
+			"palette": {"alt+x", ":"},
+		},
+		Log: map[string][]string{
+			"palette":   {"alt+x", ":"},
+			"quit":      {"q", "esc", "ctrl+g"},
+			"search":    {"ctrl+s", "/"},
+			"find_prev": {"ctrl+r", "N"},
+			"top":       {"alt+<", "home"},
+			"bottom":    {"alt+>", "end"},
+		},
+		Scroll: map[string][]string{
+			"up":        {"ctrl+p", "up"},
+			"down":      {"ctrl+n", "down"},
+			"page_up":   {"alt+v", "pgup"},
+			"page_down": {"ctrl+v", "pgdown"},
+			"left":      {"ctrl+b", "left"},
+			"right":     {"ctrl+f", "right"},
+		},
+		Dialog: map[string][]string{
+			"back":         {"esc", "ctrl+g"},
+			"home":         {"alt+<", "home"},
+			"end":          {"alt+>", "end"},
+			"history_prev": {"alt+p", "up"},
+			"history_next": {"alt+n", "down"},
+		},
+	},
+}
+
+// keyMaps are the key maps the config can remap.
+type keyMaps struct {
+	main   KeyMap
+	log    TailKeyMap
+	scroll ScrollKeyMap
+	dialog DialogKeyMap
+}
+
+// keyMapSection is a key map and its name in the config file.
+type keyMapSection struct {
+	name   string
+	keyMap any // pointer to the key map struct
+	config map[string][]string
+}
+
+func (k *keyMaps) sections(cfg KeysConfig) []keyMapSection {
+	return []keyMapSection{
+		{"main", &k.main, cfg.Main},
+		{"log", &k.log, cfg.Log},
+		{"scroll", &k.scroll, cfg.Scroll},
+		{"dialog", &k.dialog, cfg.Dialog},
+	}
+}
+
+// keyAction is a binding of a key map and its action name.
+type keyAction struct {
+	name    string
+	binding *key.Binding
+}
+
+// keyActions returns the bindings of a key map, in field order, named by
+// their field in snake_case.
+func keyActions(keyMap any) []keyAction {
+	v := reflect.ValueOf(keyMap).Elem()
+	var actions []keyAction
+	for i := 0; i < v.NumField(); i++ {
+		if b, ok := v.Field(i).Addr().Interface().(*key.Binding); ok {
+			actions = append(actions, keyAction{name: snakeCase(v.Type().Field(i).Name), binding: b})
+		}
+	}
+	return actions
+}
+
+// pressedAction returns the binding of a key map a key is bound to, or nil.
+// A key is bound to at most one action of a key map.
+func pressedAction(msg tea.KeyMsg, keyMap any) *key.Binding {
+	for _, a := range keyActions(keyMap) {
+		if key.Matches(msg, *a.binding) {
+			return a.binding
+		}
+	}
+	return nil
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// keyHelp is how keys are shown in the help bar.
+func keyHelp(keys []string) string {
+	shown := make([]string, len(keys))
+	for i, k := range keys {
+		switch k {
+		case "up":
+			k = "↑"
+		case "down":
+			k = "↓"
+		case "left":
+			k = "←"
+		case "right":
+			k = "→"
+		case " ":
+			k = "space"
+		case "pgdown":
+			k = "pgdn"
+		}
+		shown[i] = strings.Replace(k, "ctrl+", "^", 1)
+	}
+	return strings.Join(shown, "/")
+}
+
+// hint is one entry of a hint line: what the bindings do, after their keys
+// as currently bound. It is empty when none of them has a key left.
+func hint(desc string, bindings ...key.Binding) string {
+	var shown []string
+	for _, b := range bindings {
+		if b.Enabled() {
+			shown = append(shown, b.Help().Key)
+		}
+	}
+	if len(shown) == 0 {
+		return ""
+	}
+	return strings.Join(shown, "/") + " " + desc
+}
+
+// hints joins the hints of a hint line, leaving out the empty ones.
+func hints(sep string, entries ...string) string {
+	shown := entries[:0:0]
+	for _, e := range entries {
+		if e != "" {
+			shown = append(shown, e)
+		}
+	}
+	return strings.Join(shown, sep)
+}
+
+// remap applies the keys of one config section to a key map.
+func remap(section keyMapSection) error {
+	if len(section.config) == 0 {
+		return nil
+	}
+	byName := map[string]*key.Binding{}
+	for _, a := range keyActions(section.keyMap) {
+		byName[a.name] = a.binding
+	}
+	names := make([]string, 0, len(section.config))
+	for name := range section.config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown action %q", section.name, name)
+		}
+		keys := section.config[name]
+		if len(keys) == 0 {
+			b.Unbind()
+			continue
+		}
+		for _, k := range keys {
+			if k == "" {
+				return fmt.Errorf("%s: %s: empty key", section.name, name)
+			}
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(keyHelp(keys), b.Help().Desc)
+	}
+	return nil
+}
+
+// keyConflicts reports keys bound to two actions of the same key maps.
+func keyConflicts(name string, keyMaps ...any) error {
+	boundTo := map[string]string{}
+	for _, keyMap := range keyMaps {
+		for _, a := range keyActions(keyMap) {
+			for _, k := range a.binding.Keys() {
+				if other, ok := boundTo[k]; ok && other != a.name {
+					return fmt.Errorf("%s: %q is bound to both %s and %s", name, k, other, a.name)
+				}
+				boundTo[k] = a.name
+			}
+		}
+	}
+	return nil
+}
+
+// build returns the default key maps remapped by the preset and the
+// config, and fails on unknown actions and conflicting keys.
+func (c KeysConfig) build() (keyMaps, error) {
+	k := keyMaps{main: keys, log: tailKeys, scroll: scrollKeys, dialog: dialogKeys}
+	preset := c.Preset
+	if preset == "" {
+		preset = "default"
+	}
+	p, ok := keyPresets[preset]
+	if !ok {
+		return keyMaps{}, fmt.Errorf("unknown preset %q (want default, vim or emacs)", c.Preset)
+	}
+	for _, cfg := range []KeysConfig{p, c} {
+		for _, section := range k.sections(cfg) {
+			if err := remap(section); err != nil {
+				return keyMaps{}, err
+			}
+		}
+	}
+	for _, section := range k.sections(KeysConfig{}) {
+		if err := keyConflicts(section.name, section.keyMap); err != nil {
+			return keyMaps{}, err
+		}
+	}
+	// Keys the log view does not handle scroll its panes.
+	if err := keyConflicts("log and scroll", &k.log, &k.scroll); err != nil {
+		return keyMaps{}, err
+	}
+	// Keys the main view does not handle go to its tables, except the
+	// up and down keys it shares with them.
+	t := k.table()
+	t.LineUp, t.LineDown = key.Binding{}, key.Binding{}
+	if err := keyConflicts("main and table", &k.main, &t); err != nil {
+		return keyMaps{}, err
+	}
+	return k, nil
+}
+
+func (c KeysConfig) validate() error {
+	_, err := c.build()
+	return err
+}
+
+// install makes the key maps the ones in use. It runs once at startup,
+// before any view is created.
+func (k keyMaps) install() {
+	keys, tailKeys, scrollKeys, dialogKeys = k.main, k.log, k.scroll, k.dialog
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestKeyPresetsHaveNoConflicts(t *testing.T) {
+	for name := range keyPresets {
+		if _, err := (KeysConfig{Preset: name}).build(); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+	if _, err := (KeysConfig{Preset: "nano"}).build(); err == nil {
+		t.Errorf("expected an unknown preset to be rejected")
+	}
+}
+
+func TestParseConfigRejectsBadKeys(t *testing.T) {
+	for config, want := range map[string]string{
+		`{"keys": {"log": {"toggle_borders": ["m"]}}}`:         `"m" is bound to both toggle_borders and toggle_mouse`,
+		`{"keys": {"main": {"cancel": ["c"]}}}`:                `unknown action "cancel"`,
+		`{"keys": {"log": {"bookmark": ["d"]}}}`:               `log and scroll: "d" is bound to both bookmark and half_page_down`,
+		`{"keys": {"dialog": {"confirm": [""]}}}`:              "empty key",
+		`{"keys": {"main": {"refresh": ["pgdown"]}}}`:          `main and table: "pgdown" is bound to both refresh and page_down`,
+		`{"keys": {"preset": "emacs", "main": {"up": ["k"]}}}`: "",
+	} {
+		_, err := parseConfig([]byte(config), "config.json")
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s: expected %q, got %v", config, want, err)
+		}
+	}
+}
+
+func TestRemappedKeysDriveViewsAndHelp(t *testing.T) {
+	saved := keyMaps{keys, tailKeys, scrollKeys, dialogKeys}
+	t.Cleanup(saved.install)
+	k, err := KeysConfig{Preset: "emacs", Main: map[string][]string{"cancel_job": {"ctrl+k"}, "history": {}}}.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.install()
+
+	m := NewModel()
+	m.jobs = []Job{{JobID: "1", Status: "RUNNING"}, {JobID: "2", Status: "RUNNING"}}
+	m.updateTable()
+	update := func(msg tea.KeyMsg) {
+		model, _ := m.Update(msg)
+		m = model.(Model)
+	}
+	update(tea.KeyMsg{Type: tea.KeyCtrlN})
+	if m.table.Cursor() != 1 {
+		t.Fatalf("expected ^n to move down, at row %d", m.table.Cursor())
+	}
+	update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	if !m.confirmingCancel || m.cancelCandidate.JobID != "2" {
+		t.Fatalf("expected ^k to ask to cancel job 2")
+	}
+	if view := m.View(); !strings.Contains(view, "n/esc/^g no") {
+		t.Fatalf("expected the prompt to show the remapped keys:\n%s", view)
+	}
+	update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	if m.confirmingCancel {
+		t.Fatalf("expected ^g to answer no")
+	}
+
+	m.help.ShowAll = true
+	help := m.help.View(keys)
+	if !strings.Contains(help, "^k") || !strings.Contains(help, "^p/↑") || strings.Contains(help, "history") {
+		t.Fatalf("expected the help to show the remapped keys:\n%s", help)
+	}
+	if got := hints("  ", hint("jump", dialogKeys.Confirm), hint("history", keys.History), hint("close", dialogKeys.Back)); got != "enter jump  esc/^g close" {
+		t.Fatalf("expected the hints to show the remapped keys and leave out unbound ones, got %q", got)
+	}
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Native log reading for the tail view: compressed logs are decompressed
+// transparently (detected by content, not by name) and a rotated log family
+// (train.log.2.gz, train.log.1, train.log) reads as one continuous stream.
+
+const (
+	// Rotation indexes above this are more likely job IDs (output.123456)
+	// than logrotate generations.
+	maxRotationIndex = 999
+	tailReadBlock    = 64 << 10
+)
+
+// compressedLogSuffixes are the compressed variants looked up by name, e.g.
+// in the log archive.
+var compressedLogSuffixes = []string{".gz", ".zst", ".bz2"}
+
+var rotatedSuffixPattern = regexp.MustCompile(`^([0-9]+)(\.gz|\.zst|\.bz2)?$`)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+type logCompression int
+
+const (
+	logPlain logCompression = iota
+	logGzip
+	logZstd
+	logBzip2
+)
+
+func sniffLogCompression(f *os.File) logCompression {
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return logGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return logZstd
+	case bytes.HasPrefix(head, bzip2Magic):
+		return logBzip2
+	default:
+		return logPlain
+	}
+}
+
+// isCompressedLog reports whether a log is compressed, i.e. static.
+func isCompressedLog(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return sniffLogCompression(f) != logPlain
+}
+
+type decompressedLog struct {
+	io.Reader
+	close func()
+	file  *os.File
+}
+
+func (d *decompressedLog) Close() error {
+	if d.close != nil {
+		d.close()
+	}
+	return d.file.Close()
+}
+
+// openDecompressed returns a reader over the decompressed content of a
+// compressed log.
+func openDecompressed(f *os.File, kind logCompression) (io.ReadCloser, error) {
+	switch kind {
+	case logGzip:
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedLog{Reader: zr, close: func() { zr.Close() }, file: f}, nil
+	case logZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedLog{Reader: zr, close: zr.Close, file: f}, nil
+	case logBzip2:
+		return &decompressedLog{Reader: bzip2.NewReader(f), file: f}, nil
+	default:
+		return f, nil
+	}
+}
+
+// splitRotatedName splits "train.log.2.gz" into ("train.log", 2). Names that
+// are not rotated generations return (name, 0).
+func splitRotatedName(name string) (string, int) {
+	i := strings.LastIndex(trimCompressedSuffix(name), ".")
+	if i <= 0 {
+		return name, 0
+	}
+	m := rotatedSuffixPattern.FindStringSubmatch(name[i+1:])
+	if m == nil {
+		return name, 0
+	}
+	index, err := strconv.Atoi(m[1])
+	if err != nil || index < 1 || index > maxRotationIndex {
+		return name, 0
+	}
+	return name[:i], index
+}
+
+// rotatedGeneration is splitRotatedName for a file in dir, but only takes
+// "log.2" for a rotated generation when "log" is next to it or the file was
+// compressed: per-task logs (--output=log.%t) are named the same way.
+func rotatedGeneration(dir, name string) (string, int) {
+	base, index := splitRotatedName(name)
+	if index == 0 || trimCompressedSuffix(name) != name {
+		return base, index
+	}
+	if _, err := os.Stat(filepath.Join(dir, base)); err != nil {
+		return name, 0
+	}
+	return base, index
+}
+
+func trimCompressedSuffix(name string) string {
+	for _, suffix := range compressedLogSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// rotatedLogFamily returns the files that make up a log, oldest first: the
+// rotated generations (highest index first, as logrotate numbers them)
+// followed by the log itself. Opening a rotated generation yields it and the
+// older ones only.
+func rotatedLogFamily(path string) []string {
+	dir, name := filepath.Split(path)
+	base, index := rotatedGeneration(dir, name)
+
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return []string{path}
+	}
+	_, statErr := os.Stat(filepath.Join(dir, base))
+	baseExists := index == 0 || statErr == nil
+	generations := map[int]string{}
+	for _, entry := range entries {
+		gen, n := splitRotatedName(entry.Name())
+		if gen != base || n == 0 || n < index || entry.IsDir() {
+			continue
+		}
+		if !baseExists && trimCompressedSuffix(entry.Name()) == entry.Name() {
+			continue
+		}
+		// Prefer the uncompressed copy while logrotate is compressing it.
+		if prev, ok := generations[n]; ok && trimCompressedSuffix(prev) == prev {
+			continue
+		}
+		generations[n] = entry.Name()
+	}
+	if index > 0 {
+		generations[index] = name
+	}
+
+	indexes := make([]int, 0, len(generations))
+	for n := range generations {
+		indexes = append(indexes, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+
+	family := make([]string, 0, len(indexes)+1)
+	for _, n := range indexes {
+		family = append(family, filepath.Join(dir, generations[n]))
+	}
+	if index == 0 {
+		family = append(family, path)
+	}
+	return family
+}
+
+// isStaticLog reports whether a log will not grow anymore: compressed logs
+// and rotated generations.
+func isStaticLog(path string) bool {
+	if _, index := rotatedGeneration(filepath.Split(path)); index > 0 {
+		return true
+	}
+	return isCompressedLog(path)
+}
+
+// logPos is a position in a log family: a byte offset into the (decompressed)
+// content of one of its files. Positions handed out always start a line.
+type logPos struct {
+	file   int
+	offset int64
+}
+
+// posEnd stands for the end of a file whose decompressed size is unknown.
+const posEnd = -1
+
+// logLine is a line of a log and where it starts.
+type logLine struct {
+	text string
+	pos  logPos
+}
+
+// logSource reads a log family (rotated generations, oldest first, then the
+// log itself) as one stream, in chunks and from any position, so only a
+// window of it has to be kept in memory.
+type logSource struct {
+	files []string
+}
+
+func newLogSource(path string) logSource {
+	return logSource{files: rotatedLogFamily(path)}
+}
+
+// end returns the position after the last line of the log.
+func (s logSource) end() (logPos, error) {
+	last := len(s.files) - 1
+	f, err := os.Open(s.files[last])
+	if err != nil {
+		return logPos{file: last}, err
+	}
+	defer f.Close()
+	if sniffLogCompression(f) != logPlain {
+		return logPos{file: last, offset: posEnd}, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return logPos{file: last}, err
+	}
+	return logPos{file: last, offset: info.Size()}, nil
+}
+
+// readLogTail returns the last n lines (all lines when n <= 0) of a log and
+// its rotated generations. Older generations are only read when the newer
+// ones hold fewer than n lines. The error is that of the log itself; an
+// unreadable older generation just ends the history early.
+func readLogTail(path string, n int) ([]string, error) {
+	src := newLogSource(path)
+	lines, _, _, err := src.tail(n)
+	return texts(lines), err
+}
+
+// tail returns the last n lines of the log (all when n <= 0), whether they
+// reach back to its start, and the end position to follow it from.
+func (s logSource) tail(n int) ([]logLine, bool, logPos, error) {
+	end, endErr := s.end()
+	from := end
+	if endErr != nil {
+		// The log itself is unreadable (not created yet): older generations
+		// may still be.
+		from = logPos{file: end.file}
+	}
+	lines, atStart := s.linesBefore(from, n)
+	if len(lines) == 0 && endErr != nil {
+		return nil, false, end, endErr
+	}
+	return lines, atStart, end, nil
+}
+
+// linesBefore returns up to n lines (all when n <= 0) ending right before
+// pos, and whether they reach back to the start of the log. Unreadable files
+// end the history early.
+func (s logSource) linesBefore(pos logPos, n int) ([]logLine, bool) {
+	var lines []logLine
+	for n <= 0 || len(lines) < n {
+		if pos.offset == 0 {
+			if pos.file == 0 {
+				return lines, true
+			}
+			pos = logPos{file: pos.file - 1, offset: posEnd}
+		}
+		need := 0
+		if n > 0 {
+			need = n - len(lines)
+		}
+		chunk, err := s.fileLinesBefore(pos, need)
+		if err != nil {
+			return lines, false
+		}
+		lines = append(chunk, lines...)
+		if len(chunk) == 0 {
+			pos.offset = 0
+		} else {
+			pos = chunk[0].pos
+		}
+	}
+	return lines, pos.offset == 0 && pos.file == 0
+}
+
+// linesAfter returns up to n lines starting at pos, the position after them
+// and whether that is the end of the log.
+func (s logSource) linesAfter(pos logPos, n int) ([]logLine, logPos, bool, error) {
+	if n <= 0 {
+		return nil, pos, false, nil
+	}
+	var lines []logLine
+	next := pos
+	err := s.scan(pos, func(line logLine, end logPos) bool {
+		lines = append(lines, line)
+		next = end
+		return len(lines) < n
+	})
+	if err != nil {
+		return lines, next, false, err
+	}
+	if len(lines) < n {
+		// The scan ran to the end of the log.
+		return lines, next, true, nil
+	}
+	more := false
+	err = s.scan(next, func(logLine, logPos) bool {
+		more = true
+		return false
+	})
+	return lines, next, !more, err
+}
+
+// advance returns the position n lines after pos (clamped to the end).
+func (s logSource) advance(pos logPos, n int) (logPos, error) {
+	if n <= 0 {
+		return pos, nil
+	}
+	_, next, _, err := s.linesAfter(pos, n)
+	return next, err
+}
+
+// countLines returns how many lines of the log come before pos.
+func (s logSource) countLines(pos logPos) (int, error) {
+	n := 0
+	err := s.scan(logPos{}, func(line logLine, _ logPos) bool {
+		if line.pos.file > pos.file || line.pos.file == pos.file && pos.offset != posEnd && line.pos.offset >= pos.offset {
+			return false
+		}
+		n++
+		return true
+	})
+	return n, err
+}
+
+// scan calls fn for every line from pos on, with the position after it,
+// until fn returns false or the log ends.
+func (s logSource) scan(pos logPos, fn func(line logLine, end logPos) bool) error {
+	for i := pos.file; i < len(s.files); i++ {
+		from := int64(0)
+		if i == pos.file {
+			from = pos.offset
+		}
+		if from == posEnd {
+			continue
+		}
+		cont, err := s.scanFile(i, from, fn)
+		if err != nil || !cont {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s logSource) scanFile(i int, from int64, fn func(line logLine, end logPos) bool) (bool, error) {
+	r, err := s.openAt(i, from)
+	if err != nil {
+		return true, err
+	}
+	defer r.Close()
+
+	br := bufio.NewReaderSize(r, followReadChunk)
+	offset := from
+	for {
+		text, err := br.ReadString('\n')
+		if text != "" {
+			start := offset
+			offset += int64(len(text))
+			line := logLine{text: strings.TrimRight(text, "\r\n"), pos: logPos{file: i, offset: start}}
+			if !fn(line, logPos{file: i, offset: offset}) {
+				return false, nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// openAt opens file i positioned at a decompressed offset.
+func (s logSource) openAt(i int, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.files[i])
+	if err != nil {
+		return nil, err
+	}
+	kind := sniffLogCompression(f)
+	if kind == logPlain {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	r, err := openDecompressed(f, kind)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, r, offset); err != nil && !errors.Is(err, io.EOF) {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// fileLinesBefore returns the last n lines (all when n <= 0) of one file
+// that end before pos. Plain files are read backwards from pos, so this stays
+// cheap on huge logs; compressed files have to be streamed from the start.
+func (s logSource) fileLinesBefore(pos logPos, n int) ([]logLine, error) {
+	f, err := os.Open(s.files[pos.file])
+	if err != nil {
+		return nil, err
+	}
+	kind := sniffLogCompression(f)
+	if kind != logPlain {
+		f.Close()
+		var ring []logLine
+		err := s.scan(logPos{file: pos.file}, func(line logLine, _ logPos) bool {
+			if line.pos.file != pos.file || (pos.offset != posEnd && line.pos.offset >= pos.offset) {
+				return false
+			}
+			ring = append(ring, line)
+			if n > 0 && len(ring) > 2*n {
+				ring = append(ring[:0], ring[len(ring)-n:]...)
+			}
+			return true
+		})
+		if n > 0 && len(ring) > n {
+			ring = ring[len(ring)-n:]
+		}
+		return ring, err
+	}
+	defer f.Close()
+
+	end := pos.offset
+	if end == posEnd {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		end = info.Size()
+	}
+	var buf []byte
+	lo := end
+	for lo > 0 {
+		size := int64(tailReadBlock)
+		if size > lo {
+			size = lo
+		}
+		lo -= size
+		block := make([]byte, size)
+		read, err := f.ReadAt(block, lo)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if read < len(block) {
+			// The file shrank under us; only keep what is really there.
+			buf = append(block[:read], buf...)
+		} else {
+			buf = append(block, buf...)
+		}
+		// n complete lines are available once n newlines precede the last
+		// line (a trailing newline does not start a new line).
+		if n > 0 && bytes.Count(bytes.TrimRight(buf, "\r\n"), []byte{'\n'}) >= n {
+			break
+		}
+	}
+	partialFirst := false
+	if lo > 0 {
+		// The first line read is complete only if a newline precedes it.
+		prev := make([]byte, 1)
+		if _, err := f.ReadAt(prev, lo-1); err != nil {
+			return nil, err
+		}
+		partialFirst = prev[0] != '\n'
+	}
+	return splitLogLines(buf, logPos{file: pos.file, offset: lo}, n, partialFirst), nil
+}
+
+// splitLogLines splits buf, the content starting at base, into lines and
+// returns the last n (all when n <= 0). When partialFirst is set the first
+// line is incomplete and dropped.
+func splitLogLines(buf []byte, base logPos, n int, partialFirst bool) []logLine {
+	starts := []int{0}
+	for i, b := range buf {
+		if b == '\n' && i+1 < len(buf) {
+			starts = append(starts, i+1)
+		}
+	}
+	if partialFirst {
+		starts = starts[1:]
+	}
+	if n > 0 && len(starts) > n {
+		starts = starts[len(starts)-n:]
+	}
+	lines := make([]logLine, 0, len(starts))
+	for j, start := range starts {
+		end := len(buf)
+		if j+1 < len(starts) {
+			end = starts[j+1]
+		}
+		if start == len(buf) {
+			break
+		}
+		text := strings.TrimRight(string(buf[start:end]), "\r\n")
+		lines = append(lines, logLine{text: text, pos: logPos{file: base.file, offset: base.offset + int64(start)}})
+	}
+	return lines
+}
+
+// search returns the position of the nearest line matching match: the first
+// one at or after from (forward), or the last one before from (backward).
+func (s logSource) search(from logPos, forward bool, match func(string) bool) (logPos, bool, error) {
+	if forward {
+		var found logPos
+		ok := false
+		err := s.scan(from, func(line logLine, _ logPos) bool {
+			if match(line.text) {
+				found, ok = line.pos, true
+				return false
+			}
+			return true
+		})
+		return found, ok, err
+	}
+
+	pos := from
+	for {
+		if pos.offset == 0 {
+			if pos.file == 0 {
+				return logPos{}, false, nil
+			}
+			pos = logPos{file: pos.file - 1, offset: posEnd}
+		}
+		if !isCompressedLog(s.files[pos.file]) {
+			chunk, err := s.fileLinesBefore(pos, logSearchChunk)
+			if err != nil {
+				return logPos{}, false, err
+			}
+			for i := len(chunk) - 1; i >= 0; i-- {
+				if match(chunk[i].text) {
+					return chunk[i].pos, true, nil
+				}
+			}
+			if len(chunk) == 0 {
+				pos.offset = 0
+			} else {
+				pos = chunk[0].pos
+			}
+			continue
+		}
+
+		// Compressed: one pass over the file, remembering the last match.
+		var found logPos
+		ok := false
+		err := s.scan(logPos{file: pos.file}, func(line logLine, _ logPos) bool {
+			if line.pos.file != pos.file || (pos.offset != posEnd && line.pos.offset >= pos.offset) {
+				return false
+			}
+			if match(line.text) {
+				found, ok = line.pos, true
+			}
+			return true
+		})
+		if err != nil || ok {
+			return found, ok, err
+		}
+		pos.offset = 0
+	}
+}
+
+// logSearchChunk is how many lines a backward search reads at a time.
+const logSearchChunk = 2000
+
+func texts(lines []logLine) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = line.text
+	}
+	return out
+}
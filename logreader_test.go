@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bzip2 of "one\ntwo\n"; the standard library only decompresses bzip2.
+var bzip2OneTwo = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xa7, 0x14,
+	0x2b, 0x77, 0x00, 0x00, 0x02, 0xc1, 0x80, 0x00, 0x10, 0x02, 0x01, 0x84,
+	0x80, 0x20, 0x00, 0x21, 0x80, 0x0c, 0x02, 0x38, 0xf5, 0x1b, 0x8b, 0xb9,
+	0x22, 0x9c, 0x28, 0x48, 0x53, 0x8a, 0x15, 0xbb, 0x80,
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd: %v", err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll([]byte(s), nil)
+}
+
+func TestReadLogTailDecompressesByContent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		// Names deliberately do not match the content.
+		"a.log": gzipBytes(t, "one\ntwo\n"),
+		"b.zst": zstdBytes(t, "one\ntwo\n"),
+		"c.out": bzip2OneTwo,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := readLogTail(path, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(lines, []string{"one", "two"}) {
+			t.Errorf("%s: got %q", name, lines)
+		}
+		if !isStaticLog(path) {
+			t.Errorf("%s: compressed log should be static", name)
+		}
+	}
+}
+
+func TestRotatedLogFamilyReadsAsOneStream(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("train.log.3.gz", gzipBytes(t, "l1\nl2\n"))
+	write("train.log.2.zst", zstdBytes(t, "l3\n"))
+	write("train.log.2", []byte("l3\n")) // being compressed by logrotate
+	write("train.log.1", []byte("l4\r\nl5\n"))
+	write("train.log", []byte("l6\nl7"))
+	write("train.log.bak", []byte("unrelated\n"))
+	write("other.log.1", []byte("unrelated\n"))
+
+	live := filepath.Join(dir, "train.log")
+	want := []string{"train.log.3.gz", "train.log.2", "train.log.1", "train.log"}
+	var got []string
+	for _, p := range rotatedLogFamily(live) {
+		got = append(got, filepath.Base(p))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("family = %v, want %v", got, want)
+	}
+
+	lines, err := readLogTail(live, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if want := []string{"l1", "l2", "l3", "l4", "l5", "l6", "l7"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+	if lines, _ := readLogTail(live, 3); !reflect.DeepEqual(lines, []string{"l5", "l6", "l7"}) {
+		t.Fatalf("tail 3 should only span the newest generations, got %q", lines)
+	}
+
+	// Opening a generation shows it and the older ones, and never follows.
+	rotated := filepath.Join(dir, "train.log.2")
+	if lines, _ := readLogTail(rotated, 0); !reflect.DeepEqual(lines, []string{"l1", "l2", "l3"}) {
+		t.Fatalf("generation 2: got %q", lines)
+	}
+	if !isStaticLog(rotated) || isStaticLog(live) {
+		t.Fatalf("only rotated generations are static")
+	}
+}
+
+func TestPerTaskLogsAreNotRotatedGenerations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"log.1", "log.2", "log.3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task := filepath.Join(dir, "log.1")
+	if family := rotatedLogFamily(task); !reflect.DeepEqual(family, []string{task}) {
+		t.Fatalf("expected the task's log alone, got %v", family)
+	}
+	if isStaticLog(task) {
+		t.Fatalf("expected a per-task log to be followed")
+	}
+}
+
+func TestSplitRotatedNameIgnoresJobIDs(t *testing.T) {
+	for name, want := range map[string]int{
+		"train.log.1":     1,
+		"train.log.12.gz": 12,
+		"slurm-123.out":   0,
+		"output.4567890":  0,
+		"42.out.gz":       0,
+	} {
+		if _, got := splitRotatedName(name); got != want {
+			t.Errorf("splitRotatedName(%q) index = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestTailPlainFileSpansReadBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "line %05d %s\n", i, strings.Repeat("x", 20))
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := readLogTail(path, 5000)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(lines) != 5000 || !strings.HasPrefix(lines[0], "line 15000 ") || !strings.HasPrefix(lines[4999], "line 19999 ") {
+		t.Fatalf("unexpected tail: %d lines, first %q, last %q", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestLogSourceReadsChunksAcrossGenerations(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("train.log.2", gzipBytes(t, "l1\nl2\nl3\n"))
+	write("train.log.1", []byte("l4\nl5\nl6\n"))
+	write("train.log", []byte("l7\nl8\nl9\n"))
+	src := newLogSource(filepath.Join(dir, "train.log"))
+
+	tail, atStart, end, err := src.tail(2)
+	if err != nil || atStart || !reflect.DeepEqual(texts(tail), []string{"l8", "l9"}) {
+		t.Fatalf("tail: %q atStart=%v err=%v", texts(tail), atStart, err)
+	}
+	if end != (logPos{file: 2, offset: 9}) {
+		t.Fatalf("end = %+v", end)
+	}
+
+	earlier, atStart := src.linesBefore(tail[0].pos, 4)
+	if atStart || !reflect.DeepEqual(texts(earlier), []string{"l4", "l5", "l6", "l7"}) {
+		t.Fatalf("before l8: %q atStart=%v", texts(earlier), atStart)
+	}
+	earlier, atStart = src.linesBefore(earlier[0].pos, 10)
+	if !atStart || !reflect.DeepEqual(texts(earlier), []string{"l1", "l2", "l3"}) {
+		t.Fatalf("before l4: %q atStart=%v", texts(earlier), atStart)
+	}
+
+	later, next, atEnd, err := src.linesAfter(logPos{}, 4)
+	if err != nil || atEnd || !reflect.DeepEqual(texts(later), []string{"l1", "l2", "l3", "l4"}) {
+		t.Fatalf("after start: %q atEnd=%v err=%v", texts(later), atEnd, err)
+	}
+	later, next, atEnd, err = src.linesAfter(next, 10)
+	if err != nil || !atEnd || !reflect.DeepEqual(texts(later), []string{"l5", "l6", "l7", "l8", "l9"}) || next != end {
+		t.Fatalf("after l4: %q next=%+v atEnd=%v err=%v", texts(later), next, atEnd, err)
+	}
+
+	if pos, ok, _ := src.search(logPos{}, true, func(s string) bool { return s == "l5" }); !ok || pos != (logPos{file: 1, offset: 3}) {
+		t.Fatalf("forward search: %+v %v", pos, ok)
+	}
+	if pos, ok, _ := src.search(end, false, func(s string) bool { return s == "l2" }); !ok || pos != (logPos{file: 0, offset: 3}) {
+		t.Fatalf("backward search into compressed generation: %+v %v", pos, ok)
+	}
+	if _, ok, _ := src.search(tail[0].pos, false, func(s string) bool { return s == "l9" }); ok {
+		t.Fatalf("backward search must not find lines after its start")
+	}
+}
+
+func TestLogSourceSearchesBackwardsThroughLargeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "line %05d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := newLogSource(path)
+	end, _ := src.end()
+	pos, ok, err := src.search(end, false, func(s string) bool { return s == "line 00042" })
+	if err != nil || !ok || pos.offset != 42*int64(len("line 00000\n")) {
+		t.Fatalf("got %+v ok=%v err=%v", pos, ok, err)
+	}
+	lines, _, _, _ := src.linesAfter(pos, 2)
+	if !reflect.DeepEqual(texts(lines), []string{"line 00042", "line 00043"}) {
+		t.Fatalf("lines at match: %q", texts(lines))
+	}
+}
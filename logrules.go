@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// lineLevel is how a log rule classifies a line.
+type lineLevel uint8
+
+const (
+	levelNone    lineLevel = iota
+	levelChanged           // differs from the other job, in compare mode
+	levelWarning
+	levelError
+)
+
+const (
+	logLevelError   = "error"
+	logLevelWarning = "warning"
+)
+
+// LogRulesConfig is the "log_rules" section of the config file: patterns
+// that mark log lines as errors or warnings in the log view. They are added
+// to the built-in rules unless NoDefaults is set.
+type LogRulesConfig struct {
+	NoDefaults bool            `json:"no_defaults"`
+	Rules      []LogRuleConfig `json:"rules"`
+}
+
+type LogRuleConfig struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"` // Go regular expression
+	Level   string `json:"level"`   // "error" (default) or "warning"
+}
+
+func (c LogRulesConfig) validate() error {
+	for i, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r LogRuleConfig) validate() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return err
+	}
+	if _, ok := parseLineLevel(r.Level); !ok {
+		return fmt.Errorf("invalid level %q (want %q or %q)", r.Level, logLevelError, logLevelWarning)
+	}
+	return nil
+}
+
+func parseLineLevel(s string) (lineLevel, bool) {
+	switch s {
+	case "", logLevelError:
+		return levelError, true
+	case logLevelWarning:
+		return levelWarning, true
+	}
+	return levelNone, false
+}
+
+// defaultLogRules catch the usual ways HPC jobs die.
+var defaultLogRules = []LogRuleConfig{
+	{Name: "python traceback", Pattern: `^Traceback \(most recent call last\):`},
+	{Name: "python exception", Pattern: `^(?:[A-Za-z_][\w.]*\.)?[A-Za-z_]\w*(?:Error|Exception)(?::|$)`},
+	{Name: "cuda out of memory", Pattern: `CUDA out of memory|CUDA error: out of memory`},
+	{Name: "segmentation fault", Pattern: `Segmentation fault|SIGSEGV`},
+	{Name: "slurmstepd error", Pattern: `slurmstepd: error`},
+	{Name: "oom kill", Pattern: `(?i)\boom[-_ ]kill`},
+	{Name: "mpi abort", Pattern: `(?i)\bMPI_ABORT\b`},
+	{Name: "killed", Pattern: `(?:^|\s)Killed(?:\s|$)`},
+	{Name: "warning", Pattern: `(?i)warn(?:ing)?\b`, Level: logLevelWarning},
+}
+
+type logRule struct {
+	name  string
+	level lineLevel
+	re    *regexp.Regexp
+}
+
+// logRuleSet classifies log lines. The rules of each level are also joined
+// into a single regexp so lines are scanned once per level.
+type logRuleSet struct {
+	rules    []logRule
+	errors   *regexp.Regexp
+	warnings *regexp.Regexp
+}
+
+var defaultLogRuleSet = newLogRuleSet(LogRulesConfig{})
+
+// newLogRuleSet builds the rules of a validated config.
+func newLogRuleSet(cfg LogRulesConfig) *logRuleSet {
+	configs := cfg.Rules
+	if !cfg.NoDefaults {
+		configs = append(append([]LogRuleConfig(nil), defaultLogRules...), cfg.Rules...)
+	}
+	s := &logRuleSet{}
+	var errorExprs, warningExprs []string
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Pattern)
+		level, ok := parseLineLevel(c.Level)
+		if err != nil || !ok {
+			continue
+		}
+		name := c.Name
+		if name == "" {
+			name = c.Pattern
+		}
+		s.rules = append(s.rules, logRule{name: name, level: level, re: re})
+		// Groups keep flags like (?i) local to their rule.
+		if level == levelError {
+			errorExprs = append(errorExprs, "(?:"+c.Pattern+")")
+		} else {
+			warningExprs = append(warningExprs, "(?:"+c.Pattern+")")
+		}
+	}
+	if len(errorExprs) > 0 {
+		s.errors = regexp.MustCompile(strings.Join(errorExprs, "|"))
+	}
+	if len(warningExprs) > 0 {
+		s.warnings = regexp.MustCompile(strings.Join(warningExprs, "|"))
+	}
+	return s
+}
+
+// classify returns the highest level of the rules matching a line.
+func (s *logRuleSet) classify(line string) lineLevel {
+	switch {
+	case s == nil || line == "":
+		return levelNone
+	case s.errors != nil && s.errors.MatchString(line):
+		return levelError
+	case s.warnings != nil && s.warnings.MatchString(line):
+		return levelWarning
+	}
+	return levelNone
+}
+
+var (
+	logErrorStyle   = lipgloss.NewStyle().Foreground(danger)
+	logWarningStyle = lipgloss.NewStyle().Foreground(accentOrange)
+	logChangedStyle = lipgloss.NewStyle().Foreground(accentCyan)
+	logMarkerTrack  = lipgloss.NewStyle().Foreground(panelBorder).Render("┃")
+)
+
+// logMarkerWidth is the column beside each pane marking where its errors
+// and warnings are.
+const logMarkerWidth = 1
+
+func (l lineLevel) style() (lipgloss.Style, bool) {
+	switch l {
+	case levelError:
+		return logErrorStyle, true
+	case levelWarning:
+		return logWarningStyle, true
+	case levelChanged:
+		return logChangedStyle, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// classifyLines returns the level of each line of a pane.
+func (m *TailModel) classifyLines(pane string, lines []string) []lineLevel {
+	levels := make([]lineLevel, len(lines))
+	for i, line := range lines {
+		levels[i] = m.classifyLine(pane, line)
+	}
+	return levels
+}
+
+// classifyLine classifies a line of a pane. Rules see the line as logged,
+// without the merged pane's source tag and timestamp.
+func (m *TailModel) classifyLine(pane, line string) lineLevel {
+	if pane == "merged" {
+		if _, text, ok := strings.Cut(line, "│ "); ok {
+			line = text
+		}
+	}
+	return m.rules.classify(stripANSI(line))
+}
+
+// renderLogMarkers draws the marker column of a pane: the whole pane is
+// scaled to the view's height, errors and warnings are marked where they
+// are and the visible part is shown as a track.
+func (m TailModel) renderLogMarkers(pane string) string {
+	refs := m.paneRefs(pane)
+	wrapped, levels, vp := *refs.wrapped, *refs.levels, refs.view
+	height := vp.Height
+	if height <= 0 {
+		return ""
+	}
+	total := lineOffset(wrapped, len(wrapped))
+	scale := total
+	if scale < height {
+		scale = height
+	}
+	row := func(visual int) int {
+		return visual * height / scale
+	}
+
+	marks := make([]lineLevel, height)
+	visual := 0
+	for i, block := range wrapped {
+		if i < len(levels) && levels[i] > marks[row(visual)] {
+			marks[row(visual)] = levels[i]
+		}
+		visual += visualLineCount(block)
+	}
+
+	first, last := row(vp.YOffset), row(vp.YOffset+height-1)
+	rows := make([]string, height)
+	for r := range rows {
+		if style, ok := marks[r].style(); ok {
+			rows[r] = style.Render("▌")
+		} else if total > height && r >= first && r <= last {
+			rows[r] = logMarkerTrack
+		} else {
+			rows[r] = " "
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// levelCounts counts the errors and warnings shown in a pane.
+func (m *TailModel) levelCounts(pane string) (errors, warnings int) {
+	for _, l := range *m.paneRefs(pane).levels {
+		switch l {
+		case levelError:
+			errors++
+		case levelWarning:
+			warnings++
+		}
+	}
+	return errors, warnings
+}
+
+// jumpToError shows the next (or previous) error line at the top of its
+// pane. In the dual view the search moves on to the other pane when the
+// focused one has no more errors, and wraps around.
+func (m *TailModel) jumpToError(forward bool) bool {
+	panes := []string{m.focusedPane()}
+	if m.mode == TailModeBoth {
+		other := "stderr"
+		if panes[0] == "stderr" {
+			other = "stdout"
+		}
+		panes = append(panes, other, panes[0])
+	} else {
+		panes = append(panes, panes[0])
+	}
+
+	for n, pane := range panes {
+		refs := m.paneRefs(pane)
+		levels := *refs.levels
+		// Only the focused pane starts from the current line.
+		current := -1
+		if !forward {
+			current = len(levels)
+		}
+		if n == 0 {
+			current = lineAtOffset(*refs.wrapped, refs.view.YOffset)
+		}
+		step := 1
+		if !forward {
+			step = -1
+		}
+		for i := current + step; i >= 0 && i < len(levels); i += step {
+			if levels[i] != levelError {
+				continue
+			}
+			if m.mode == TailModeBoth {
+				m.activePane = 0
+				if pane == "stderr" {
+					m.activePane = 1
+				}
+			}
+			m.following = false
+			refs.view.SetYOffset(lineOffset(*refs.wrapped, i))
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDefaultLogRulesClassifyCommonFailures(t *testing.T) {
+	cases := []struct {
+		line string
+		want lineLevel
+	}{
+		{"Traceback (most recent call last):", levelError},
+		{"RuntimeError: CUDA out of memory. Tried to allocate 2.00 GiB", levelError},
+		{"torch.cuda.OutOfMemoryError: CUDA out of memory.", levelError},
+		{"/var/spool/slurmd/job123/slurm_script: line 12: 4242 Segmentation fault (core dumped) ./sim", levelError},
+		{"slurmstepd: error: Detected 1 oom-kill event(s) in StepId=123.batch.", levelError},
+		{"MPI_ABORT was invoked on rank 3 in communicator MPI_COMM_WORLD", levelError},
+		{"line 7: 1234 Killed python train.py", levelError},
+		{"UserWarning: TypedStorage is deprecated", levelWarning},
+		{"WARNING: no GPU found, falling back to CPU", levelWarning},
+		{"epoch 3 loss=0.25", levelNone},
+		{"skilled workers", levelNone},
+	}
+	for _, c := range cases {
+		if got := defaultLogRuleSet.classify(c.line); got != c.want {
+			t.Errorf("classify(%q) = %d, want %d", c.line, got, c.want)
+		}
+	}
+}
+
+func TestParseConfigLogRules(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"log_rules": {"rules": [{"pattern": "(unclosed"}]}}`), "config.json"); err == nil {
+		t.Fatalf("expected an invalid pattern to be rejected")
+	}
+	if _, err := parseConfig([]byte(`{"log_rules": {"rules": [{"pattern": "x", "level": "fatal"}]}}`), "config.json"); err == nil {
+		t.Fatalf("expected an invalid level to be rejected")
+	}
+	cfg, err := parseConfig([]byte(`{"log_rules": {"no_defaults": true, "rules": [{"name": "nan", "pattern": "(?i)loss=nan", "level": "warning"}]}}`), "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := newLogRuleSet(cfg.LogRules)
+	if rules.classify("step 9 LOSS=NaN") != levelWarning || rules.classify("Segmentation fault") != levelNone {
+		t.Fatalf("expected only the configured rule to apply")
+	}
+}
+
+func TestTailJumpsBetweenErrorsAcrossPanes(t *testing.T) {
+	m := NewTailModel("1", "", "", 120, 20, TailModeBoth)
+	for i := 0; i < 60; i++ {
+		out := fmt.Sprintf("step %d", i)
+		if i == 20 {
+			out = "Traceback (most recent call last):"
+		}
+		m.stdoutLines = append(m.stdoutLines, out)
+		m.stderrLines = append(m.stderrLines, fmt.Sprintf("log %d", i))
+	}
+	m.refreshViewportContent()
+	m.appendLogLine("stderr", &m.stderrLines, &m.wrappedStderr, m.stderrBuilder, &m.stderrView, "slurmstepd: error: *** JOB 1 CANCELLED ***")
+	for i := 0; i < 30; i++ {
+		m.appendLogLine("stderr", &m.stderrLines, &m.wrappedStderr, m.stderrBuilder, &m.stderrView, "after")
+	}
+
+	if errors, _ := m.levelCounts("stderr"); errors != 1 {
+		t.Fatalf("expected the appended line to be classified, got %d errors", errors)
+	}
+	top := func(pane string) string {
+		refs := m.paneRefs(pane)
+		return (*refs.lines)[lineAtOffset(*refs.wrapped, refs.view.YOffset)]
+	}
+
+	if !m.jumpToError(true) || m.activePane != 0 || top("stdout") != "Traceback (most recent call last):" {
+		t.Fatalf("expected to jump to the stdout traceback")
+	}
+	if !m.jumpToError(true) || m.activePane != 1 || top("stderr") != "slurmstepd: error: *** JOB 1 CANCELLED ***" {
+		t.Fatalf("expected to move on to the stderr error")
+	}
+	if !m.jumpToError(true) || m.activePane != 0 {
+		t.Fatalf("expected to wrap around to stdout")
+	}
+	if !m.jumpToError(false) || m.activePane != 1 {
+		t.Fatalf("expected the previous error to be in stderr")
+	}
+}
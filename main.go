@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -71,6 +72,9 @@ type KeyMap struct {
 	TailLogs     key.Binding
 	TailStdout   key.Binding // New
 	TailStderr   key.Binding // New
+	Compare      key.Binding
+	MarkJob      key.Binding
+	MultiTail    key.Binding
 	Filter       key.Binding
 	Pause        key.Binding
 	Refresh      key.Binding
@@ -78,9 +82,10 @@ type KeyMap struct {
 	StatusFilter key.Binding
 	CopyValue    key.Binding
 	ViewValue    key.Binding
+	Browse       key.Binding
+	Palette      key.Binding
 	Up           key.Binding
 	Down         key.Binding
-	Enter        key.Binding
 	SwitchFocus  key.Binding
 	ToggleMouse  key.Binding
 	ToggleHelp   key.Binding
@@ -93,6 +98,9 @@ var keys = KeyMap{
 	TailLogs:     key.NewBinding(key.WithKeys("l", "L"), key.WithHelp("l", "tail logs")),
 	TailStdout:   key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "stdout")),
 	TailStderr:   key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "stderr")),
+	Compare:      key.NewBinding(key.WithKeys("="), key.WithHelp("=", "compare logs")),
+	MarkJob:      key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "mark job")),
+	MultiTail:    key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "tail marked/array")),
 	Filter:       key.NewBinding(key.WithKeys("f", "/"), key.WithHelp("f", "filter")),
 	Pause:        key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "pause")),
 	Refresh:      key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "refresh")),
@@ -100,6 +108,8 @@ var keys = KeyMap{
 	StatusFilter: key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "status filter")),
 	CopyValue:    key.NewBinding(key.WithKeys("ctrl+y"), key.WithHelp("^y", "copy detail")),
 	ViewValue:    key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "view value")),
+	Browse:       key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "work dir")),
+	Palette:      key.NewBinding(key.WithKeys(":", "ctrl+p"), key.WithHelp(":/^p", "commands")),
 	Up:           key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
 	Down:         key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
 	SwitchFocus:  key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "switch focus")),
@@ -108,14 +118,14 @@ var keys = KeyMap{
 }
 
 func (k KeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Quit, k.Filter, k.Refresh, k.InspectJob, k.TailLogs, k.TailStdout, k.TailStderr, k.SwitchFocus, k.ToggleMouse, k.ToggleHelp}
+	return []key.Binding{k.Quit, k.Filter, k.Refresh, k.InspectJob, k.TailLogs, k.TailStdout, k.TailStderr, k.SwitchFocus, k.Palette, k.ToggleHelp}
 }
 
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.InspectJob, k.CancelJob},
-		{k.Filter, k.StatusFilter, k.History, k.Refresh},
-		{k.TailLogs, k.TailStdout, k.TailStderr, k.CopyValue, k.ViewValue, k.SwitchFocus, k.ToggleMouse, k.ToggleHelp, k.Pause, k.Quit},
+		{k.Filter, k.StatusFilter, k.History, k.Refresh, k.Palette},
+		{k.TailLogs, k.TailStdout, k.TailStderr, k.Compare, k.MarkJob, k.MultiTail, k.Browse, k.CopyValue, k.ViewValue, k.SwitchFocus, k.ToggleMouse, k.ToggleHelp, k.Pause, k.Quit},
 	}
 }
 
@@ -124,6 +134,16 @@ type jobsMsg []Job
 type detailsMsg string
 type errMsg error
 type refreshNowMsg struct{}
+
+// observedJobsMsg carries the live queue polled for hooks and archiving
+// only, while the table is not refreshed.
+type observedJobsMsg []Job
+
+// finalStatesMsg carries the sacct records of jobs that left the live queue.
+type finalStatesMsg struct {
+	ids  []string
+	jobs []Job
+}
 type tailPathsMsg struct {
 	jobID          string
 	stdout, stderr string
@@ -140,6 +160,11 @@ type Model struct {
 
 	tailModel  TailModel
 	inTailView bool
+
+	// Multi-job log view, and the jobs marked for it.
+	multiTail   MultiTailModel
+	inMultiTail bool
+	marked      map[string]bool
 	// Full-screen details view (useful when details panel is hidden on small windows).
 	inDetailsOverlay bool
 	// Full-screen single value view (for long detail values).
@@ -147,6 +172,10 @@ type Model struct {
 	valueView      viewport.Model
 	valueKey       string
 	valueValue     string
+	// File browser over the working directory of a job.
+	browser *fileBrowser
+	// Command palette, over the main or the log view.
+	palette *commandPalette
 
 	jobs       []Job
 	filtered   []Job
@@ -158,9 +187,16 @@ type Model struct {
 	confirmingCancel bool
 	cancelCandidate  *Job
 
+	// Job marked to compare logs with, and the prompt for the ID of the
+	// job to compare it with.
+	compareBase   string
+	comparePrompt bool
+	compareInput  textinput.Model
+
 	appMode     mode
 	paused      bool
 	sFilter     statusFilter
+	fieldFilter map[string]string // field=value filters of :filter, lower-cased
 	loadingJobs bool
 	historyDays int
 
@@ -183,12 +219,43 @@ type Model struct {
 	inputMode    bool   // if true, focus on filter input
 	mouseEnabled bool
 
+	// Failure diagnosis of a job in history mode, shown atop its details.
+	diagnosis diagnosisMsg
+
 	// Saved main-view mouse setting before entering tail view. Tail view may
 	// auto-disable mouse for easier text selection/copying.
 	mouseEnabledBeforeTail bool
 
 	copyFeedback       string
 	copyFeedbackExpiry time.Time
+
+	// Job state tracking for hooks and log archiving. tracker is a pointer
+	// so every copy of the model shares the same history.
+	tracker  *jobTracker
+	hooks    *HookDispatcher
+	archiver *LogArchiver
+
+	// Local job history database; nil when disabled.
+	store *jobStore
+
+	// Log view searches, kept across log views for the session.
+	searchHistory *searchHistory
+
+	// Rules marking errors and warnings in logs.
+	logRules *logRuleSet
+
+	// Extracts the metrics plotted in the log view.
+	metricExtractor *metricExtractor
+
+	// Latest progress bar state of running jobs, by job ID, when their logs
+	// were last written, and where their logs are.
+	progress   map[string]string
+	lastOutput map[string]time.Time
+	logPaths   *logPathCache
+
+	// Running jobs silent for stallAfter are flagged as possibly stalled.
+	stallAfter time.Duration
+	stalls     *stallTracker
 }
 
 func NewModel() Model {
@@ -213,6 +280,7 @@ func NewModel() Model {
 	s.Header = tableHeaderStyle
 	s.Selected = tableSelectedStyle
 	t.SetStyles(s)
+	t.KeyMap = tableKeyMap()
 
 	// Details Table setup
 	detailsCols := []table.Column{
@@ -229,6 +297,7 @@ func NewModel() Model {
 	dtStyles.Header = tableHeaderStyle
 	dtStyles.Selected = tableSelectedStyle
 	dt.SetStyles(dtStyles)
+	dt.KeyMap = tableKeyMap()
 
 	// Input setup
 	ti := textinput.New()
@@ -242,15 +311,23 @@ func NewModel() Model {
 	ti.Cursor.Style = lipgloss.NewStyle().Foreground(highlight)
 
 	m := Model{
-		table:        t,
-		detailsTable: dt,
-		filterInput:  ti,
-		help:         help.New(),
-		appMode:      modeLive,
-		sFilter:      filterAll,
-		fullColumns:  columns,
-		mouseEnabled: false,
-		historyDays:  historyDaysFromEnv(),
+		table:         t,
+		detailsTable:  dt,
+		filterInput:   ti,
+		help:          help.New(),
+		appMode:       modeLive,
+		sFilter:       filterAll,
+		fullColumns:   columns,
+		mouseEnabled:  false,
+		historyDays:   historyDaysFromEnv(),
+		tracker:       newJobTracker(),
+		searchHistory: &searchHistory{},
+		logRules:      defaultLogRuleSet,
+		logPaths:      newLogPathCache(),
+		stallAfter:    stallAfterFromEnv(),
+		stalls:        newStallTracker(),
+
+		metricExtractor: defaultMetricExtractor,
 	}
 
 	width, height := detectTerminalSize()
@@ -280,29 +357,46 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if _, ok := msg.(tickMsg); ok {
 		handledTick = true
 		// While tailing logs we still keep the tick loop alive so the app
-		// continues to refresh normally after exiting, but we avoid polling
-		// Slurm in the background.
-		if !m.paused && !m.inTailView {
+		// continues to refresh normally after exiting, but we leave the
+		// table as it is: the queue is only polled for hooks and archiving.
+		if !m.paused && !m.inTailView && !m.inMultiTail {
 			cmds = append(cmds, m.fetchJobsCmd())
+		} else {
+			cmds = append(cmds, m.pollObservedJobsCmd())
 		}
 		cmds = append(cmds, m.tickCmd())
 
-		if m.inTailView {
+		if m.inTailView || m.inMultiTail {
 			return m, tea.Batch(cmds...)
 		}
 	}
 
+	// Job events fire whatever view is open.
+	switch msg := msg.(type) {
+	case observedJobsMsg:
+		return m, m.observeJobsCmd(msg)
+	case finalStatesMsg:
+		m.handleJobEvents(m.tracker.Resolve(msg.ids, msg.jobs))
+		return m, nil
+	}
+
+	if m.palette != nil {
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			return m.updatePalette(keyMsg)
+		}
+	}
+
 	if m.confirmingCancel {
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
-			switch keyMsg.String() {
-			case "y", "Y":
+			switch {
+			case key.Matches(keyMsg, dialogKeys.Yes):
 				m.confirmingCancel = false
 				if m.cancelCandidate != nil {
 					cmds = append(cmds, m.cancelJobCmd(m.cancelCandidate.JobID))
 					m.cancelCandidate = nil
 				}
 				return m, tea.Batch(cmds...)
-			case "n", "N", "esc", "q":
+			case key.Matches(keyMsg, dialogKeys.No, dialogKeys.Back, dialogKeys.Close):
 				m.confirmingCancel = false
 				m.cancelCandidate = nil
 				return m, nil
@@ -311,6 +405,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if m.comparePrompt {
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			return m.updateComparePrompt(keyMsg)
+		}
+		if _, ok := msg.(tea.WindowSizeMsg); !ok {
+			return m, nil
+		}
+	}
+
 	if m.inValueOverlay && !handledTick {
 		switch msg := msg.(type) {
 		case tea.WindowSizeMsg:
@@ -346,8 +449,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.configureValueViewport()
 				return m, nil
 			}
-			switch msg.String() {
-			case "esc", "q", "v":
+			if key.Matches(msg, dialogKeys.Back, dialogKeys.Close, keys.ViewValue) {
 				m.inValueOverlay = false
 				m.applyWindowSize(m.width, m.height)
 				return m, nil
@@ -398,9 +500,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, tea.Batch(cmds...)
 				}
 			}
-			// In overlay mode, treat Esc/q/i as "close overlay" instead of quitting.
-			switch msg.String() {
-			case "esc", "q", "i":
+			// In overlay mode, treat Esc/q/i as "close overlay" instead of
+			// quitting; Enter does not close it.
+			if key.Matches(msg, dialogKeys.Back, dialogKeys.Close) || key.Matches(msg, keys.InspectJob) && !key.Matches(msg, dialogKeys.Confirm) {
 				m.inDetailsOverlay = false
 				// Re-apply layout so widths/heights go back to normal.
 				m.applyWindowSize(m.width, m.height)
@@ -414,42 +516,61 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 	}
 
+	if m.inMultiTail && !handledTick {
+		switch msg.(type) {
+		case tea.WindowSizeMsg, tailStartMsg, logLineMsg, scrollbackMsg, jobLogsMsg:
+			if m.inTailView {
+				// The log view the files were picked in keeps following.
+				var newTail tea.Model
+				newTail, cmd = m.tailModel.Update(msg)
+				m.tailModel = newTail.(TailModel)
+				cmds = append(cmds, cmd)
+			}
+		}
+		var newMulti tea.Model
+		newMulti, cmd = m.multiTail.Update(msg)
+		m.multiTail = newMulti.(MultiTailModel)
+		cmds = append(cmds, cmd)
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, tailKeys.ToggleHelp):
+				m.help.ShowAll = !m.help.ShowAll
+			case key.Matches(msg, tailKeys.Quit):
+				m.inMultiTail = false
+				if !m.inTailView {
+					cmds = append(cmds, m.fetchJobsCmd())
+				}
+			}
+		}
+		return m, tea.Batch(cmds...)
+	}
+
 	if m.inTailView && !handledTick {
-		wasInSearchMode := m.tailModel.InSearchMode()
+		switch msg := msg.(type) {
+		case multiTailPathsMsg:
+			// Files picked in the log view open over it.
+			return m, m.openMultiTail(msg)
+		case multiStartMsg:
+			// A file opened after the multi-log view was closed.
+			return m, closeFollowerCmd(msg.start.follower)
+		}
+		wasInOverlay := m.tailModel.InOverlay()
 
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
-			if key.Matches(msg, tailKeys.ToggleHelp) && !wasInSearchMode {
+			if key.Matches(msg, tailKeys.ToggleHelp) && !wasInOverlay {
 				m.help.ShowAll = !m.help.ShowAll
 				return m, nil
 			}
-			if key.Matches(msg, tailKeys.Quit) && !wasInSearchMode {
-				m.inTailView = false
-				// Restore the pre-tail mouse setting (tail view may have
-				// auto-disabled it).
-				if m.mouseEnabled != m.mouseEnabledBeforeTail {
-					m.mouseEnabled = m.mouseEnabledBeforeTail
-					if m.mouseEnabled {
-						cmds = append(cmds, tea.EnableMouseCellMotion)
-					} else {
-						cmds = append(cmds, tea.DisableMouse)
-					}
-				}
-				// Re-trigger a job refresh when coming back
-				cmds = append(cmds, m.fetchJobsCmd())
-				// Refresh details to clear "Resolving logs..." status
-				if m.selectedID != "" {
-					cmds = append(cmds, m.fetchDetailsCmd(m.selectedID))
-				}
+			if key.Matches(msg, tailKeys.Palette) && !wasInOverlay {
+				return m, m.openPalette(true)
+			}
+			if key.Matches(msg, tailKeys.Quit) && !wasInOverlay {
+				cmds = append(cmds, m.leaveTailView()...)
 			}
 			// Capture mouse toggle from tail view to keep state in sync
-			if key.Matches(msg, tailKeys.ToggleMouse) && !wasInSearchMode {
-				m.mouseEnabled = !m.mouseEnabled
-				if m.mouseEnabled {
-					cmds = append(cmds, tea.EnableMouseCellMotion)
-				} else {
-					cmds = append(cmds, tea.DisableMouse)
-				}
+			if key.Matches(msg, tailKeys.ToggleMouse) && !wasInOverlay {
+				cmds = append(cmds, m.toggleMouse())
 				// TailModel also needs to handle this to update its UI, so we continue
 			}
 		}
@@ -465,7 +586,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		// Double check if we should exit based on the msg that was processed
-		if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, tailKeys.Quit) && !wasInSearchMode {
+		if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, tailKeys.Quit) && !wasInOverlay {
 			m.inTailView = false
 			// Restore the pre-tail mouse setting (tail view may have
 			// auto-disabled it).
@@ -487,7 +608,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 	}
 
+	if m.browser != nil && !handledTick {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			return m.updateBrowser(msg)
+		}
+	}
+
 	switch msg := msg.(type) {
+	case scrollbackMsg:
+		// A load finished after the tail view was closed.
+		return m, closeFollowerCmd(msg.follower)
+	case multiStartMsg:
+		// A log opened after the multi-job view was closed.
+		return m, closeFollowerCmd(msg.start.follower)
 	case tea.WindowSizeMsg:
 		// Some terminals briefly report zero dimensions (e.g. during font or window
 		// changes). Instead of ignoring these events entirely – which can leave the
@@ -520,6 +653,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.lastRefresh = time.Now()
 		m.loadingJobs = false
 		m.updateTable()
+		cmds = append(cmds, m.observeJobsCmd(msg), m.progressCmd(msg))
 
 		// Sync selection immediately
 		sel := m.table.SelectedRow()
@@ -540,6 +674,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.rawDetails = string(msg)
 		m.updateDetailsTable(m.rawDetails)
 
+	case progressMsg:
+		m.progress, m.lastOutput = msg.progress, msg.lastOutput
+		m.handleJobEvents(m.stalls.observe(m.jobs, m.lastOutput, m.stallAfter, time.Now()))
+		m.updateTable()
+
+	case diagnosisMsg:
+		m.diagnosis = msg
+		m.updateDetailsTable(m.rawDetails)
+
 	case tailPathsMsg:
 		// Use the job ID associated with the request; selection may have
 		// changed while paths were resolving.
@@ -550,11 +693,27 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.err != nil {
 			m.err = msg.err
 		}
-		m.mouseEnabledBeforeTail = m.mouseEnabled
-		m.tailModel = NewTailModel(m.selectedID, msg.stdout, msg.stderr, m.width, m.height, msg.mode)
-		m.tailModel.mouseEnabled = m.mouseEnabled // Sync state
-		m.inTailView = true
-		cmds = append(cmds, m.tailModel.Init())
+		cmds = append(cmds, m.openTailView(NewTailModel(m.selectedID, msg.stdout, msg.stderr, m.width, m.height, msg.mode)))
+
+	case multiTailPathsMsg:
+		cmds = append(cmds, m.openMultiTail(msg))
+
+	case workDirMsg:
+		if msg.err != nil {
+			m.detailsTable.SetRows([]table.Row{{"Status", msg.err.Error()}})
+			break
+		}
+		m.browser = newFileBrowser(msg.jobID, msg.dir)
+		if m.selectedID != "" {
+			// Clears the "Resolving working directory..." status.
+			cmds = append(cmds, m.fetchDetailsCmd(m.selectedID))
+		}
+
+	case comparePathsMsg:
+		if msg.err != nil {
+			m.err = msg.err
+		}
+		cmds = append(cmds, m.openTailView(NewCompareTailModel(msg.jobs, msg.stdout, msg.stderr, m.width, m.height)))
 
 	case errMsg:
 		m.err = msg
@@ -591,8 +750,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tea.KeyMsg:
 		if m.inputMode {
-			switch msg.String() {
-			case "enter", "esc":
+			switch {
+			case key.Matches(msg, dialogKeys.Confirm, dialogKeys.Back):
 				m.inputMode = false
 				m.table.Focus()
 				m.filterInput.Blur()
@@ -602,113 +761,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.updateTable()
 				return m, tea.Batch(cmds...)
 			}
-		} else {
-			switch {
-			case key.Matches(msg, keys.ToggleHelp):
-				m.help.ShowAll = !m.help.ShowAll
-				m.applyWindowSize(m.width, m.height)
-				return m, nil
-			case key.Matches(msg, keys.Quit):
-				return m, tea.Quit
-			case key.Matches(msg, keys.Filter):
-				m.inputMode = true
-				m.filterInput.Focus()
-				m.table.Blur()
-				return m, nil
-			case key.Matches(msg, keys.Pause):
-				m.paused = !m.paused
-			case key.Matches(msg, keys.Refresh):
-				cmds = append(cmds, m.fetchJobsCmd())
-			case key.Matches(msg, keys.History):
-				m.loadingJobs = true
-				if m.appMode == modeLive {
-					m.appMode = modeHistory
-				} else {
-					m.appMode = modeLive
-				}
-				cmds = append(cmds, m.fetchJobsCmd())
-				cmds = append(cmds, func() tea.Msg {
-					return tea.WindowSizeMsg{Width: m.width, Height: m.height}
-				})
-			case key.Matches(msg, keys.StatusFilter):
-				m.sFilter = (m.sFilter + 1) % 3
-				m.updateTable()
-			case key.Matches(msg, keys.InspectJob):
-				job := m.getSelectedJob()
-				if job != nil {
-					// In small windows the details panel is hidden; use a full-screen overlay.
-					if m.hideDetails {
-						m.inDetailsOverlay = true
-						m.detailsTable.Focus()
-						m.table.Blur()
-						cmds = append(cmds, m.fetchDetailsCmd(job.JobID))
-						// Force layout recalculation so the overlay columns fit the window.
-						m.applyWindowSize(m.width, m.height)
-						return m, tea.Batch(cmds...)
-					}
-					cmds = append(cmds, m.fetchDetailsCmd(job.JobID))
-				}
-			case key.Matches(msg, keys.CancelJob):
-				job := m.getSelectedJob()
-				if job != nil {
-					m.cancelCandidate = job
-					m.confirmingCancel = true
-				}
-			case key.Matches(msg, keys.TailLogs):
-				job := m.getSelectedJob()
-				if job != nil {
-					// Provide feedback in details table immediately
-					m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
-					// Trigger the command
-					cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeBoth))
-				}
-			case key.Matches(msg, keys.TailStdout):
-				job := m.getSelectedJob()
-				if job != nil {
-					m.detailsTable.SetRows([]table.Row{{"Status", "Resolving stdout..."}})
-					cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeStdout))
-				}
-			case key.Matches(msg, keys.TailStderr):
-				job := m.getSelectedJob()
-				if job != nil {
-					m.detailsTable.SetRows([]table.Row{{"Status", "Resolving stderr..."}})
-					cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeStderr))
-				}
-			case key.Matches(msg, keys.SwitchFocus):
-				if m.hideDetails {
-					// Details panel isn't visible; keep focus on the jobs table.
-					m.table.Focus()
-					m.detailsTable.Blur()
-					break
-				}
-				if m.table.Focused() {
-					m.table.Blur()
-					m.detailsTable.Focus()
-				} else {
-					m.detailsTable.Blur()
-					m.table.Focus()
-				}
-			case key.Matches(msg, keys.ToggleMouse):
-				m.mouseEnabled = !m.mouseEnabled
-				if m.mouseEnabled {
-					cmds = append(cmds, tea.EnableMouseCellMotion)
-				} else {
-					cmds = append(cmds, tea.DisableMouse)
-				}
-			case key.Matches(msg, keys.CopyValue):
-				if m.hideDetails {
-					m.copyFeedback = "Open details ('i') to copy values"
-					m.copyFeedbackExpiry = time.Now().Add(2 * time.Second)
-					break
-				}
-				if cmd := m.copySelectedDetailCmd(); cmd != nil {
-					cmds = append(cmds, cmd)
-				}
-			case key.Matches(msg, keys.ViewValue):
-				if cmd := m.openValueOverlayCmd(); cmd != nil {
-					cmds = append(cmds, cmd)
-					return m, tea.Batch(cmds...)
-				}
+		} else if action := pressedAction(msg, &keys); action != nil {
+			actionCmd, done := m.handleAction(action)
+			cmds = append(cmds, actionCmd)
+			if done {
+				return m, tea.Batch(cmds...)
 			}
 		}
 	}
@@ -738,7 +795,186 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// handleAction runs an action of the main view. done reports that the
+// action is complete; otherwise its key also goes to the tables.
+func (m *Model) handleAction(action *key.Binding) (cmd tea.Cmd, done bool) {
+	var cmds []tea.Cmd
+	switch {
+	case action == &keys.ToggleHelp:
+		m.help.ShowAll = !m.help.ShowAll
+		m.applyWindowSize(m.width, m.height)
+		return nil, true
+	case action == &keys.Quit:
+		return tea.Quit, true
+	case action == &keys.Palette:
+		return m.openPalette(false), true
+	case action == &keys.Filter:
+		m.inputMode = true
+		m.filterInput.Focus()
+		m.table.Blur()
+		return nil, true
+	case action == &keys.Pause:
+		m.paused = !m.paused
+	case action == &keys.Refresh:
+		cmds = append(cmds, m.fetchJobsCmd())
+	case action == &keys.History:
+		if m.appMode == modeLive {
+			cmds = append(cmds, m.switchMode(modeHistory))
+		} else {
+			cmds = append(cmds, m.switchMode(modeLive))
+		}
+	case action == &keys.StatusFilter:
+		m.sFilter = (m.sFilter + 1) % 3
+		m.updateTable()
+	case action == &keys.InspectJob:
+		job := m.getSelectedJob()
+		if job != nil {
+			// In small windows the details panel is hidden; use a full-screen overlay.
+			if m.hideDetails {
+				m.inDetailsOverlay = true
+				m.detailsTable.Focus()
+				m.table.Blur()
+				cmds = append(cmds, m.fetchDetailsCmd(job.JobID))
+				// Force layout recalculation so the overlay columns fit the window.
+				m.applyWindowSize(m.width, m.height)
+				return tea.Batch(cmds...), true
+			}
+			cmds = append(cmds, m.fetchDetailsCmd(job.JobID))
+		}
+	case action == &keys.CancelJob:
+		job := m.getSelectedJob()
+		if job != nil {
+			m.cancelCandidate = job
+			m.confirmingCancel = true
+		}
+	case action == &keys.TailLogs:
+		job := m.getSelectedJob()
+		if job != nil {
+			// Provide feedback in details table immediately
+			m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
+			// Trigger the command
+			cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeBoth))
+		}
+	case action == &keys.TailStdout:
+		job := m.getSelectedJob()
+		if job != nil {
+			m.detailsTable.SetRows([]table.Row{{"Status", "Resolving stdout..."}})
+			cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeStdout))
+		}
+	case action == &keys.TailStderr:
+		job := m.getSelectedJob()
+		if job != nil {
+			m.detailsTable.SetRows([]table.Row{{"Status", "Resolving stderr..."}})
+			cmds = append(cmds, m.resolveTailPathsCmd(job.JobID, TailModeStderr))
+		}
+	case action == &keys.Browse:
+		if job := m.getSelectedJob(); job != nil {
+			m.detailsTable.SetRows([]table.Row{{"Status", "Resolving working directory..."}})
+			cmds = append(cmds, m.resolveWorkDirCmd(job.JobID))
+		}
+	case action == &keys.Compare:
+		if job := m.getSelectedJob(); job != nil {
+			*m, cmd = m.markOrCompare(job)
+			cmds = append(cmds, cmd)
+		}
+	case action == &keys.MarkJob:
+		if job := m.getSelectedJob(); job != nil {
+			if m.marked[job.JobID] {
+				delete(m.marked, job.JobID)
+			} else {
+				if m.marked == nil {
+					m.marked = make(map[string]bool)
+				}
+				m.marked[job.JobID] = true
+			}
+			m.updateTable()
+		}
+	case action == &keys.MultiTail:
+		ids := m.multiTailTargets()
+		if len(ids) == 0 {
+			m.detailsTable.SetRows([]table.Row{{"Status", "Mark jobs with x, or select a task of an array job"}})
+			break
+		}
+		m.detailsTable.SetRows([]table.Row{{"Status", fmt.Sprintf("Resolving logs of %d jobs...", len(ids))}})
+		cmds = append(cmds, m.resolveMultiTailCmd(ids))
+	case action == &keys.SwitchFocus:
+		if m.hideDetails {
+			// Details panel isn't visible; keep focus on the jobs table.
+			m.table.Focus()
+			m.detailsTable.Blur()
+			break
+		}
+		if m.table.Focused() {
+			m.table.Blur()
+			m.detailsTable.Focus()
+		} else {
+			m.detailsTable.Blur()
+			m.table.Focus()
+		}
+	case action == &keys.ToggleMouse:
+		cmds = append(cmds, m.toggleMouse())
+	case action == &keys.CopyValue:
+		if m.hideDetails {
+			m.copyFeedback = "Open details ('i') to copy values"
+			m.copyFeedbackExpiry = time.Now().Add(2 * time.Second)
+			break
+		}
+		if cmd := m.copySelectedDetailCmd(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	case action == &keys.ViewValue:
+		if cmd := m.openValueOverlayCmd(); cmd != nil {
+			cmds = append(cmds, cmd)
+			return tea.Batch(cmds...), true
+		}
+	}
+	return tea.Batch(cmds...), false
+}
+
+// leaveTailView goes back from the log view to the main view.
+func (m *Model) leaveTailView() []tea.Cmd {
+	var cmds []tea.Cmd
+	m.inTailView = false
+	// Restore the pre-tail mouse setting (tail view may have
+	// auto-disabled it).
+	if m.mouseEnabled != m.mouseEnabledBeforeTail {
+		m.mouseEnabled = m.mouseEnabledBeforeTail
+		if m.mouseEnabled {
+			cmds = append(cmds, tea.EnableMouseCellMotion)
+		} else {
+			cmds = append(cmds, tea.DisableMouse)
+		}
+	}
+	// Re-trigger a job refresh when coming back
+	cmds = append(cmds, m.fetchJobsCmd())
+	// Refresh details to clear "Resolving logs..." status
+	if m.selectedID != "" {
+		cmds = append(cmds, m.fetchDetailsCmd(m.selectedID))
+	}
+	return cmds
+}
+
+// toggleMouse turns mouse reporting on or off.
+func (m *Model) toggleMouse() tea.Cmd {
+	m.mouseEnabled = !m.mouseEnabled
+	if m.mouseEnabled {
+		return tea.EnableMouseCellMotion
+	}
+	return tea.DisableMouse
+}
+
 func (m Model) View() string {
+	if m.palette != nil {
+		return m.viewPalette()
+	}
+
+	if m.inMultiTail {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			m.multiTail.View(),
+			m.help.View(multiTailKeys),
+		)
+	}
+
 	if m.inTailView {
 		return lipgloss.JoinVertical(lipgloss.Left,
 			m.tailModel.View(),
@@ -746,6 +982,10 @@ func (m Model) View() string {
 		)
 	}
 
+	if m.browser != nil {
+		return m.viewBrowser()
+	}
+
 	if m.inValueOverlay {
 		return m.viewValueOverlay()
 	}
@@ -754,8 +994,13 @@ func (m Model) View() string {
 		return m.viewDetailsOverlay()
 	}
 
+	if m.comparePrompt {
+		return m.viewComparePrompt()
+	}
+
 	if m.confirmingCancel && m.cancelCandidate != nil {
-		msg := fmt.Sprintf("Are you sure you want to cancel job?\n\n%s (%s)\n\n[y/N]", m.cancelCandidate.JobID, m.cancelCandidate.Name)
+		msg := fmt.Sprintf("Are you sure you want to cancel job?\n\n%s (%s)\n\n%s", m.cancelCandidate.JobID, m.cancelCandidate.Name,
+			hints("  ", hint("yes", dialogKeys.Yes), hint("no", dialogKeys.No, dialogKeys.Back)))
 		return lipgloss.Place(m.width, m.height,
 			lipgloss.Center, lipgloss.Center,
 			dialogStyle.Render(msg),
@@ -806,6 +1051,12 @@ func (m Model) renderHeaderArea() string {
 	if m.paused {
 		required = append(required, metaMutedPillStyle.Copy().Background(accentOrange).Render("Paused"))
 	}
+	if len(m.marked) > 0 {
+		required = append(required, metaPillStyle.Render(fmt.Sprintf("%d marked", len(m.marked))))
+	}
+	if m.compareBase != "" {
+		required = append(required, metaPillStyle.Render("Compare "+m.compareBase+" with… (=)"))
+	}
 	if m.err != nil {
 		errText := fmt.Sprintf("Error %s", shortenText(m.err.Error(), 32))
 		required = append(required, metaAlertPillStyle.Render(errText))
@@ -844,6 +1095,15 @@ func (m Model) renderHeaderArea() string {
 }
 
 func (m Model) filterHint() string {
+	if len(m.fieldFilter) > 0 {
+		fields := make([]string, 0, len(m.fieldFilter))
+		for field, value := range m.fieldFilter {
+			fields = append(fields, field+"="+value)
+		}
+		sort.Strings(fields)
+		return lipgloss.NewStyle().MaxWidth(m.width).Render(filterHintStyle.Render(
+			"Filtered by " + strings.Join(fields, " ") + " (:filter clears)"))
+	}
 	if m.inputMode || m.filterInput.Value() != "" {
 		return ""
 	}
@@ -1028,6 +1288,7 @@ func (m *Model) configureValueViewport() {
 	}
 
 	m.valueView = viewport.New(w, h)
+	m.valueView.KeyMap = viewportKeyMap()
 	content := m.valueValue
 	if strings.TrimSpace(content) == "" {
 		content = "(empty)"
@@ -1506,12 +1767,16 @@ func (m Model) responsiveTableColumns(contentWidth int) []table.Column {
 		title string
 		width int
 	}
-	optionals := []optCol{
+	var optionals []optCol
+	if m.appMode == modeLive {
+		optionals = append(optionals, optCol{"Progress", 14}, optCol{"Last output", 13})
+	}
+	optionals = append(optionals, []optCol{
 		{"Time", 10},
 		{"Nodes", 6},
 		{"Partition", 10},
 		{"Nodelist", 15},
-	}
+	}...)
 
 	widthCost := func(raw int) int {
 		return raw + colFrame
@@ -1620,6 +1885,9 @@ func (m *Model) updateDetailsTable(text string) {
 	} else {
 		rows = parseDetailsToRows(text)
 	}
+	if m.diagnosis.text != "" && m.diagnosis.jobID == m.selectedID {
+		rows = append([]table.Row{{"Diagnosis", m.diagnosis.text}}, rows...)
+	}
 	m.detailsTable.SetRows(rows)
 }
 
@@ -1793,6 +2061,20 @@ func (m *Model) setTableCursorByJobID(jobID string) {
 	}
 }
 
+// switchMode switches between live and history mode.
+func (m *Model) switchMode(mode mode) tea.Cmd {
+	m.loadingJobs = true
+	m.appMode = mode
+	// Show the cached history right away; sacct only fills in the delta.
+	width, height := m.width, m.height
+	return tea.Batch(
+		tea.Sequence(m.cachedHistoryCmd(), m.fetchJobsCmd()),
+		func() tea.Msg {
+			return tea.WindowSizeMsg{Width: width, Height: height}
+		},
+	)
+}
+
 func (m *Model) updateTable() {
 	if m.loadingJobs {
 		// Keep existing rows while a new job list is being fetched
@@ -1819,6 +2101,9 @@ func (m *Model) updateTable() {
 				continue
 			}
 		}
+		if !jobMatchesFields(j, m.fieldFilter) {
+			continue
+		}
 		m.filtered = append(m.filtered, j)
 	}
 
@@ -1840,28 +2125,37 @@ func (m *Model) updateTable() {
 		// Note: ANSI colors removed as they interfere with table column width calculation
 		// causing truncation (e.g. "P...") and layout shifting.
 
-		// Create row based on current columns
-		// We must match the number of columns currently set in the table
+		// Build the row from the current columns, which depend on the
+		// window width.
+		name := j.Name
+		if m.marked[j.JobID] {
+			name = "✓ " + name
+		}
+		lastOutput := ""
+		if last, ok := m.lastOutput[j.JobID]; ok && j.State() == "R" {
+			lastOutput = formatQuiet(time.Since(last)) + " ago"
+			if isStalled(last, m.stallAfter, time.Now()) {
+				name = "⚠ " + name
+				lastOutput = "⚠ " + lastOutput
+			}
+		}
+		values := map[string]string{
+			"Job ID":      j.JobID,
+			"Name":        name,
+			"Status":      truncate(status, 12),
+			"Progress":    m.progress[j.JobID],
+			"Last output": lastOutput,
+			"Time":        truncate(j.Time, 12),
+			"Nodes":       truncate(j.Nodes, 8),
+			"Partition":   truncate(j.Partition, 12),
+			"Nodelist":    truncate(j.NodeList, 20),
+		}
 		currentCols := m.table.Columns()
-
-		// Standard row data
-		fullRow := []string{
-			j.JobID,
-			j.Name,
-			truncate(status, 12),
-			truncate(j.Time, 12),
-			truncate(j.Nodes, 8),
-			truncate(j.Partition, 12),
-			truncate(j.NodeList, 20),
-		}
-
-		// Slice row data to match column count
-		// This prevents "index out of range" if we are in compact mode
-		if len(currentCols) < len(fullRow) {
-			rows = append(rows, fullRow[:len(currentCols)])
-		} else {
-			rows = append(rows, fullRow)
+		row := make(table.Row, len(currentCols))
+		for i, col := range currentCols {
+			row[i] = values[col.Title]
 		}
+		rows = append(rows, row)
 	}
 	m.table.SetRows(rows)
 }
@@ -1905,6 +2199,13 @@ func historyDaysFromEnv() int {
 func (m Model) fetchJobsCmd() tea.Cmd {
 	return func() tea.Msg {
 		if m.appMode == modeHistory {
+			if m.store != nil {
+				jobs, err := m.store.SyncHistory(m.historyDays, FetchJobsSince)
+				if err != nil {
+					return errMsg(err)
+				}
+				return jobsMsg(jobs)
+			}
 			jobs, err := FetchJobsHistory(m.historyDays)
 			if err != nil {
 				return errMsg(err)
@@ -1915,20 +2216,100 @@ func (m Model) fetchJobsCmd() tea.Cmd {
 		if err != nil {
 			return errMsg(err)
 		}
+		_ = m.store.RecordJobs(jobs)
+		return jobsMsg(jobs)
+	}
+}
+
+// pollObservedJobsCmd polls the live queue for hooks and archiving alone,
+// if any are configured.
+func (m Model) pollObservedJobsCmd() tea.Cmd {
+	if m.hooks == nil && m.archiver == nil || m.appMode != modeLive {
+		return nil
+	}
+	return func() tea.Msg {
+		jobs, err := FetchJobsSqueue()
+		if err != nil {
+			return errMsg(err)
+		}
+		_ = m.store.RecordJobs(jobs)
+		return observedJobsMsg(jobs)
+	}
+}
+
+// cachedHistoryCmd loads the history window from the local store without
+// querying sacct.
+func (m Model) cachedHistoryCmd() tea.Cmd {
+	if m.store == nil || m.appMode != modeHistory {
+		return nil
+	}
+	return func() tea.Msg {
+		jobs, err := m.store.Jobs(historyWindowStart(m.historyDays))
+		if err != nil || len(jobs) == 0 {
+			return nil
+		}
 		return jobsMsg(jobs)
 	}
 }
 
+// fetchDetailsCmd fetches the details of a job and, for failed jobs in
+// history mode, diagnoses the failure.
 func (m Model) fetchDetailsCmd(id string) tea.Cmd {
+	return tea.Batch(m.fetchJobDetailsCmd(id), m.diagnoseCmd(id))
+}
+
+func (m Model) fetchJobDetailsCmd(id string) tea.Cmd {
 	return func() tea.Msg {
 		det, err := GetJobDetails(id, m.appMode == modeHistory)
+		if err != nil || strings.TrimSpace(det) == "" {
+			// sacct/scontrol may have forgotten the job; fall back to what
+			// was stored when it was last seen.
+			if rec, ok := m.store.Lookup(id); ok && rec.Details != "" {
+				return detailsMsg(rec.Details)
+			}
+		}
 		if err != nil {
 			return detailsMsg(fmt.Sprintf("Error fetching details: %v", err))
 		}
+		_ = m.store.RecordDetails(id, det)
 		return detailsMsg(det)
 	}
 }
 
+// observeJobsCmd records a fresh job list in the tracker and dispatches the
+// resulting events. In live mode, jobs that vanished from squeue are looked up
+// in sacct so their final state is reported too.
+func (m *Model) observeJobsCmd(jobs []Job) tea.Cmd {
+	if m.hooks == nil && m.archiver == nil {
+		return nil
+	}
+	m.handleJobEvents(m.tracker.Observe(jobs))
+	if m.appMode != modeLive {
+		return nil
+	}
+	missing := m.tracker.Missing(jobs)
+	if len(missing) == 0 {
+		return nil
+	}
+	store := m.store
+	return func() tea.Msg {
+		final, err := FetchJobsByID(sacctIDs(missing))
+		if err != nil {
+			return errMsg(err)
+		}
+		_ = store.RecordJobs(final)
+		return finalStatesMsg{ids: missing, jobs: final}
+	}
+}
+
+func (m *Model) handleJobEvents(events []JobEvent) {
+	if len(events) == 0 {
+		return
+	}
+	m.hooks.Fire(events)
+	m.archiver.Archive(events)
+}
+
 func (m Model) cancelJobCmd(id string) tea.Cmd {
 	return func() tea.Msg {
 		err := CancelJob(id)
@@ -1941,24 +2322,99 @@ func (m Model) cancelJobCmd(id string) tea.Cmd {
 
 func (m Model) resolveTailPathsCmd(id string, mode TailMode) tea.Cmd {
 	return func() tea.Msg {
-		out, errPath, errExec := ResolveLogPaths(id)
+		out, errPath, err := m.resolveJobLogPaths(id)
+		return tailPathsMsg{jobID: id, stdout: out, stderr: errPath, mode: mode, err: err}
+	}
+}
 
-		// If resolution failed entirely, return empty paths
-		// The tail view will show "No path provided" for empty paths
-		if errExec != nil {
-			// Return empty paths - the tail view handles this gracefully. We
-			// also propagate the error so the header can show it.
-			return tailPathsMsg{jobID: id, stdout: "", stderr: "", mode: mode, err: errExec}
+// resolveJobLogPaths returns the log paths of a job, falling back to the
+// job store for jobs Slurm no longer knows.
+func (m Model) resolveJobLogPaths(id string) (string, string, error) {
+	out, errPath, errExec := ResolveLogPaths(id)
+
+	// If resolution failed entirely, return empty paths
+	// The tail view will show "No path provided" for empty paths
+	if errExec != nil {
+		if rec, ok := m.store.Lookup(id); ok && (rec.Stdout != "" || rec.Stderr != "") {
+			return rec.Stdout, rec.Stderr, nil
 		}
+		// Return empty paths - the tail view handles this gracefully. We
+		// also propagate the error so the header can show it.
+		return "", "", errExec
+	}
 
-		return tailPathsMsg{jobID: id, stdout: out, stderr: errPath, mode: mode}
+	_ = m.store.RecordLogPaths(id, out, errPath)
+	return out, errPath, nil
+}
+
+// openMultiTail opens the multi-job view on the jobs or files of msg.
+func (m *Model) openMultiTail(msg multiTailPathsMsg) tea.Cmd {
+	if msg.err != nil {
+		m.err = msg.err
 	}
+	m.multiTail = NewMultiTailModel(msg.jobs, m.width, m.height)
+	m.multiTail.logsOf = msg.logsOf
+	m.inMultiTail = true
+	return m.multiTail.Init()
+}
+
+// openTailView shows a log view with the session's settings.
+func (m *Model) openTailView(t TailModel) tea.Cmd {
+	m.mouseEnabledBeforeTail = m.mouseEnabled
+	t.mouseEnabled = m.mouseEnabled // Sync state
+	t.history = m.searchHistory
+	t.rules = m.logRules
+	t.metrics = newMetricsView(m.metricExtractor)
+	t.jobs = m.jobs
+	m.tailModel = t
+	m.inTailView = true
+	return m.tailModel.Init()
 }
 
 func main() {
-	p := tea.NewProgram(NewModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "wait":
+			os.Exit(runWait(os.Args[2:]))
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "slurm-dashboard: %v\n", err)
+		os.Exit(1)
+	}
+	keyMaps, err := cfg.Keys.build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "slurm-dashboard: keys: %v\n", err)
+		os.Exit(1)
+	}
+	keyMaps.install()
+
+	// Hook and archive failures are reported in the header like any other
+	// error.
+	var p *tea.Program
+	reportErr := func(err error) {
+		if p != nil {
+			p.Send(errMsg(err))
+		}
+	}
+	m := NewModel()
+	m.hooks = NewHookDispatcher(cfg.Hooks, reportErr)
+	defer m.hooks.Close()
+	m.archiver = NewLogArchiver(cfg.Archive, reportErr)
+	defer m.archiver.Close()
+	m.store = openJobStore(historyDBPath())
+	m.logRules = newLogRuleSet(cfg.LogRules)
+	m.metricExtractor = newMetricExtractor(cfg.Metrics)
+
+	p = tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Alas, there's been an error: %v", err)
+		m.hooks.Close()
+		m.archiver.Close()
 		os.Exit(1)
 	}
 }
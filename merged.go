@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Merged mode interleaves stdout and stderr in one pane in the order their
+// lines arrived. Arrival order is recorded in every mode, so switching to
+// the merged pane shows the whole session.
+
+const mergedTimeLayout = "15:04:05.000"
+
+// mergedEntry is a line of the merged pane. Lines that were already in the
+// logs when the view opened have no arrival time.
+type mergedEntry struct {
+	pane string
+	at   time.Time
+	text string
+}
+
+// format renders an entry with its source tag and, optionally, its arrival
+// time.
+func (e mergedEntry) format(timestamps bool) string {
+	tag := "out│ "
+	if e.pane == "stderr" {
+		tag = "err│ "
+	}
+	if !timestamps {
+		return tag + e.text
+	}
+	stamp := strings.Repeat("-", len(mergedTimeLayout))
+	if !e.at.IsZero() {
+		stamp = e.at.Format(mergedTimeLayout)
+	}
+	return stamp + " " + tag + e.text
+}
+
+// recordMerged adds lines of a stream to the merged pane; at is zero for
+// lines read when the log was opened.
+func (m *TailModel) recordMerged(pane string, at time.Time, texts []string) {
+	if pane == "stderr" && m.stderrPath == m.stdoutPath {
+		// Both streams go to one file: its lines already came as stdout.
+		return
+	}
+	formatted := make([]string, 0, len(texts))
+	for _, text := range texts {
+		e := mergedEntry{pane: pane, at: at, text: cleanLogLine(text)}
+		m.mergedEntries = append(m.mergedEntries, e)
+		formatted = append(formatted, e.format(m.showTimestamps))
+	}
+	if MaxLogLines > 0 && len(m.mergedEntries) > MaxLogLines {
+		m.mergedEntries = m.mergedEntries[len(m.mergedEntries)-MaxLogLines:]
+	}
+	if m.mode != TailModeMerged {
+		// Rendered when the merged pane is shown.
+		return
+	}
+	if at.IsZero() {
+		m.refreshMergedContent()
+		if m.following && !m.paused {
+			m.mergedView.GotoBottom()
+		}
+		return
+	}
+	m.appendLogLine("merged", &m.mergedLines, &m.wrappedMerged, m.mergedBuilder, &m.mergedView, formatted...)
+}
+
+func (m *TailModel) refreshMergedContent() {
+	m.mergedLines = m.mergedLines[:0]
+	for _, e := range m.mergedEntries {
+		m.mergedLines = append(m.mergedLines, e.format(m.showTimestamps))
+	}
+	if m.mergedFilter.active() {
+		m.mergedFilter.rebuild(m.mergedLines)
+	}
+	m.wrappedMerged = m.wrappedMerged[:0]
+	m.mergedLevels = m.classifyLines("merged", m.displayLines("merged"))
+	for _, line := range m.displayLines("merged") {
+		m.wrappedMerged = append(m.wrappedMerged, m.wrapLine(line, m.mergedView.Width))
+	}
+	if m.mergedBuilder == nil {
+		m.mergedBuilder = &strings.Builder{}
+	}
+	needle := m.activeMatcher()
+	m.mergedMatches = m.findMatches("merged", 0, needle)
+	m.rebuildPaneContent("merged", m.mergedBuilder, m.wrappedMerged, needle)
+	m.showPaneContent("merged")
+}
+
+// mergedPath describes the logs of the merged pane for its header.
+func (m TailModel) mergedPath() string {
+	if m.stderrPath == "" || m.stderrPath == m.stdoutPath {
+		return m.stdoutPath
+	}
+	if m.stdoutPath == "" {
+		return m.stderrPath
+	}
+	return filepath.Base(m.stdoutPath) + " + " + filepath.Base(m.stderrPath)
+}
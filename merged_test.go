@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTailMergedModeInterleavesStreamsInArrivalOrder(t *testing.T) {
+	m := NewTailModel("1", "/logs/job.out", "/logs/job.err", 100, 20, TailModeBoth)
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	update(tailStartMsg{pane: "stderr", initialLines: []string{"old warning"}})
+	update(tailStartMsg{pane: "stdout", initialLines: []string{"old progress"}})
+	update(logLineMsg{pane: "stdout", lines: []string{"step 1"}})
+	update(logLineMsg{pane: "stderr", lines: []string{"Traceback (most recent call last):"}})
+	update(logLineMsg{pane: "stdout", lines: []string{"step 2"}})
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'M'}})
+	want := []string{"err│ old warning", "out│ old progress", "out│ step 1", "err│ Traceback (most recent call last):", "out│ step 2"}
+	if strings.Join(m.mergedLines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("merged lines = %q", m.mergedLines)
+	}
+	if m.focusedPane() != "merged" || !strings.Contains(m.View(), "MERGED") {
+		t.Fatalf("expected the merged pane to be shown")
+	}
+
+	// Lines keep arriving in merged mode.
+	update(logLineMsg{pane: "stderr", lines: []string{"done"}})
+	if got := m.mergedLines[len(m.mergedLines)-1]; got != "err│ done" {
+		t.Fatalf("last merged line = %q", got)
+	}
+	if errors, _ := m.levelCounts("merged"); errors != 1 {
+		t.Fatalf("expected the traceback to be marked in the merged pane")
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'T'}})
+	if !strings.HasPrefix(m.mergedLines[0], "------------ err│ ") {
+		t.Fatalf("expected lines read at open to have no arrival time, got %q", m.mergedLines[0])
+	}
+	if !regexp.MustCompile(`^\d\d:\d\d:\d\d\.\d{3} out│ step 1$`).MatchString(m.mergedLines[2]) {
+		t.Fatalf("expected an arrival time, got %q", m.mergedLines[2])
+	}
+}
+
+func TestTailMergedModeSkipsSharedLogFile(t *testing.T) {
+	m := NewTailModel("1", "/logs/job.log", "/logs/job.log", 100, 20, TailModeMerged)
+	for _, pane := range []string{"stdout", "stderr"} {
+		model, _ := m.Update(logLineMsg{pane: pane, lines: []string{"same line"}})
+		m = model.(TailModel)
+	}
+	if len(m.mergedLines) != 1 {
+		t.Fatalf("expected a log shared by both streams once, got %q", m.mergedLines)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The metrics panel of the log view plots numbers that stdout reports as it
+// goes, like the loss of a training run printing `step=1200 loss=0.314`.
+
+// MetricsConfig is the "metrics" section of the config file: regular
+// expressions extracting metrics from stdout lines. They are used along with
+// the built-in key=value extraction unless NoDefaults is set.
+type MetricsConfig struct {
+	NoDefaults bool                  `json:"no_defaults"`
+	Patterns   []MetricPatternConfig `json:"patterns"`
+}
+
+type MetricPatternConfig struct {
+	Name    string `json:"name"`    // series of the pattern's unnamed group
+	Pattern string `json:"pattern"` // Go regular expression; named groups are series
+}
+
+func (c MetricsConfig) validate() error {
+	for i, p := range c.Patterns {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("pattern %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (p MetricPatternConfig) validate() error {
+	if p.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(p.Pattern)
+	if err != nil {
+		return err
+	}
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("pattern has no group capturing a value")
+	}
+	unnamed := 0
+	for _, name := range re.SubexpNames()[1:] {
+		if name == "" {
+			unnamed++
+		}
+	}
+	switch {
+	case unnamed > 1:
+		return fmt.Errorf("pattern has %d unnamed groups; name them (?P<name>...) or make them non-capturing (?:...)", unnamed)
+	case unnamed == 1 && p.Name == "":
+		return fmt.Errorf("name is required for the unnamed group")
+	}
+	return nil
+}
+
+// metricNumber is a number as programs print them: 12, -0.5, .25, 3e-4.
+const metricNumber = `[-+]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?`
+
+var (
+	// metricKeyValueRegexp matches "loss=0.314", metricDictRegexp the
+	// "'loss': 0.314" of printed Python dicts and JSON.
+	metricKeyValueRegexp = regexp.MustCompile(`([A-Za-z_][\w./-]*) ?= ?(` + metricNumber + `)`)
+	metricDictRegexp     = regexp.MustCompile(`['"]([A-Za-z_][\w./-]*)['"]: ?(` + metricNumber + `)`)
+)
+
+type metricPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// metricExtractor finds the metrics of a log line.
+type metricExtractor struct {
+	keyValues bool
+	patterns  []metricPattern
+}
+
+var defaultMetricExtractor = newMetricExtractor(MetricsConfig{})
+
+// newMetricExtractor builds the extractor of a validated config.
+func newMetricExtractor(cfg MetricsConfig) *metricExtractor {
+	e := &metricExtractor{keyValues: !cfg.NoDefaults}
+	for _, p := range cfg.Patterns {
+		if re, err := regexp.Compile(p.Pattern); err == nil {
+			e.patterns = append(e.patterns, metricPattern{name: p.Name, re: re})
+		}
+	}
+	return e
+}
+
+type metricSample struct {
+	name  string
+	value float64
+}
+
+// extract returns the metrics reported by a line, in the order they appear.
+func (e *metricExtractor) extract(line string) []metricSample {
+	line = stripANSI(line)
+	var samples []metricSample
+	if e.keyValues && (strings.Contains(line, "=") || strings.Contains(line, ":")) {
+		for _, re := range []*regexp.Regexp{metricKeyValueRegexp, metricDictRegexp} {
+			for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+				// A value runs up to the end of its word: "12ms" is no metric.
+				if !metricBoundary(line, loc[0], loc[5]) {
+					continue
+				}
+				if v, err := strconv.ParseFloat(line[loc[4]:loc[5]], 64); err == nil {
+					samples = append(samples, metricSample{name: line[loc[2]:loc[3]], value: v})
+				}
+			}
+		}
+	}
+	for _, p := range e.patterns {
+		names := p.re.SubexpNames()
+		for _, m := range p.re.FindAllStringSubmatch(line, -1) {
+			for i := 1; i < len(m); i++ {
+				name := names[i]
+				if name == "" {
+					name = p.name
+				}
+				if v, err := strconv.ParseFloat(strings.TrimSpace(m[i]), 64); err == nil {
+					samples = append(samples, metricSample{name: name, value: v})
+				}
+			}
+		}
+	}
+	return samples
+}
+
+// metricBoundary reports whether line[start:end] is a whole key=value pair.
+func metricBoundary(line string, start, end int) bool {
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(line[:start]); isWord(r) {
+			return false
+		}
+	}
+	if end < len(line) {
+		if r, _ := utf8.DecodeRuneInString(line[end:]); isWord(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxMetricPoints bounds the values kept per series. A longer series keeps
+// every other value, so the plot still covers the whole run.
+const maxMetricPoints = 4096
+
+type metricSeries struct {
+	name   string
+	values []float64
+	stride int // samples per kept value
+	skip   int // samples since the last kept value
+	count  int
+
+	last, min, max float64
+}
+
+func (s *metricSeries) add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.last = v
+	s.count++
+
+	if s.skip++; s.skip < s.stride {
+		return
+	}
+	s.skip = 0
+	s.values = append(s.values, v)
+	if len(s.values) > maxMetricPoints {
+		kept := s.values[:0]
+		for i := 0; i < len(s.values); i += 2 {
+			kept = append(kept, s.values[i])
+		}
+		s.values = kept
+		s.stride *= 2
+	}
+}
+
+// metricsView holds the series of a log view and which of them are plotted.
+// Until series are picked, those named like a loss are plotted (or the
+// first one when none is).
+type metricsView struct {
+	extractor *metricExtractor
+	series    map[string]*metricSeries
+	order     []string
+	plotted   map[string]bool
+	picked    bool
+	cursor    int
+}
+
+func newMetricsView(extractor *metricExtractor) *metricsView {
+	return &metricsView{extractor: extractor, series: make(map[string]*metricSeries), plotted: make(map[string]bool)}
+}
+
+// add extracts the metrics of new stdout lines.
+func (v *metricsView) add(lines []string) {
+	for _, line := range lines {
+		for _, sample := range v.extractor.extract(line) {
+			s := v.series[sample.name]
+			if s == nil {
+				s = &metricSeries{name: sample.name, stride: 1}
+				v.series[sample.name] = s
+				v.order = append(v.order, sample.name)
+			}
+			s.add(sample.value)
+		}
+	}
+}
+
+func (v *metricsView) isPlotted(name string) bool {
+	if v.picked {
+		return v.plotted[name]
+	}
+	hasLoss := false
+	for _, n := range v.order {
+		if strings.Contains(strings.ToLower(n), "loss") {
+			hasLoss = true
+			break
+		}
+	}
+	if hasLoss {
+		return strings.Contains(strings.ToLower(name), "loss")
+	}
+	return len(v.order) > 0 && name == v.order[0]
+}
+
+// toggle plots or hides the series under the cursor.
+func (v *metricsView) toggle() {
+	if v.cursor < 0 || v.cursor >= len(v.order) {
+		return
+	}
+	if !v.picked {
+		for _, name := range v.order {
+			v.plotted[name] = v.isPlotted(name)
+		}
+		v.picked = true
+	}
+	name := v.order[v.cursor]
+	v.plotted[name] = !v.plotted[name]
+}
+
+func (v *metricsView) moveCursor(delta int) {
+	v.cursor += delta
+	if v.cursor >= len(v.order) {
+		v.cursor = len(v.order) - 1
+	}
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// metricPlotColors color the plotted series in turn.
+var metricPlotColors = []lipgloss.TerminalColor{highlight, accentOrange, accentGreen, accentPink, accentCyan, accentBlue}
+
+// brailleDots are the bits of the dots of a braille cell, by row and
+// column; each cell plots 2×4 points.
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// plotSeries draws values as a line chart of width×height cells, scaled so
+// lo is at the bottom and hi at the top.
+func plotSeries(values []float64, width, height int, lo, hi float64) []string {
+	cols, rows := width*2, height*4
+	grid := make([][]rune, height)
+	for i := range grid {
+		grid[i] = make([]rune, width)
+	}
+	set := func(x, y int) {
+		grid[y/4][x/2] |= brailleDots[y%4][x%2]
+	}
+	yOf := func(v float64) int {
+		if hi <= lo {
+			return rows / 2
+		}
+		return int(math.Round((hi - v) / (hi - lo) * float64(rows-1)))
+	}
+	xOf := func(i int) int {
+		if len(values) < 2 {
+			return 0
+		}
+		return i * (cols - 1) / (len(values) - 1)
+	}
+
+	for i, v := range values {
+		x, y := xOf(i), yOf(v)
+		if i == 0 {
+			set(x, y)
+			continue
+		}
+		// Join the previous point: across the columns in between, then
+		// up or down to this one.
+		px, py := xOf(i-1), yOf(values[i-1])
+		for cx := px + 1; cx <= x; cx++ {
+			cy := py + (y-py)*(cx-px)/(x-px)
+			from, to := py+(y-py)*(cx-1-px)/(x-px), cy
+			if from > to {
+				from, to = to, from
+			}
+			for yy := from; yy <= to; yy++ {
+				set(cx, yy)
+			}
+		}
+		if x == px {
+			from, to := py, y
+			if from > to {
+				from, to = to, from
+			}
+			for yy := from; yy <= to; yy++ {
+				set(x, yy)
+			}
+		}
+	}
+
+	lines := make([]string, height)
+	for i, row := range grid {
+		var b strings.Builder
+		for _, bits := range row {
+			if bits == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteRune(0x2800 + bits)
+			}
+		}
+		lines[i] = b.String()
+	}
+	return lines
+}
+
+// renderMetrics draws the metrics panel over the whole view: the series
+// found so far, then a chart of each plotted one.
+func (m TailModel) renderMetrics() string {
+	v := m.metrics
+	width := m.width - 2
+	if width < 30 {
+		width = 30
+	}
+	height := m.height - 2
+	if height < 10 {
+		height = 10
+	}
+
+	var b strings.Builder
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("METRICS %s: %d series", filepath.Base(m.stdoutPath), len(v.order))))
+	b.WriteString("\n\n")
+	if len(v.order) == 0 {
+		b.WriteString("No metrics yet. Numbers printed to stdout as key=value pairs (e.g. step=1200 loss=0.314)\n")
+		b.WriteString("or matching the patterns of the config file show up here as they arrive.\n")
+		b.WriteString("\n" + hint("close", dialogKeys.Back))
+		return b.String()
+	}
+
+	// The list of series, scrolled to keep the cursor in view.
+	listHeight := len(v.order)
+	if listHeight > 6 {
+		listHeight = 6
+	}
+	first := v.cursor - listHeight/2
+	if first > len(v.order)-listHeight {
+		first = len(v.order) - listHeight
+	}
+	if first < 0 {
+		first = 0
+	}
+	var plotted []*metricSeries
+	for _, name := range v.order {
+		if v.isPlotted(name) {
+			plotted = append(plotted, v.series[name])
+		}
+	}
+	for i := first; i < first+listHeight; i++ {
+		s := v.series[v.order[i]]
+		mark := "○"
+		if v.isPlotted(s.name) {
+			mark = "●"
+		}
+		line := fmt.Sprintf("%s %-20s last %-10s min %-10s max %-10s n=%d", mark, s.name, formatMetric(s.last), formatMetric(s.min), formatMetric(s.max), s.count)
+		if runeLen(line) > width {
+			line = runeSlice(line, 0, width-1) + "…"
+		}
+		if i == v.cursor {
+			line = tailSelectionStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	// The charts share what is left, at least 3 rows each.
+	avail := height - 4 - listHeight - 2
+	charts := len(plotted)
+	if charts > 0 && avail/charts < 4 {
+		charts = avail / 4
+		if charts < 1 {
+			charts = 1
+		}
+	}
+	for n, s := range plotted[:charts] {
+		chartHeight := avail/charts - 1
+		if chartHeight < 3 {
+			chartHeight = 3
+		}
+		hi, lo := formatMetric(s.max), formatMetric(s.min)
+		labelWidth := len(hi)
+		if len(lo) > labelWidth {
+			labelWidth = len(lo)
+		}
+		style := lipgloss.NewStyle().Foreground(metricPlotColors[n%len(metricPlotColors)])
+		b.WriteString("\n" + style.Bold(true).Render(s.name) + "  last " + formatMetric(s.last) + "\n")
+		for i, row := range plotSeries(s.values, width-labelWidth-2, chartHeight, s.min, s.max) {
+			label := ""
+			switch i {
+			case 0:
+				label = hi
+			case chartHeight - 1:
+				label = lo
+			}
+			b.WriteString(fmt.Sprintf("%*s ┤", labelWidth, label) + style.Render(row) + "\n")
+		}
+	}
+	if charts < len(plotted) {
+		b.WriteString(fmt.Sprintf("\n(%d more plotted series don't fit)\n", len(plotted)-charts))
+	}
+	b.WriteString("\n" + hints("  ",
+		hint("select", scrollKeys.Up, scrollKeys.Down),
+		hint("plot/hide", dialogKeys.Toggle),
+		hint("close", dialogKeys.Back)))
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMetricExtractorFindsKeyValuePairs(t *testing.T) {
+	got := defaultMetricExtractor.extract("step=1200 loss=0.314 lr=3e-4 time=12ms epoch 3 {'eval_acc': 0.91}")
+	want := []metricSample{{"step", 1200}, {"loss", 0.314}, {"lr", 3e-4}, {"eval_acc", 0.91}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := defaultMetricExtractor.extract("\x1b[32mloss = 1.5\x1b[0m"); len(got) != 1 || got[0].value != 1.5 {
+		t.Fatalf("expected colors to be ignored, got %v", got)
+	}
+}
+
+func TestParseConfigMetrics(t *testing.T) {
+	for _, bad := range []string{
+		`{"metrics": {"patterns": [{"pattern": "(unclosed"}]}}`,
+		`{"metrics": {"patterns": [{"name": "x", "pattern": "loss"}]}}`,
+		`{"metrics": {"patterns": [{"pattern": "loss (\\d+)"}]}}`,
+		`{"metrics": {"patterns": [{"name": "x", "pattern": "(\\d+)/(\\d+)"}]}}`,
+	} {
+		if _, err := parseConfig([]byte(bad), "config.json"); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+	cfg, err := parseConfig([]byte(`{"metrics": {"no_defaults": true, "patterns": [
+		{"name": "loss", "pattern": "Loss: ([\\d.]+)"},
+		{"pattern": "(?P<done>\\d+)/(?P<total>\\d+) batches"}
+	]}}`), "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newMetricExtractor(cfg.Metrics).extract("Epoch 2 Loss: 0.5 lr=1e-3 120/500 batches")
+	want := []metricSample{{"loss", 0.5}, {"done", 120}, {"total", 500}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestMetricSeriesKeepsTheWholeRunWhenLong(t *testing.T) {
+	s := &metricSeries{stride: 1}
+	for i := 0; i < 3*maxMetricPoints; i++ {
+		s.add(float64(i))
+	}
+	if len(s.values) > maxMetricPoints || s.values[0] != 0 || s.values[len(s.values)-1] < float64(2*maxMetricPoints) {
+		t.Fatalf("expected a thinned series spanning the run, got %d values from %v to %v", len(s.values), s.values[0], s.values[len(s.values)-1])
+	}
+	if s.count != 3*maxMetricPoints || s.min != 0 || s.last != float64(3*maxMetricPoints-1) {
+		t.Fatalf("unexpected stats: count %d min %v last %v", s.count, s.min, s.last)
+	}
+}
+
+func TestPlotSeriesDrawsALine(t *testing.T) {
+	rows := plotSeries([]float64{10, 5, 0}, 3, 2, 0, 10)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	// Falling from the top left to the bottom right, without gaps.
+	if rows[0][0] == ' ' || []rune(rows[1])[2] == ' ' || []rune(rows[0])[2] != ' ' {
+		t.Fatalf("unexpected plot:\n%s", strings.Join(rows, "\n"))
+	}
+}
+
+func TestTailMetricsPanelUpdatesLive(t *testing.T) {
+	m := NewTailModel("1", "/logs/job.out", "/logs/job.err", 100, 30, TailModeStdout)
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	update(tailStartMsg{pane: "stdout", initialLines: []string{"step=1 loss=2.5 lr=0.1", "step=2 loss=1.5 lr=0.1"}})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'P'}})
+	if !m.InOverlay() {
+		t.Fatalf("expected the metrics panel to open")
+	}
+	view := m.View()
+	if !strings.Contains(view, "3 series") || !strings.Contains(view, "● loss") || !strings.Contains(view, "○ step") {
+		t.Fatalf("expected loss to be plotted by default:\n%s", view)
+	}
+
+	update(logLineMsg{pane: "stdout", lines: []string{"step=3 loss=0.5 lr=0.1"}})
+	if s := m.metrics.series["loss"]; s.count != 3 || s.last != 0.5 || s.max != 2.5 {
+		t.Fatalf("unexpected loss series %+v", s)
+	}
+
+	// Plot lr too: the cursor starts on the first series.
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+	if !m.metrics.isPlotted("lr") || !m.metrics.isPlotted("loss") || m.metrics.isPlotted("step") {
+		t.Fatalf("expected loss and lr to be plotted")
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.InOverlay() {
+		t.Fatalf("expected Esc to close the panel")
+	}
+}
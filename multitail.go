@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+	"github.com/muesli/reflow/wordwrap"
+)
+
+// The multi-job view follows one stream of several jobs at once (the
+// marked jobs, or the tasks of an array job): merged into one stream with
+// each line tagged by its job, or as a grid of small panes. It also follows
+// the output files of one job's steps, picked in the log view.
+
+// maxMultiTailJobs bounds how many logs the multi-job view follows.
+const maxMultiTailJobs = 16
+
+// multiTailBacklog is how many of the lines already in each log are shown
+// when the view opens, and how many each tile keeps.
+const multiTailBacklog = 100
+
+// multiTileMinWidth is the narrowest a tile of the grid gets.
+const multiTileMinWidth = 40
+
+// MultiTailKeyMap defines keybindings for the multi-job view; they are
+// those of the log view.
+type MultiTailKeyMap struct{}
+
+func (MultiTailKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{tailKeys.Quit, tailKeys.ShowStdout, tailKeys.ShowStderr, tailKeys.ToggleLayout, tailKeys.Follow, tailKeys.Pause, tailKeys.Top, tailKeys.Bottom}
+}
+
+func (k MultiTailKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+var multiTailKeys MultiTailKeyMap
+
+// multiJob is a job of the multi-job view and its logs.
+type multiJob struct {
+	id             string
+	stdout, stderr string
+}
+
+// multiSource is the followed log of a job. Sources are shared by the
+// copies of the model.
+type multiSource struct {
+	job      string
+	path     string
+	tag      lipgloss.Style
+	follower *logFollower
+	lines    []string // the latest lines, shown in the job's tile
+}
+
+// multiEntry is a line of the merged stream.
+type multiEntry struct {
+	source int
+	text   string
+}
+
+// multiStartMsg and multiLineMsg carry what the followers of a multi-job
+// view read; gen tells apart the sources of an earlier stream.
+type multiStartMsg struct {
+	gen, source int
+	start       tailStartMsg
+}
+
+type multiLineMsg struct {
+	gen, source int
+	follower    *logFollower
+	lines       []string
+	terminal    bool
+}
+
+// multiTailPathsMsg carries the jobs to open in the multi-job view. When
+// logsOf is set, they are output files of that job, named by the step or
+// task they belong to.
+type multiTailPathsMsg struct {
+	jobs   []multiJob
+	logsOf string
+	err    error
+}
+
+// MultiTailModel follows the logs of several jobs.
+type MultiTailModel struct {
+	jobs    []multiJob
+	logsOf  string // the job whose files the view follows, if any
+	stream  string // "stdout" or "stderr"
+	gen     int
+	sources []*multiSource
+
+	view     viewport.Model
+	entries  []multiEntry
+	rendered []string
+	tagWidth int
+
+	grid      bool
+	following bool
+	paused    bool
+	width     int
+	height    int
+}
+
+func NewMultiTailModel(jobs []multiJob, width, height int) MultiTailModel {
+	m := MultiTailModel{
+		jobs:      jobs,
+		width:     width,
+		height:    height,
+		following: true,
+		view:      viewport.New(width, height),
+	}
+	m.view.KeyMap = viewportKeyMap()
+	for _, j := range jobs {
+		m.tagWidth = max(m.tagWidth, runeLen(j.id))
+	}
+	m.setStream("stdout")
+	m.resize()
+	return m
+}
+
+// setStream makes the view follow a stream of every job, dropping what it
+// showed.
+func (m *MultiTailModel) setStream(stream string) {
+	m.stream = stream
+	m.gen++
+	m.sources = nil
+	for i, j := range m.jobs {
+		path := j.stdout
+		if stream == "stderr" {
+			path = j.stderr
+		}
+		color := metricPlotColors[i%len(metricPlotColors)]
+		m.sources = append(m.sources, &multiSource{
+			job:  j.id,
+			path: path,
+			tag:  lipgloss.NewStyle().Foreground(color).Bold(true),
+		})
+	}
+	m.entries, m.rendered = nil, nil
+	m.view.SetContent("")
+}
+
+func (m MultiTailModel) Init() tea.Cmd {
+	var cmds []tea.Cmd
+	for i, src := range m.sources {
+		gen, i, path := m.gen, i, src.path
+		cmds = append(cmds, func() tea.Msg {
+			return multiStartMsg{gen: gen, source: i, start: startTail(m.stream, path)}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// closeCmd stops the followers.
+func (m MultiTailModel) closeCmd() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, src := range m.sources {
+		cmds = append(cmds, closeFollowerCmd(src.follower))
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m MultiTailModel) waitForLines(source int) tea.Cmd {
+	gen, follower := m.gen, m.sources[source].follower
+	return func() tea.Msg {
+		lines, _, ok := follower.Next()
+		return multiLineMsg{gen: gen, source: source, follower: follower, lines: lines, terminal: !ok}
+	}
+}
+
+func (m *MultiTailModel) resize() {
+	m.view.Width = max(m.width-4, 10)
+	m.view.Height = max(m.height-5, 5)
+	m.rendered = m.rendered[:0]
+	for _, e := range m.entries {
+		m.rendered = append(m.rendered, m.renderEntry(e))
+	}
+	m.showEntries()
+}
+
+// renderEntry renders a line of the merged stream with its job tag.
+func (m MultiTailModel) renderEntry(e multiEntry) string {
+	src := m.sources[e.source]
+	tag := src.tag.Render(fmt.Sprintf("%-*s", m.tagWidth, src.job)) + "│ "
+	line := tag + e.text
+	if strings.Contains(e.text, "\x1b") {
+		line += "\x1b[0m"
+	}
+	return wordwrap.String(line, m.view.Width)
+}
+
+func (m *MultiTailModel) showEntries() {
+	stickToBottom := m.following && !m.paused && m.view.AtBottom()
+	m.view.SetContent(strings.Join(m.rendered, "\n"))
+	if stickToBottom {
+		m.view.GotoBottom()
+	}
+}
+
+// addLines adds lines of a job's log to its tile and the merged stream.
+func (m *MultiTailModel) addLines(source int, texts []string) {
+	src := m.sources[source]
+	for _, text := range texts {
+		line := cleanLogLine(text)
+		src.lines = append(src.lines, line)
+		e := multiEntry{source: source, text: line}
+		m.entries = append(m.entries, e)
+		m.rendered = append(m.rendered, m.renderEntry(e))
+	}
+	if len(src.lines) > multiTailBacklog {
+		src.lines = src.lines[len(src.lines)-multiTailBacklog:]
+	}
+	if MaxLogLines > 0 && len(m.entries) > MaxLogLines {
+		m.entries = m.entries[len(m.entries)-MaxLogLines:]
+		m.rendered = m.rendered[len(m.rendered)-MaxLogLines:]
+	}
+	m.showEntries()
+}
+
+func (m MultiTailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		if msg.Width > 0 && msg.Height > 0 {
+			m.width, m.height = msg.Width, msg.Height
+			m.resize()
+		}
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, tailKeys.Quit):
+			// The parent handles switching back to the main view.
+			cmd := m.closeCmd()
+			for _, src := range m.sources {
+				src.follower = nil
+			}
+			return m, cmd
+		case key.Matches(msg, tailKeys.ShowStdout) && m.logsOf != "", key.Matches(msg, tailKeys.ShowStderr) && m.logsOf != "":
+			// Each file is one stream.
+			return m, nil
+		case key.Matches(msg, tailKeys.ShowStdout), key.Matches(msg, tailKeys.ShowStderr):
+			stream := "stdout"
+			if key.Matches(msg, tailKeys.ShowStderr) {
+				stream = "stderr"
+			}
+			if stream == m.stream {
+				return m, nil
+			}
+			closeCmd := m.closeCmd()
+			m.setStream(stream)
+			return m, tea.Batch(closeCmd, m.Init())
+		case key.Matches(msg, tailKeys.ToggleLayout):
+			m.grid = !m.grid
+			return m, nil
+		case key.Matches(msg, tailKeys.Follow):
+			m.following = !m.following
+			if m.following {
+				m.view.GotoBottom()
+			}
+			return m, nil
+		case key.Matches(msg, tailKeys.Pause):
+			m.paused = !m.paused
+			return m, nil
+		case key.Matches(msg, tailKeys.Bottom):
+			m.following = true
+			m.view.GotoBottom()
+			return m, nil
+		case key.Matches(msg, tailKeys.Top):
+			m.following = false
+			m.view.GotoTop()
+			return m, nil
+		}
+		if key.Matches(msg, scrollKeys.Up, scrollKeys.PageUp, scrollKeys.HalfPageUp) {
+			m.following = false
+		}
+		var cmd tea.Cmd
+		m.view, cmd = m.view.Update(msg)
+		return m, cmd
+
+	case multiStartMsg:
+		if msg.gen != m.gen {
+			return m, closeFollowerCmd(msg.start.follower)
+		}
+		initial := msg.start.initialLines
+		if len(initial) > multiTailBacklog {
+			initial = initial[len(initial)-multiTailBacklog:]
+		}
+		m.addLines(msg.source, initial)
+		if msg.start.startErr != nil || msg.start.follower == nil {
+			break
+		}
+		m.sources[msg.source].follower = msg.start.follower
+		return m, m.waitForLines(msg.source)
+
+	case multiLineMsg:
+		if msg.gen != m.gen || msg.follower != m.sources[msg.source].follower || msg.terminal {
+			break
+		}
+		m.addLines(msg.source, msg.lines)
+		return m, m.waitForLines(msg.source)
+	}
+	return m, nil
+}
+
+func (m MultiTailModel) View() string {
+	status := ""
+	if m.paused {
+		status = " [PAUSED]"
+	} else if m.following {
+		status = " [FOLLOW]"
+	}
+	title := fmt.Sprintf("%d JOBS %s%s", len(m.jobs), strings.ToUpper(m.stream), status)
+	if m.logsOf != "" {
+		title = fmt.Sprintf("%d LOGS OF JOB %s%s", len(m.jobs), m.logsOf, status)
+	}
+	header := lipgloss.NewStyle().Foreground(theme.TextStrong).Bold(true).Render(title)
+	if m.grid {
+		return lipgloss.JoinVertical(lipgloss.Left, header, m.renderGrid())
+	}
+	border := DefaultTailStyles().Border.BorderForeground(highlight)
+	return lipgloss.JoinVertical(lipgloss.Left, header, border.Render(m.view.View()))
+}
+
+// gridShape returns the columns and rows of the grid of n tiles.
+func gridShape(n, width int) (int, int) {
+	if n == 0 {
+		return 1, 1
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	cols = max(min(cols, width/multiTileMinWidth), 1)
+	return cols, (n + cols - 1) / cols
+}
+
+// renderGrid shows the latest lines of every job in a tile of its own.
+func (m MultiTailModel) renderGrid() string {
+	cols, rows := gridShape(len(m.sources), m.width)
+	tileWidth := max(m.width/cols-2, 10)
+	bodyHeight := max((m.height-3)/rows-3, 1)
+
+	var gridRows []string
+	for r := 0; r < rows; r++ {
+		var tiles []string
+		for c := 0; c < cols; c++ {
+			i := r*cols + c
+			if i >= len(m.sources) {
+				break
+			}
+			src := m.sources[i]
+			body := make([]string, bodyHeight)
+			lines := src.lines
+			if len(lines) > bodyHeight {
+				lines = lines[len(lines)-bodyHeight:]
+			}
+			for n, line := range lines {
+				body[n] = truncate.String(line, uint(tileWidth))
+				if strings.Contains(line, "\x1b") {
+					body[n] += "\x1b[0m"
+				}
+			}
+			name := "JOB " + src.job
+			if m.logsOf != "" {
+				name = src.job
+			}
+			title := truncate.String(src.tag.Render(name)+" "+lipgloss.NewStyle().Foreground(subtle).Render(src.path), uint(tileWidth))
+			tile := DefaultTailStyles().Border.BorderForeground(src.tag.GetForeground()).Width(tileWidth).
+				Render(lipgloss.JoinVertical(lipgloss.Left, title, strings.Join(body, "\n")))
+			tiles = append(tiles, tile)
+		}
+		gridRows = append(gridRows, lipgloss.JoinHorizontal(lipgloss.Top, tiles...))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, gridRows...)
+}
+
+// arrayJobID returns the array job a task ID ("123_4") belongs to.
+func arrayJobID(id string) (string, bool) {
+	base, task, ok := strings.Cut(id, "_")
+	return base, ok && base != "" && task != ""
+}
+
+// multiTailTargets returns the jobs the multi-job view opens on: the marked
+// jobs, or else the tasks of the selected array job. Pending task ranges
+// ("123_[1-100]") have no logs yet.
+func (m *Model) multiTailTargets() []string {
+	var ids []string
+	if len(m.marked) > 0 {
+		seen := make(map[string]bool)
+		for _, j := range m.jobs {
+			if m.marked[j.JobID] && !seen[j.JobID] {
+				ids, seen[j.JobID] = append(ids, j.JobID), true
+			}
+		}
+		var gone []string
+		for id := range m.marked {
+			if !seen[id] {
+				gone = append(gone, id)
+			}
+		}
+		sort.Strings(gone)
+		ids = append(ids, gone...)
+	} else if job := m.getSelectedJob(); job != nil {
+		base, ok := arrayJobID(job.JobID)
+		if !ok {
+			return nil
+		}
+		for _, j := range m.jobs {
+			if b, ok := arrayJobID(j.JobID); ok && b == base && !strings.Contains(j.JobID, "[") {
+				ids = append(ids, j.JobID)
+			}
+		}
+	}
+	if len(ids) > maxMultiTailJobs {
+		ids = ids[:maxMultiTailJobs]
+	}
+	return ids
+}
+
+// resolveMultiTailCmd resolves the logs of the jobs of the multi-job view.
+func (m Model) resolveMultiTailCmd(ids []string) tea.Cmd {
+	return func() tea.Msg {
+		var msg multiTailPathsMsg
+		for _, id := range ids {
+			out, errPath, err := m.resolveJobLogPaths(id)
+			if err != nil && msg.err == nil {
+				msg.err = fmt.Errorf("job %s: %w", id, err)
+			}
+			msg.jobs = append(msg.jobs, multiJob{id: id, stdout: out, stderr: errPath})
+		}
+		return msg
+	}
+}
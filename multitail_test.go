@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMultiTailTargetsMarkedJobsOrArrayTasks(t *testing.T) {
+	m := NewModel()
+	m.jobs = []Job{
+		{JobID: "7_1", Status: "RUNNING"},
+		{JobID: "7_2", Status: "RUNNING"},
+		{JobID: "7_[3-9]", Status: "PENDING"},
+		{JobID: "8", Status: "RUNNING"},
+	}
+	m.updateTable()
+	if got := m.multiTailTargets(); !reflect.DeepEqual(got, []string{"7_1", "7_2"}) {
+		t.Fatalf("expected the running tasks of array 7, got %v", got)
+	}
+
+	m.marked = map[string]bool{"8": true, "7_2": true}
+	if got := m.multiTailTargets(); !reflect.DeepEqual(got, []string{"7_2", "8"}) {
+		t.Fatalf("expected the marked jobs, got %v", got)
+	}
+
+	m.marked = nil
+	m.table.SetCursor(3)
+	if got := m.multiTailTargets(); got != nil {
+		t.Fatalf("a plain job has no tasks, got %v", got)
+	}
+}
+
+func TestMultiTailMergesAndTilesJobs(t *testing.T) {
+	m := NewMultiTailModel([]multiJob{
+		{id: "7_1", stdout: "/logs/7_1.out"},
+		{id: "7_12", stdout: "/logs/7_12.out"},
+	}, 100, 20)
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(MultiTailModel)
+	}
+	update(multiStartMsg{gen: m.gen, source: 0, start: tailStartMsg{initialLines: []string{"epoch 1"}}})
+	update(multiStartMsg{gen: m.gen, source: 1, start: tailStartMsg{initialLines: []string{"epoch 9"}}})
+	update(multiStartMsg{gen: m.gen - 1, source: 1, start: tailStartMsg{initialLines: []string{"stale"}}})
+
+	view := stripANSI(m.View())
+	if !strings.Contains(view, "7_1 │ epoch 1") || !strings.Contains(view, "7_12│ epoch 9") || strings.Contains(view, "stale") {
+		t.Fatalf("expected tagged lines of both jobs:\n%s", view)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}})
+	view = stripANSI(m.View())
+	if !strings.Contains(view, "JOB 7_1 /logs/7_1.out") || !strings.Contains(view, "JOB 7_12") {
+		t.Fatalf("expected a tile per job:\n%s", view)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	if m.stream != "stderr" || len(m.entries) != 0 {
+		t.Fatalf("expected the stderr of the jobs to be followed anew")
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The command palette finds any action of the current view by name, shows
+// its key, and runs it, bound or not. In the main view it also runs typed
+// commands with arguments (":cancel 12345").
+
+// paletteRows is how many matches the palette lists.
+const paletteRows = 12
+
+// paletteCommand is a typed command of the main view.
+type paletteCommand struct {
+	name  string
+	usage string // arguments, e.g. "<job> [stdout|stderr]"
+	desc  string
+	// minArgs is how many arguments the command needs.
+	minArgs int
+	run     func(m *Model, args []string) (tea.Cmd, error)
+}
+
+var paletteCommands = []paletteCommand{
+	{name: "cancel", usage: "<job>", desc: "cancel a job", minArgs: 1, run: (*Model).cancelCommand},
+	{name: "logs", usage: "<job> [stdout|stderr|both|merged]", desc: "open the logs of a job", minArgs: 1, run: (*Model).logsCommand},
+	{name: "compare", usage: "<job> <job>", desc: "compare the logs of two jobs", minArgs: 2, run: (*Model).compareCommand},
+	{name: "browse", usage: "<job>", desc: "browse the working directory of a job", minArgs: 1, run: (*Model).browseCommand},
+	{name: "filter", usage: "[text] [field=value]", desc: "filter jobs (partition, state, user, node, name)", run: (*Model).filterCommand},
+	{name: "history", usage: "[days]", desc: "show finished jobs, of the last days", run: (*Model).historyCommand},
+	{name: "live", desc: "show queued and running jobs", run: (*Model).liveCommand},
+}
+
+func findPaletteCommand(name string) (paletteCommand, bool) {
+	for _, c := range paletteCommands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return paletteCommand{}, false
+}
+
+// paletteEntry is an action or a command listed by the palette.
+type paletteEntry struct {
+	title   string
+	keys    string // the keys of an action, or what a command does
+	binding *key.Binding
+	command *paletteCommand
+}
+
+// commandPalette is the palette's prompt and the entries matching it.
+type commandPalette struct {
+	input   textinput.Model
+	inLog   bool // over the log view: its actions, and no commands
+	entries []paletteEntry
+	cursor  int
+	err     error
+}
+
+// paletteEntries returns every action of the main or the log view, then the
+// commands of the main view.
+func paletteEntries(inLog bool) []paletteEntry {
+	var actions []keyAction
+	if inLog {
+		actions = keyActions(&tailKeys)
+	} else {
+		actions = keyActions(&keys)
+	}
+	var entries []paletteEntry
+	for _, a := range actions {
+		switch a.binding {
+		case &keys.Palette, &keys.Up, &keys.Down, &tailKeys.Palette:
+			continue
+		}
+		// Unbound actions have lost their help.
+		title, bound := a.binding.Help().Desc, a.binding.Help().Key
+		if title == "" {
+			title = strings.ReplaceAll(a.name, "_", " ")
+		}
+		if !a.binding.Enabled() {
+			bound = "unbound"
+		}
+		entries = append(entries, paletteEntry{title: title, keys: bound, binding: a.binding})
+	}
+	if inLog {
+		return entries
+	}
+	for i := range paletteCommands {
+		c := &paletteCommands[i]
+		entries = append(entries, paletteEntry{title: strings.TrimSpace(":" + c.name + " " + c.usage), keys: c.desc, command: c})
+	}
+	return entries
+}
+
+// fuzzyScore scores how well query matches text as a subsequence, ignoring
+// case: matches at word starts and runs of matches score higher. It is -1
+// when text does not contain query.
+func fuzzyScore(query, text string) int {
+	q, t := []rune(strings.ToLower(query)), []rune(strings.ToLower(text))
+	score, qi, prev := 0, 0, -2
+	for i := 0; i < len(t) && qi < len(q); i++ {
+		if t[i] != q[qi] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		if i == 0 || strings.ContainsRune(" _:/-", t[i-1]) {
+			score += 3
+		}
+		prev, qi = i, qi+1
+	}
+	if qi < len(q) {
+		return -1
+	}
+	return score
+}
+
+// filter lists the entries matching the prompt, best first. A prompt
+// starting with the name of a command lists that command.
+func (p *commandPalette) filter() {
+	query := strings.TrimSpace(strings.TrimPrefix(p.input.Value(), ":"))
+	all := paletteEntries(p.inLog)
+	p.entries, p.cursor = nil, 0
+	if fields := strings.Fields(query); len(fields) > 0 && !p.inLog {
+		if _, ok := findPaletteCommand(fields[0]); ok && len(fields) > 1 {
+			for _, e := range all {
+				if e.command != nil && e.command.name == fields[0] {
+					p.entries = []paletteEntry{e}
+				}
+			}
+			return
+		}
+	}
+	type scored struct {
+		entry paletteEntry
+		score int
+	}
+	var matches []scored
+	for _, e := range all {
+		if score := fuzzyScore(query, e.title); score >= 0 {
+			matches = append(matches, scored{e, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	for _, s := range matches {
+		p.entries = append(p.entries, s.entry)
+	}
+}
+
+// openPalette opens the palette over the main view, or the log view.
+func (m *Model) openPalette(inLog bool) tea.Cmd {
+	ti := textinput.New()
+	ti.Placeholder = "action, or command like cancel 12345"
+	if inLog {
+		ti.Placeholder = "action"
+	}
+	ti.CharLimit = 200
+	ti.Width = 50
+	ti.Prompt = ":"
+	ti.TextStyle = lipgloss.NewStyle().Foreground(textStrong)
+	ti.PlaceholderStyle = lipgloss.NewStyle().Foreground(subtle)
+	ti.Cursor.Style = lipgloss.NewStyle().Foreground(highlight)
+	m.palette = &commandPalette{input: ti, inLog: inLog}
+	m.palette.filter()
+	return m.palette.input.Focus()
+}
+
+// updatePalette handles the keys of the palette.
+func (m Model) updatePalette(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.palette
+	switch {
+	case key.Matches(msg, dialogKeys.Back):
+		m.palette = nil
+		return m, nil
+	case key.Matches(msg, dialogKeys.HistoryPrev, scrollKeys.Up) && msg.Type != tea.KeyRunes:
+		p.cursor = max(p.cursor-1, 0)
+		return m, nil
+	case key.Matches(msg, dialogKeys.HistoryNext, scrollKeys.Down) && msg.Type != tea.KeyRunes:
+		p.cursor = max(min(p.cursor+1, len(p.entries)-1), 0)
+		return m, nil
+	case key.Matches(msg, dialogKeys.NextField):
+		// Completes the selected command.
+		if p.cursor < len(p.entries) && p.entries[p.cursor].command != nil {
+			p.input.SetValue(p.entries[p.cursor].command.name + " ")
+			p.input.CursorEnd()
+			p.filter()
+		}
+		return m, nil
+	case key.Matches(msg, dialogKeys.Confirm):
+		return m.runPalette()
+	}
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	p.err = nil
+	p.filter()
+	return m, cmd
+}
+
+// runPalette runs the typed command, or the selected entry.
+func (m Model) runPalette() (tea.Model, tea.Cmd) {
+	p := m.palette
+	fields := strings.Fields(strings.TrimPrefix(p.input.Value(), ":"))
+	var c paletteCommand
+	var known bool
+	if len(fields) > 0 && !p.inLog {
+		c, known = findPaletteCommand(fields[0])
+	}
+	if !known && p.cursor < len(p.entries) {
+		e := p.entries[p.cursor]
+		if e.binding != nil {
+			m.palette = nil
+			return m.runAction(e.binding)
+		}
+		c, known, fields = *e.command, true, []string{e.command.name}
+	}
+	if !known {
+		p.err = fmt.Errorf("no action or command matches %q", p.input.Value())
+		return m, nil
+	}
+	if len(fields)-1 < c.minArgs {
+		// Asks for the arguments.
+		p.input.SetValue(c.name + " ")
+		p.input.CursorEnd()
+		p.filter()
+		return m, nil
+	}
+	cmd, err := c.run(&m, fields[1:])
+	if err != nil {
+		p.err = err
+		return m, nil
+	}
+	m.palette = nil
+	return m, cmd
+}
+
+// runAction runs an action of the main or the log view, as its key does.
+func (m Model) runAction(b *key.Binding) (tea.Model, tea.Cmd) {
+	if !m.inTailView {
+		cmd, _ := m.handleAction(b)
+		return m, cmd
+	}
+	var cmds []tea.Cmd
+	switch b {
+	case &tailKeys.ToggleHelp:
+		m.help.ShowAll = !m.help.ShowAll
+		return m, nil
+	case &tailKeys.ToggleMouse:
+		cmds = append(cmds, m.toggleMouse())
+	}
+	var cmd tea.Cmd
+	m.tailModel, cmd = m.tailModel.runAction(b)
+	cmds = append(cmds, cmd)
+	m.mouseEnabled = m.tailModel.mouseEnabled
+	if b == &tailKeys.Quit {
+		cmds = append(cmds, m.leaveTailView()...)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// jobByID returns a known job, or one with just an ID.
+func (m Model) jobByID(id string) Job {
+	for _, j := range m.jobs {
+		if j.JobID == id {
+			return j
+		}
+	}
+	return Job{JobID: id}
+}
+
+func (m *Model) cancelCommand(args []string) (tea.Cmd, error) {
+	job := m.jobByID(args[0])
+	m.cancelCandidate = &job
+	m.confirmingCancel = true
+	return nil, nil
+}
+
+func (m *Model) logsCommand(args []string) (tea.Cmd, error) {
+	mode := TailModeBoth
+	if len(args) > 1 {
+		modes := map[string]TailMode{"stdout": TailModeStdout, "stderr": TailModeStderr, "both": TailModeBoth, "merged": TailModeMerged}
+		var ok bool
+		if mode, ok = modes[args[1]]; !ok {
+			return nil, fmt.Errorf("logs: unknown stream %q (want stdout, stderr, both or merged)", args[1])
+		}
+	}
+	m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
+	return m.resolveTailPathsCmd(args[0], mode), nil
+}
+
+func (m *Model) compareCommand(args []string) (tea.Cmd, error) {
+	m.detailsTable.SetRows([]table.Row{{"Status", "Resolving logs..."}})
+	return m.resolveComparePathsCmd(args[0], args[1]), nil
+}
+
+func (m *Model) browseCommand(args []string) (tea.Cmd, error) {
+	m.detailsTable.SetRows([]table.Row{{"Status", "Resolving working directory..."}})
+	return m.resolveWorkDirCmd(args[0]), nil
+}
+
+// jobFields are the fields :filter matches with field=value.
+var jobFields = map[string]func(Job) string{
+	"partition": func(j Job) string { return j.Partition },
+	"state":     func(j Job) string { return j.Status + " " + j.State() },
+	"user":      func(j Job) string { return j.User },
+	"node":      func(j Job) string { return j.NodeList },
+	"name":      func(j Job) string { return j.Name },
+}
+
+// jobMatchesFields reports whether every field of a job contains its
+// filter value, ignoring case.
+func jobMatchesFields(j Job, filter map[string]string) bool {
+	for field, value := range filter {
+		if !strings.Contains(strings.ToLower(jobFields[field](j)), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterCommand filters the jobs by field=value arguments; other words go
+// to the filter box, which matches the name or ID.
+func (m *Model) filterCommand(args []string) (tea.Cmd, error) {
+	var words []string
+	fields := map[string]string{}
+	for _, arg := range args {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			words = append(words, arg)
+			continue
+		}
+		field = strings.ToLower(field)
+		if _, known := jobFields[field]; !known {
+			return nil, fmt.Errorf("filter: unknown field %q (want partition, state, user, node or name)", field)
+		}
+		fields[field] = strings.ToLower(value)
+	}
+	m.fieldFilter = fields
+	m.filterInput.SetValue(strings.Join(words, " "))
+	m.updateTable()
+	return nil, nil
+}
+
+func (m *Model) historyCommand(args []string) (tea.Cmd, error) {
+	if len(args) > 0 {
+		days, err := strconv.Atoi(args[0])
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("history: %q is not a number of days", args[0])
+		}
+		m.historyDays = days
+	}
+	return m.switchMode(modeHistory), nil
+}
+
+func (m *Model) liveCommand([]string) (tea.Cmd, error) {
+	return m.switchMode(modeLive), nil
+}
+
+func (m Model) viewPalette() string {
+	p := m.palette
+	width := max(min(m.width-14, 80), 30)
+	var b strings.Builder
+	b.WriteString(filterBoxStyle.Width(width).Render(p.input.View()))
+	b.WriteString("\n")
+	first := max(min(p.cursor-paletteRows/2, len(p.entries)-paletteRows), 0)
+	for i := first; i < len(p.entries) && i < first+paletteRows; i++ {
+		e := p.entries[i]
+		keyWidth := min(runeLen(e.keys), width/2)
+		title := shortenText(e.title, width-keyWidth-2)
+		row := title + strings.Repeat(" ", max(width-runeLen(title)-keyWidth, 1)) +
+			lipgloss.NewStyle().Foreground(subtle).Render(shortenText(e.keys, keyWidth))
+		if i == p.cursor {
+			row = tailSelectionStyle.Render(stripANSI(row))
+		}
+		b.WriteString("\n" + row)
+	}
+	if len(p.entries) == 0 {
+		b.WriteString("\n" + lipgloss.NewStyle().Foreground(subtle).Render("(no match)"))
+	}
+	b.WriteString("\n\n")
+	if p.err != nil {
+		b.WriteString(fmt.Sprintf("⚠ %v", p.err))
+	} else {
+		b.WriteString(hints("  ",
+			hint("select", scrollKeys.Up, scrollKeys.Down),
+			hint("run", dialogKeys.Confirm),
+			hint("complete", dialogKeys.NextField),
+			hint("close", dialogKeys.Back)))
+	}
+	return lipgloss.Place(m.width, m.height,
+		lipgloss.Center, lipgloss.Center,
+		dialogStyle.Copy().Width(width+10).Align(lipgloss.Left).Render(b.String()),
+	)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFuzzyScorePrefersWordStartsAndRuns(t *testing.T) {
+	if fuzzyScore("xyz", "cancel job") != -1 {
+		t.Fatalf("expected no match")
+	}
+	if fuzzyScore("cj", "cancel job") <= fuzzyScore("cj", "select nice job") {
+		t.Fatalf("expected word starts to score higher")
+	}
+	if fuzzyScore("time", "timestamps") <= fuzzyScore("time", "toggle items mem") {
+		t.Fatalf("expected runs to score higher")
+	}
+}
+
+func TestPaletteRunsCommandsAndActions(t *testing.T) {
+	saved := keyMaps{keys, tailKeys, scrollKeys, dialogKeys}
+	t.Cleanup(saved.install)
+
+	m := NewModel()
+	m.applyWindowSize(160, 40)
+	m.jobs = []Job{
+		{JobID: "1", Name: "train", Partition: "gpu", Status: "RUNNING"},
+		{JobID: "2", Name: "prep", Partition: "cpu", Status: "RUNNING"},
+	}
+	m.updateTable()
+	update := func(msgs ...tea.KeyMsg) {
+		for _, msg := range msgs {
+			model, _ := m.Update(msg)
+			m = model.(Model)
+		}
+	}
+	typed := func(s string) []tea.KeyMsg {
+		var msgs []tea.KeyMsg
+		for _, r := range s {
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+		return msgs
+	}
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+
+	update(typed(":")...)
+	if m.palette == nil || !strings.Contains(m.View(), "refresh") {
+		t.Fatalf("expected : to open the palette:\n%s", m.View())
+	}
+	update(typed("canc")...)
+	if view := m.View(); !strings.Contains(view, ":cancel <job>") || strings.Contains(view, "refresh") {
+		t.Fatalf("expected the palette to list what matches:\n%s", view)
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc}, tea.KeyMsg{Type: tea.KeyCtrlP})
+	update(typed("filter partition=gpu")...)
+	update(enter)
+	if m.palette != nil || len(m.filtered) != 1 || m.filtered[0].JobID != "1" {
+		t.Fatalf("expected :filter to keep job 1, got %+v", m.filtered)
+	}
+	update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	update(typed("filter gpu")...)
+	update(enter)
+	if len(m.filtered) != 0 {
+		t.Fatalf("expected plain words to match the name or ID only, got %+v", m.filtered)
+	}
+	update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	update(typed("filter queue=gpu")...)
+	update(enter)
+	if m.palette == nil || !strings.Contains(m.View(), "unknown field") {
+		t.Fatalf("expected an unknown field to keep the palette open")
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc})
+
+	update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	update(typed("history x")...)
+	update(enter)
+	if m.palette == nil || m.palette.err == nil || !strings.Contains(m.View(), "not a number of days") {
+		t.Fatalf("expected a bad argument to keep the palette open")
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc})
+	update(typed(":cancel 2")...)
+	update(enter)
+	if !m.confirmingCancel || m.cancelCandidate.JobID != "2" || m.cancelCandidate.Name != "prep" {
+		t.Fatalf("expected :cancel 2 to ask to cancel job 2")
+	}
+	update(typed("n")...)
+
+	// An unbound action is still in the palette, and runs from it.
+	keys.Pause.Unbind()
+	paused := m.paused
+	update(typed(":")...)
+	update(typed("pause")...)
+	if e := m.palette.entries; len(e) == 0 || e[0].keys != "unbound" {
+		t.Fatalf("expected the unbound action first, got %+v", e)
+	}
+	update(enter)
+	if m.paused == paused || keys.Pause.Enabled() {
+		t.Fatalf("expected the unbound action to run and stay unbound")
+	}
+
+	// Over the log view, the palette lists its actions.
+	m.openTailView(NewTailModel("1", "", "", 160, 40, TailModeStdout))
+	update(typed(":")...)
+	if !m.palette.inLog {
+		t.Fatalf("expected the log view's palette")
+	}
+	update(typed("timest")...)
+	update(enter)
+	if m.palette != nil || !m.inTailView || !m.tailModel.showTimestamps {
+		t.Fatalf("expected the palette to toggle timestamps in the log view")
+	}
+	update(typed(":back")...)
+	update(enter)
+	if m.palette != nil || m.inTailView {
+		t.Fatalf("expected back from the palette to leave the log view")
+	}
+}
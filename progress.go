@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Progress bars (tqdm, Keras, pip, ...) redraw one line in place with
+// carriage returns. Log lines are shown the way a terminal would show them,
+// and the latest progress of running jobs is shown in the job table.
+
+// eraseLineRegexp matches "erase in line" sequences, which progress bars
+// send after a carriage return to clear what was there.
+var eraseLineRegexp = regexp.MustCompile(`\x1b\[[0-2]?K`)
+
+// collapseCR renders a line the way a terminal shows it: a carriage return
+// moves back to the start of the line and what follows overwrites what was
+// there, so a redrawn progress bar shows its latest state.
+func collapseCR(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if !strings.Contains(line, "\r") {
+		return line
+	}
+	segments := strings.Split(line, "\r")
+	shown := segments[0]
+	for _, seg := range segments[1:] {
+		if eraseLineRegexp.MatchString(seg) {
+			shown = seg
+			continue
+		}
+		tail := cutVisible(shown, runeLen(stripANSI(seg)))
+		if tail != "" && strings.Contains(seg, "\x1b") && !strings.HasPrefix(tail, "\x1b[0") {
+			// The colors of the redrawn part end where it does.
+			tail = "\x1b[0m" + tail
+		}
+		shown = seg + tail
+	}
+	return shown
+}
+
+// cutVisible returns what follows the first n visible runes of s. It starts
+// with the colors in effect there, when s has any.
+func cutVisible(s string, n int) string {
+	sgr, styled := "", false
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			if loc := ansiEscapeRegexp.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+				seq := s[i : i+loc[1]]
+				if strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+					sgr, styled = applySGR(sgr, seq[2:len(seq)-1]), true
+				}
+				i += loc[1]
+				continue
+			}
+		}
+		if n == 0 {
+			if styled {
+				return "\x1b[0;" + sgr + "m" + s[i:]
+			}
+			return s[i:]
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n--
+	}
+	return ""
+}
+
+// compactCR shrinks an unterminated line that a progress bar keeps
+// redrawing: everything before its last carriage return is collapsed, the
+// rest is kept as is since it may still be overwritten.
+func compactCR(line []byte) []byte {
+	i := bytes.LastIndexByte(line, '\r')
+	if i <= 0 || bytes.IndexByte(line[:i], '\r') < 0 {
+		return line
+	}
+	compact := append([]byte(collapseCR(string(line[:i]))), '\r')
+	return append(compact, line[i+1:]...)
+}
+
+// jobProgress is what a progress bar says about a running job.
+type jobProgress struct {
+	Percent float64
+	ETA     string // "" when unknown
+}
+
+func (p jobProgress) String() string {
+	text := strconv.Itoa(int(math.Floor(p.Percent))) + "%"
+	if p.ETA != "" {
+		text += " ETA " + p.ETA
+	}
+	return text
+}
+
+var (
+	// progressBarRegexp recognizes a bar: tqdm's "|███▌  |", Keras'
+	// "[=====>....]", pip's "━━━━╸".
+	progressBarRegexp = regexp.MustCompile(`[█▉▊▋▌▍▎▏━#=]{3,}|\|[ █▉▊▋▌▍▎▏]*\||\[[=>.]{3,}\]`)
+	percentRegexp     = regexp.MustCompile(`(?:^|[^\w.])(\d{1,3}(?:\.\d+)?) ?%`)
+	// fractionRegexp is the "450/1000" of bars without a percentage.
+	fractionRegexp = regexp.MustCompile(`(?:^|[^\w.])(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)\b`)
+	// tqdmETARegexp is the remaining time of tqdm's "[00:12<00:15, 36.1it/s]".
+	tqdmETARegexp = regexp.MustCompile(`\[[^\]<]*<([^,\]]+)`)
+	etaRegexp     = regexp.MustCompile(`(?i)\beta:? *(\d[\d:.]*[hms]?)`)
+)
+
+// parseProgress reads the progress of a progress bar line.
+func parseProgress(line string) (jobProgress, bool) {
+	line = stripANSI(line)
+	if !progressBarRegexp.MatchString(line) {
+		return jobProgress{}, false
+	}
+	var p jobProgress
+	found := false
+	for _, m := range percentRegexp.FindAllStringSubmatch(line, -1) {
+		if v, err := strconv.ParseFloat(m[1], 64); err == nil && v <= 100 {
+			p.Percent, found = v, true
+		}
+	}
+	if !found {
+		m := fractionRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return jobProgress{}, false
+		}
+		done, _ := strconv.ParseFloat(m[1], 64)
+		total, _ := strconv.ParseFloat(m[2], 64)
+		if total <= 0 || done > total {
+			return jobProgress{}, false
+		}
+		p.Percent = 100 * done / total
+	}
+	if m := tqdmETARegexp.FindStringSubmatch(line); m != nil && strings.TrimSpace(m[1]) != "?" {
+		p.ETA = strings.TrimSpace(m[1])
+	} else if m := etaRegexp.FindStringSubmatch(line); m != nil {
+		p.ETA = m[1]
+	}
+	return p, true
+}
+
+// progressTailBytes is how much of the end of a log is searched for a
+// progress bar. A bar redrawn for hours is one huge line, so lines are not
+// read whole.
+const progressTailBytes = 64 << 10
+
+// readLatestProgress returns the latest progress bar state in the end of a
+// log and when the log was last written.
+func readLatestProgress(path string) (jobProgress, time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return jobProgress{}, time.Time{}, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || sniffLogCompression(f) != logPlain {
+		return jobProgress{}, time.Time{}, false
+	}
+	from := info.Size() - progressTailBytes
+	if from < 0 {
+		from = 0
+	}
+	buf := make([]byte, info.Size()-from)
+	n, _ := f.ReadAt(buf, from)
+	segments := strings.FieldsFunc(string(buf[:n]), func(r rune) bool { return r == '\r' || r == '\n' })
+	for i := len(segments) - 1; i >= 0; i-- {
+		if p, ok := parseProgress(segments[i]); ok {
+			return p, info.ModTime(), true
+		}
+	}
+	return jobProgress{}, time.Time{}, false
+}
+
+// maxProgressJobs bounds how many running jobs have their logs read on
+// every refresh.
+const maxProgressJobs = 50
+
+// progressMsg carries what the logs of running jobs say: the text of their
+// progress column and when they were last written.
+type progressMsg struct {
+	progress   map[string]string
+	lastOutput map[string]time.Time
+}
+
+// logPathCache remembers the log paths of running jobs, so each is resolved
+// once rather than on every refresh even without the job store. Failed
+// lookups (the job's scontrol record not there yet, a slow slurmctld) are
+// retried, less and less often.
+type logPathCache struct {
+	mu       sync.Mutex
+	paths    map[string][2]string
+	failures map[string]lookupFailure
+
+	resolve func(string) (string, string, error)
+	now     func() time.Time
+}
+
+// lookupFailure is when a job's paths can be looked up again, and how long
+// the next failure waits.
+type lookupFailure struct {
+	retryAt time.Time
+	backoff time.Duration
+}
+
+const (
+	logPathRetryMin = 30 * time.Second
+	logPathRetryMax = 10 * time.Minute
+)
+
+func newLogPathCache() *logPathCache {
+	return &logPathCache{
+		paths:    make(map[string][2]string),
+		failures: make(map[string]lookupFailure),
+		resolve:  ResolveLogPaths,
+		now:      time.Now,
+	}
+}
+
+// lookup returns the stdout and stderr paths of a job, or none while a
+// failed lookup waits to be retried.
+func (c *logPathCache) lookup(id string, store *jobStore) (string, string) {
+	c.mu.Lock()
+	paths, ok := c.paths[id]
+	failure, failed := c.failures[id]
+	c.mu.Unlock()
+	if ok {
+		return paths[0], paths[1]
+	}
+	if failed && c.now().Before(failure.retryAt) {
+		return "", ""
+	}
+	if rec, ok := store.Lookup(id); ok && (rec.Stdout != "" || rec.Stderr != "") {
+		paths = [2]string{rec.Stdout, rec.Stderr}
+	} else if out, errPath, err := c.resolve(id); err == nil {
+		_ = store.RecordLogPaths(id, out, errPath)
+		paths = [2]string{out, errPath}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if paths == [2]string{} {
+		failure.backoff = min(max(2*failure.backoff, logPathRetryMin), logPathRetryMax)
+		failure.retryAt = c.now().Add(failure.backoff)
+		c.failures[id] = failure
+		return "", ""
+	}
+	delete(c.failures, id)
+	c.paths[id] = paths
+	return paths[0], paths[1]
+}
+
+// retain forgets the jobs not in ids.
+func (c *logPathCache) retain(ids map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.paths {
+		if !ids[id] {
+			delete(c.paths, id)
+		}
+	}
+	for id := range c.failures {
+		if !ids[id] {
+			delete(c.failures, id)
+		}
+	}
+}
+
+// lastWritten returns when the newest of a job's logs was last written, zero
+// when neither exists.
+func lastWritten(stdout, stderr string) time.Time {
+	var last time.Time
+	for _, path := range []string{stdout, stderr} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+// progressCmd reads the latest progress of the running jobs from their
+// logs, and when they last wrote output. tqdm writes to stderr and most
+// other tools to stdout, so the most recently written of the two wins.
+func (m Model) progressCmd(jobs []Job) tea.Cmd {
+	if m.appMode != modeLive || m.logPaths == nil {
+		return nil
+	}
+	var running []string
+	for _, j := range jobs {
+		if j.State() == "R" && len(running) < maxProgressJobs {
+			running = append(running, j.JobID)
+		}
+	}
+	cache, store := m.logPaths, m.store
+	return func() tea.Msg {
+		ids := make(map[string]bool, len(running))
+		msg := progressMsg{progress: map[string]string{}, lastOutput: map[string]time.Time{}}
+		for _, id := range running {
+			ids[id] = true
+			stdout, stderr := cache.lookup(id, store)
+			if last := lastWritten(stdout, stderr); !last.IsZero() {
+				msg.lastOutput[id] = last
+			}
+			var latest time.Time
+			for _, path := range []string{stdout, stderr} {
+				if path == "" {
+					continue
+				}
+				if p, at, ok := readLatestProgress(path); ok && at.After(latest) {
+					msg.progress[id], latest = p.String(), at
+				}
+			}
+		}
+		cache.retain(ids)
+		return msg
+	}
+}
+
+// setLiveLine records the live line of a stream and reports whether it
+// changed.
+func (m *TailModel) setLiveLine(pane, line string) bool {
+	live := &m.stdoutLive
+	if pane == "stderr" {
+		live = &m.stderrLive
+	}
+	line = cleanLogLine(line)
+	if line == *live {
+		return false
+	}
+	*live = line
+	return true
+}
+
+// liveLines returns the live lines shown below a pane's lines.
+func (m TailModel) liveLines(pane string) []string {
+	var lines []string
+	switch pane {
+	case "stdout", "stderr":
+		live := m.stdoutLive
+		if pane == "stderr" {
+			live = m.stderrLive
+		}
+		if live != "" {
+			lines = append(lines, live)
+		}
+	case "merged":
+		if m.stdoutLive != "" {
+			lines = append(lines, mergedEntry{pane: "stdout", text: m.stdoutLive}.format(m.showTimestamps))
+		}
+		if m.stderrLive != "" && m.stderrPath != m.stdoutPath {
+			lines = append(lines, mergedEntry{pane: "stderr", text: m.stderrLive}.format(m.showTimestamps))
+		}
+	}
+	return lines
+}
+
+// showPaneContent sets the content of a pane's view: its rendered lines,
+// then its live lines. Live lines are redrawn on every update, so they are
+// not part of the pane's lines and can't be searched or selected.
+func (m *TailModel) showPaneContent(pane string) {
+	refs := m.paneRefs(pane)
+	if refs.builder == nil {
+		return
+	}
+	live := m.liveLines(pane)
+	if len(live) == 0 {
+		refs.view.SetContent(refs.builder.String())
+		return
+	}
+	var b strings.Builder
+	b.WriteString(refs.builder.String())
+	for _, line := range live {
+		for _, visual := range parseStyledLines(m.wrapLine(line, refs.view.Width)) {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(renderStyledLine(visual, nil, levelNone, 0, 0, !m.stripColors))
+		}
+	}
+	refs.view.SetContent(b.String())
+}
+
+// showLiveLine redraws the panes showing a stream after its live line
+// changed, keeping a followed pane at the bottom.
+func (m *TailModel) showLiveLine(pane string) {
+	panes := []string{pane}
+	if m.mode == TailModeMerged {
+		panes = append(panes, "merged")
+	}
+	for _, p := range panes {
+		view := m.paneRefs(p).view
+		stickToBottom := m.following && !m.paused && view.AtBottom()
+		m.showPaneContent(p)
+		if stickToBottom {
+			view.GotoBottom()
+		}
+	}
+}
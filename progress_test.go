@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCollapseCROverwritesLikeATerminal(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"ends with cr\r", "ends with cr"},
+		{"\r 10%|#   |\r 50%|##  |\r100%|####|", "100%|####|"},
+		// A shorter redraw leaves the end of the longer one.
+		{"downloading 100 files\rdone", "doneloading 100 files"},
+		// Unless it erases the line first.
+		{"downloading 100 files\r\x1b[2Kdone", "\x1b[2Kdone"},
+		{"\x1b[32mold text\x1b[0m\rnew", "new\x1b[0;32m text\x1b[0m"},
+	}
+	for _, c := range cases {
+		if got := collapseCR(c.in); got != c.want {
+			t.Errorf("collapseCR(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+	if got := cleanLogLine("downloading 100 files\r\x1b[2Kdone"); got != "done" {
+		t.Errorf("cleanLogLine dropped the wrong part: %q", got)
+	}
+}
+
+func TestCompactCRKeepsWhatTheTerminalShows(t *testing.T) {
+	line := "\r 10%|#   | 1/10\r 20%|##  | 2/10\r 3"
+	compact := compactCR([]byte(line))
+	if len(compact) >= len(line) {
+		t.Fatalf("expected the line to shrink, got %q", compact)
+	}
+	// Whatever arrives next, the result must be the same.
+	for _, rest := range []string{"0%|### | 3/10", "", "\r done"} {
+		if got, want := collapseCR(string(compact)+rest), collapseCR(line+rest); got != want {
+			t.Errorf("after %q: got %q, want %q", rest, got, want)
+		}
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	cases := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"Epoch 1:  45%|████▌     | 450/1000 [00:12<00:15, 36.1it/s]", "45% ETA 00:15", true},
+		{"  0%|          | 0/1000 [00:00<?, ?it/s]", "0%", true},
+		{"450/1000 [=============>................] - ETA: 15s - loss: 0.31", "45% ETA 15s", true},
+		{"   ━━━━━━━━━━━━━━━━━━━━╸━━━━━━━━━━━━━━━━━━━ 45.2/100.0 MB 3.1 MB/s eta 0:00:18", "45% ETA 0:00:18", true},
+		{"GPU utilization 95%", "", false},
+		{"step 450/1000 loss 0.31", "", false},
+	}
+	for _, c := range cases {
+		p, ok := parseProgress(c.line)
+		if ok != c.ok || (ok && p.String() != c.want) {
+			t.Errorf("parseProgress(%q) = %q, %v; want %q, %v", c.line, p.String(), ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestReadLatestProgressReadsOnlyTheEndOfALog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.err")
+	var b strings.Builder
+	b.WriteString("loading data\n")
+	for i := 0; i <= 60000; i++ {
+		b.WriteString("\r 10%|#         | 100/1000 [00:10<01:30, 10.0it/s]")
+	}
+	b.WriteString("\r 42%|####▏     | 420/1000 [00:42<00:58, 10.0it/s]")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, _, ok := readLatestProgress(path)
+	if !ok || p.String() != "42% ETA 00:58" {
+		t.Fatalf("got %q, %v", p.String(), ok)
+	}
+}
+
+func TestLogFollowerShowsTheProgressLineBeingDrawn(t *testing.T) {
+	forEachFollowMode(t, func(t *testing.T, polling bool) {
+		path := filepath.Join(t.TempDir(), "job.err")
+		appendToFile(t, path, "")
+		f := newLogFollower(path, 0, polling)
+		defer f.Close()
+
+		nextLive := func(want string) []string {
+			t.Helper()
+			deadline := time.After(5 * time.Second)
+			var lines []string
+			for {
+				batch := make(chan string, 1)
+				go func() {
+					got, live, _ := f.Next()
+					lines = append(lines, got...)
+					batch <- live
+				}()
+				select {
+				case live := <-batch:
+					if live == want {
+						return lines
+					}
+				case <-deadline:
+					t.Fatalf("timed out waiting for live line %q", want)
+				}
+			}
+		}
+
+		appendToFile(t, path, "start\n\r 10%|#  |\r 20%|## |")
+		if lines := nextLive(" 20%|## |"); strings.Join(lines, ",") != "start" {
+			t.Fatalf("unexpected lines %q", lines)
+		}
+		appendToFile(t, path, "\r100%|###|\n")
+		if lines := nextLive(""); len(lines) != 1 || cleanLogLine(lines[0]) != "100%|###|" {
+			t.Fatalf("expected the finished bar as a line, got %q", lines)
+		}
+	})
+}
+
+func TestTailLiveLineIsReplacedByTheFinishedLine(t *testing.T) {
+	m := NewTailModel("1", "/logs/job.out", "/logs/job.err", 100, 20, TailModeStderr)
+	update := func(msg tea.Msg) {
+		model, _ := m.Update(msg)
+		m = model.(TailModel)
+	}
+	update(tailStartMsg{pane: "stderr", initialLines: []string{"loading"}})
+	update(logLineMsg{pane: "stderr", live: " 30%|###       |"})
+	if view := m.stderrView.View(); !strings.Contains(view, "loading") || !strings.Contains(view, " 30%|") {
+		t.Fatalf("expected the live line below the log, got %q", view)
+	}
+	if len(m.stderrLines) != 1 {
+		t.Fatalf("the live line must not be a log line: %q", m.stderrLines)
+	}
+
+	update(logLineMsg{pane: "stderr", lines: []string{"\r 30%|###       |\r100%|##########|"}})
+	view := m.stderrView.View()
+	if strings.Contains(view, "30%") || !strings.Contains(view, "100%|##########|") {
+		t.Fatalf("expected only the finished bar, got %q", view)
+	}
+}
+
+func TestLogPathCacheRetriesFailedLookups(t *testing.T) {
+	now := time.Now()
+	calls := 0
+	c := newLogPathCache()
+	c.now = func() time.Time { return now }
+	c.resolve = func(string) (string, string, error) {
+		calls++
+		if calls < 3 {
+			return "", "", errors.New("scontrol timed out")
+		}
+		return "/logs/7.out", "/logs/7.err", nil
+	}
+
+	if out, _ := c.lookup("7", nil); out != "" || calls != 1 {
+		t.Fatalf("expected the first lookup to fail")
+	}
+	c.lookup("7", nil)
+	if calls != 1 {
+		t.Fatalf("expected no retry before the backoff")
+	}
+	now = now.Add(logPathRetryMin)
+	c.lookup("7", nil)
+	now = now.Add(logPathRetryMin)
+	if c.lookup("7", nil); calls != 2 {
+		t.Fatalf("expected the backoff to double, %d lookups", calls)
+	}
+	now = now.Add(2 * logPathRetryMin)
+	if out, _ := c.lookup("7", nil); out != "/logs/7.out" || calls != 3 {
+		t.Fatalf("expected the retry to succeed, got %q after %d lookups", out, calls)
+	}
+	if c.lookup("7", nil); calls != 3 {
+		t.Fatalf("expected found paths to be kept")
+	}
+}
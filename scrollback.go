@@ -0,0 +1,511 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Scrollback beyond the in-memory buffer: a pane only ever holds a window of
+// at most MaxLogLines lines. Scrolling past either edge of the window loads
+// the next chunk from disk and drops as many lines from the other edge, so
+// the whole log (including rotated generations) can be browsed with bounded
+// memory.
+
+// logChunkLines is how many lines one scroll past the window edge loads.
+const logChunkLines = 1000
+
+// paneScrollback tracks where a pane's lines live in its log. While attached,
+// the window ends at the live end of the log and the follower appends to it;
+// only the position of the first line loaded is known, plus how many lines
+// were dropped from the front since. Once the user scrolls back the pane is
+// detached: following stops and the window is read from disk, so the
+// position of every line is known.
+type paneScrollback struct {
+	source logSource
+	path   string
+	static bool // compressed or rotated log: never followed
+
+	start   logPos // position of the first line loaded
+	trimmed int    // lines dropped from the front since (negative: notices before the log)
+	atStart bool   // start is the beginning of the log
+
+	// firstLine is the line number (from 0) of the pane's first line in the
+	// log, known when the window was loaded from the start of the log,
+	// reached from such a window by scrolling, or counted (numberLines).
+	firstLine int
+	numbered  bool
+
+	detached  bool
+	positions []logPos // per line, while detached
+	end       logPos   // after the last line, while detached
+	atEnd     bool     // the detached window reaches the end of the log
+
+	loading bool
+}
+
+// reachesStart reports whether the pane shows the log from its beginning.
+func (sb *paneScrollback) reachesStart() bool {
+	return sb.atStart && sb.trimmed <= 0
+}
+
+// cleared records that the pane's lines were discarded.
+func (sb *paneScrollback) cleared(n int) {
+	if sb.detached {
+		sb.start, sb.positions = sb.end, nil
+		sb.atStart = false
+	} else {
+		sb.trimmed += n
+	}
+	sb.firstLine += n
+}
+
+type scrollbackKind int
+
+const (
+	scrollEarlier  scrollbackKind = iota // prepend a chunk before the window
+	scrollLater                          // append a chunk after the window
+	scrollJump                           // show the window around a position
+	scrollReattach                       // show the end of the log and follow it again
+)
+
+// scrollbackMsg delivers a window read from disk. It replaces the pane's
+// lines.
+type scrollbackMsg struct {
+	pane  string
+	sb    *paneScrollback
+	kind  scrollbackKind
+	lines []logLine
+	end   logPos
+
+	atStart bool
+	atEnd   bool
+	focus   int // line to show at the top, -1 for none
+
+	// firstLine is the line number (from 0) of the first line, when known
+	// (numbered) for a window away from the start of the log.
+	firstLine int
+	numbered  bool
+
+	// dropped is how many lines of the old window were dropped from the front
+	// (scrollLater); the view keeps its place by scrolling back as many.
+	dropped int
+
+	follower *logFollower
+	notFound bool
+	err      error
+}
+
+// scrollbackSnapshot is what a load needs to know about the window, copied so
+// the command never touches model state.
+type scrollbackSnapshot struct {
+	source    logSource
+	path      string
+	static    bool
+	start     logPos
+	trimmed   int
+	detached  bool
+	positions []logPos
+	end       logPos
+	count     int
+}
+
+func (sb *paneScrollback) snapshot(count int) scrollbackSnapshot {
+	return scrollbackSnapshot{
+		source:    sb.source,
+		path:      sb.path,
+		static:    sb.static,
+		start:     sb.start,
+		trimmed:   sb.trimmed,
+		detached:  sb.detached,
+		positions: sb.positions,
+		end:       sb.end,
+		count:     count,
+	}
+}
+
+// follow starts following the log again when a window reaches its end.
+func (s scrollbackSnapshot) follow(msg *scrollbackMsg) {
+	if msg.atEnd && !s.static {
+		msg.follower = startLogFollower(s.path, msg.end.offset)
+	}
+}
+
+// windowStart returns the position of the pane's first line.
+func (s scrollbackSnapshot) windowStart() (logPos, error) {
+	if s.detached {
+		if len(s.positions) > 0 {
+			return s.positions[0], nil
+		}
+		return s.end, nil
+	}
+	if s.trimmed <= 0 {
+		return s.start, nil
+	}
+	return s.source.advance(s.start, s.trimmed)
+}
+
+// paneRefs groups the per-pane fields of the tail view.
+type paneRefs struct {
+	lines      *[]string
+	wrapped    *[]string
+	levels     *[]lineLevel
+	matches    *[]int
+	builder    *strings.Builder
+	view       *viewport.Model
+	follower   **logFollower
+	scrollback *paneScrollback
+	filter     *paneFilter
+}
+
+func (m *TailModel) paneRefs(pane string) paneRefs {
+	if pane == "merged" {
+		// The merged pane reads no log of its own: no follower, no scrollback.
+		return paneRefs{&m.mergedLines, &m.wrappedMerged, &m.mergedLevels, &m.mergedMatches, m.mergedBuilder, &m.mergedView, nil, nil, m.mergedFilter}
+	}
+	if pane == "stderr" {
+		return paneRefs{&m.stderrLines, &m.wrappedStderr, &m.stderrLevels, &m.stderrMatches, m.stderrBuilder, &m.stderrView, &m.stderrFollower, m.stderrScrollback, m.stderrFilter}
+	}
+	return paneRefs{&m.stdoutLines, &m.wrappedStdout, &m.stdoutLevels, &m.stdoutMatches, m.stdoutBuilder, &m.stdoutView, &m.stdoutFollower, m.stdoutScrollback, m.stdoutFilter}
+}
+
+// focusedPane is the pane keys apply to.
+func (m TailModel) focusedPane() string {
+	switch m.mode {
+	case TailModeStdout:
+		return "stdout"
+	case TailModeStderr:
+		return "stderr"
+	case TailModeMerged:
+		return "merged"
+	}
+	if m.activePane == 1 {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// beginLoad marks a pane as loading. It reports false when the pane has no
+// log on disk or a load is already running.
+func (m *TailModel) beginLoad(pane string) (scrollbackSnapshot, bool) {
+	refs := m.paneRefs(pane)
+	sb := refs.scrollback
+	if sb == nil || sb.loading {
+		return scrollbackSnapshot{}, false
+	}
+	sb.loading = true
+	return sb.snapshot(len(*refs.lines)), true
+}
+
+// wholeLogLoaded reports whether a pane holds the entire log, so searching
+// it never needs the disk.
+func (sb *paneScrollback) wholeLogLoaded() bool {
+	return sb.reachesStart() && (!sb.detached || sb.atEnd)
+}
+
+// loadEarlierCmd loads the chunk before the window, keeping at most
+// MaxLogLines lines.
+func (m *TailModel) loadEarlierCmd(pane string) tea.Cmd {
+	sb := m.paneRefs(pane).scrollback
+	if sb == nil || sb.reachesStart() {
+		return nil
+	}
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		msg := scrollbackMsg{pane: pane, sb: sb, kind: scrollEarlier, focus: -1}
+		start, err := snap.windowStart()
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		earlier, atStart := snap.source.linesBefore(start, logChunkLines)
+		keep := snap.count
+		if MaxLogLines > 0 && keep > MaxLogLines-len(earlier) {
+			keep = MaxLogLines - len(earlier)
+		}
+		rest, end, atEnd, err := snap.source.linesAfter(start, keep)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.lines = append(earlier, rest...)
+		msg.end, msg.atStart, msg.atEnd = end, atStart, atEnd
+		msg.focus = len(earlier)
+		snap.follow(&msg)
+		return msg
+	}
+}
+
+// loadLaterCmd loads the chunk after a detached window. Reaching the end of
+// the log reattaches the pane.
+func (m *TailModel) loadLaterCmd(pane string) tea.Cmd {
+	sb := m.paneRefs(pane).scrollback
+	if sb == nil || !sb.detached || sb.atEnd {
+		return nil
+	}
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		msg := scrollbackMsg{pane: pane, sb: sb, kind: scrollLater, focus: -1}
+		later, end, atEnd, err := snap.source.linesAfter(snap.end, logChunkLines)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		dropped := 0
+		if MaxLogLines > 0 && snap.count+len(later) > MaxLogLines {
+			dropped = snap.count + len(later) - MaxLogLines
+		}
+		if dropped > len(snap.positions) {
+			dropped = len(snap.positions)
+		}
+		start := snap.end
+		if dropped < len(snap.positions) {
+			start = snap.positions[dropped]
+		}
+		kept, _, _, err := snap.source.linesAfter(start, len(snap.positions)-dropped)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.lines = append(kept, later...)
+		msg.end, msg.atEnd, msg.dropped = end, atEnd, dropped
+		msg.atStart = start == (logPos{})
+		snap.follow(&msg)
+		return msg
+	}
+}
+
+// jumpCmd shows the window around pos, with the line at pos at the top.
+func (m *TailModel) jumpCmd(pane string, pos logPos) tea.Cmd {
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	sb := m.paneRefs(pane).scrollback
+	return func() tea.Msg {
+		return snap.window(scrollbackMsg{pane: pane, sb: sb, kind: scrollJump}, pos)
+	}
+}
+
+// window fills msg with the lines around pos.
+func (s scrollbackSnapshot) window(msg scrollbackMsg, pos logPos) scrollbackMsg {
+	half := MaxLogLines / 2
+	if MaxLogLines <= 0 {
+		half = logChunkLines
+	}
+	before, atStart := s.source.linesBefore(pos, half)
+	after, end, atEnd, err := s.source.linesAfter(pos, half)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	msg.lines = append(before, after...)
+	msg.end, msg.atStart, msg.atEnd = end, atStart, atEnd
+	msg.focus = len(before)
+	s.follow(&msg)
+	return msg
+}
+
+// reattachCmd shows the end of the log again and resumes following it.
+func (m *TailModel) reattachCmd(pane string) tea.Cmd {
+	sb := m.paneRefs(pane).scrollback
+	if sb == nil || !sb.detached {
+		return nil
+	}
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		msg := scrollbackMsg{pane: pane, sb: sb, kind: scrollReattach, focus: -1}
+		lines, atStart, end, err := snap.source.tail(MaxLogLines)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.lines, msg.end, msg.atStart, msg.atEnd = lines, end, atStart, true
+		snap.follow(&msg)
+		return msg
+	}
+}
+
+// searchLogCmd searches the log on disk beyond the window, wrapping around
+// its ends, and shows the window around the match.
+func (m *TailModel) searchLogCmd(pane string, match func(string) bool, forward bool) tea.Cmd {
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	sb := m.paneRefs(pane).scrollback
+	return func() tea.Msg {
+		msg := scrollbackMsg{pane: pane, sb: sb, kind: scrollJump, focus: -1}
+		var from, wrap logPos
+		if forward {
+			from = snap.end
+			if !snap.detached {
+				// The window already ends at the end of the log.
+				from = logPos{file: len(snap.source.files)}
+			}
+		} else {
+			start, err := snap.windowStart()
+			if err != nil {
+				msg.err = err
+				return msg
+			}
+			from = start
+			end, err := snap.source.end()
+			if err != nil {
+				msg.err = err
+				return msg
+			}
+			wrap = end
+		}
+
+		pos, found, err := snap.source.search(from, forward, match)
+		if err == nil && !found {
+			pos, found, err = snap.source.search(wrap, forward, match)
+		}
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		if !found {
+			msg.notFound = true
+			return msg
+		}
+		return snap.window(msg, pos)
+	}
+}
+
+// lineCmd shows the window around a line of the log (numbered from 1).
+func (m *TailModel) lineCmd(pane string, line int) tea.Cmd {
+	snap, ok := m.beginLoad(pane)
+	if !ok {
+		return nil
+	}
+	sb := m.paneRefs(pane).scrollback
+	return func() tea.Msg {
+		msg := scrollbackMsg{pane: pane, sb: sb, kind: scrollJump, focus: -1}
+		pos, err := snap.source.advance(logPos{}, line-1)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg = snap.window(msg, pos)
+		msg.firstLine, msg.numbered = line-1-msg.focus, true
+		return msg
+	}
+}
+
+// numberLines makes the line numbers of a pane's window known, counting the
+// lines of the log before it. It reports false when they cannot be known.
+func (m *TailModel) numberLines(pane string) bool {
+	sb := m.paneRefs(pane).scrollback
+	if sb == nil {
+		return false
+	}
+	if sb.numbered {
+		return true
+	}
+	start, err := sb.snapshot(0).windowStart()
+	if err != nil {
+		return false
+	}
+	n, err := sb.source.countLines(start)
+	if err != nil {
+		return false
+	}
+	// Notices shown before the log's lines have negative numbers.
+	sb.firstLine, sb.numbered = n+min(sb.trimmed, 0), true
+	return true
+}
+
+// applyScrollback replaces a pane's window with the lines of msg. Unless the
+// window reaches the end of the log, the pane is detached: its follower is
+// stopped, and lines appended meanwhile are read from disk when scrolling
+// down to them.
+func (m *TailModel) applyScrollback(msg scrollbackMsg) tea.Cmd {
+	refs := m.paneRefs(msg.pane)
+	sb := refs.scrollback
+	if sb == nil || sb != msg.sb {
+		// The pane was restarted meanwhile.
+		return closeFollowerCmd(msg.follower)
+	}
+	sb.loading = false
+	if msg.err != nil || msg.notFound {
+		return nil
+	}
+	stop := closeFollowerCmd(*refs.follower)
+	*refs.follower = nil
+
+	oldOffset := refs.view.YOffset
+	droppedVisual := lineOffset(*refs.wrapped, m.displayIndex(msg.pane, msg.dropped))
+
+	*refs.lines = (*refs.lines)[:0]
+	positions := make([]logPos, 0, len(msg.lines))
+	for _, line := range msg.lines {
+		*refs.lines = append(*refs.lines, cleanLogLine(line.text))
+		positions = append(positions, line.pos)
+	}
+	if len(positions) > 0 {
+		sb.start = positions[0]
+	} else {
+		sb.start = msg.end
+	}
+	sb.trimmed = 0
+	sb.atStart = msg.atStart
+	switch {
+	case msg.atStart:
+		sb.firstLine, sb.numbered = 0, true
+	case msg.numbered:
+		sb.firstLine, sb.numbered = msg.firstLine, true
+	case msg.kind == scrollEarlier:
+		sb.firstLine -= msg.focus
+	case msg.kind == scrollLater:
+		sb.firstLine += msg.dropped
+	default:
+		sb.numbered = false
+	}
+	sb.end, sb.atEnd = msg.end, msg.atEnd
+	// Static logs are never followed, so they stay detached.
+	sb.detached = msg.follower == nil
+	if sb.detached {
+		sb.positions = positions
+	} else {
+		sb.positions = nil
+	}
+
+	if m.selectionPane == msg.pane {
+		m.clearSelection()
+	}
+	m.numberBookmarkedLines(msg.pane)
+	m.refreshPaneContent(msg.pane)
+
+	switch {
+	case msg.kind == scrollReattach:
+		refs.view.GotoBottom()
+	case msg.kind == scrollLater:
+		refs.view.SetYOffset(oldOffset - droppedVisual)
+	case msg.focus >= 0:
+		offset := lineOffset(*refs.wrapped, m.displayIndex(msg.pane, msg.focus))
+		if msg.kind == scrollEarlier {
+			// Show the last loaded line above the old first one.
+			offset--
+		}
+		refs.view.SetYOffset(offset)
+	}
+
+	m.following = msg.kind == scrollReattach
+	if msg.follower == nil {
+		return stop
+	}
+	*refs.follower = msg.follower
+	return tea.Batch(stop, m.waitForLine(msg.pane, msg.follower))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// searchOptions are the log view search toggles.
+type searchOptions struct {
+	regex         bool
+	caseSensitive bool
+	wholeWord     bool
+}
+
+// compileSearch turns a query into the regexp used for matching and
+// highlighting. Without regex mode the query is matched literally.
+func compileSearch(query string, opts searchOptions) (*regexp.Regexp, error) {
+	if query == "" {
+		return nil, nil
+	}
+	expr := query
+	if !opts.regex {
+		expr = regexp.QuoteMeta(query)
+	}
+	if opts.wholeWord {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if !opts.caseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// String describes the active toggles, e.g. "regex, case".
+func (o searchOptions) String() string {
+	var on []string
+	if o.regex {
+		on = append(on, "regex")
+	}
+	if o.caseSensitive {
+		on = append(on, "case")
+	}
+	if o.wholeWord {
+		on = append(on, "word")
+	}
+	return strings.Join(on, ", ")
+}
+
+const maxSearchHistory = 50
+
+// searchHistory holds the queries of a session, newest last, shared by every
+// log view so earlier searches can be recalled with up/down.
+type searchHistory struct {
+	entries []string
+	pos     int    // index being shown while browsing; len(entries) when not
+	draft   string // what was typed before browsing started
+}
+
+func (h *searchHistory) add(query string) {
+	if h == nil || strings.TrimSpace(query) == "" {
+		return
+	}
+	for i, e := range h.entries {
+		if e == query {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, query)
+	if len(h.entries) > maxSearchHistory {
+		h.entries = h.entries[len(h.entries)-maxSearchHistory:]
+	}
+	h.reset()
+}
+
+// reset ends browsing, e.g. when a new search starts.
+func (h *searchHistory) reset() {
+	if h != nil {
+		h.pos = len(h.entries)
+	}
+}
+
+// prev returns the query before the one shown; current is the input's value.
+func (h *searchHistory) prev(current string) (string, bool) {
+	if h == nil || h.pos == 0 || len(h.entries) == 0 {
+		return "", false
+	}
+	if h.pos >= len(h.entries) {
+		h.pos = len(h.entries)
+		h.draft = current
+	}
+	h.pos--
+	return h.entries[h.pos], true
+}
+
+// next returns the query after the one shown, and finally the draft.
+func (h *searchHistory) next() (string, bool) {
+	if h == nil || h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.entries) {
+		return h.draft, true
+	}
+	return h.entries[h.pos], true
+}
+
+// activeMatcher is the regexp of the search being typed or, failing that, the
+// last search. It is nil without a (valid) query.
+func (m *TailModel) activeMatcher() *regexp.Regexp {
+	re, _ := compileSearch(m.activeSearchTerm(), m.searchOpts)
+	return re
+}
+
+// findMatches returns the indexes of the displayed lines of a pane, from
+// line from on, that re matches. Filter separators never match.
+func (m *TailModel) findMatches(pane string, from int, re *regexp.Regexp) []int {
+	if re == nil {
+		return nil
+	}
+	var idx []int
+	lines := m.displayLines(pane)
+	for i := from; i < len(lines); i++ {
+		if re.MatchString(stripANSI(lines[i])) && m.rawIndex(pane, i) >= 0 {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// lineAtOffset returns the line shown at a visual offset of wrapped lines,
+// and lineOffset the visual offset of a line.
+func lineAtOffset(wrapped []string, offset int) int {
+	visual := 0
+	for i, block := range wrapped {
+		visual += visualLineCount(block)
+		if visual > offset {
+			return i
+		}
+	}
+	if len(wrapped) == 0 {
+		return 0
+	}
+	return len(wrapped) - 1
+}
+
+func lineOffset(wrapped []string, line int) int {
+	visual := 0
+	for i := 0; i < line && i < len(wrapped); i++ {
+		visual += visualLineCount(wrapped[i])
+	}
+	return visual
+}
+
+// matchCounter returns "current/total" for a pane's matches; current is the
+// first match at or below the top of the view. A "+" marks counts of a
+// window that holds only part of the log.
+func (m *TailModel) matchCounter(pane string) string {
+	if strings.TrimSpace(m.lastSearch) == "" || m.searchErr != nil {
+		return ""
+	}
+	refs := m.paneRefs(pane)
+	matches := *refs.matches
+	more := ""
+	if sb := refs.scrollback; sb != nil && !sb.wholeLogLoaded() {
+		more = "+"
+	}
+	if len(matches) == 0 {
+		return "0/0" + more
+	}
+	top := lineAtOffset(*refs.wrapped, refs.view.YOffset)
+	for i, line := range matches {
+		if line >= top {
+			return fmt.Sprintf("%d/%d%s", i+1, len(matches), more)
+		}
+	}
+	return fmt.Sprintf("-/%d%s", len(matches), more)
+}
+
+// lineLabel numbers a line of a pane for the match list: its line number in
+// the log when known, otherwise its offset in the loaded window.
+func (m *TailModel) lineLabel(pane string, i int) string {
+	i = m.rawIndex(pane, i)
+	if sb := m.paneRefs(pane).scrollback; sb != nil && sb.numbered {
+		if n := sb.firstLine + i + 1; n > 0 {
+			return fmt.Sprint(n)
+		}
+		return "-"
+	}
+	return fmt.Sprintf("+%d", i+1)
+}
+
+// openMatchList shows every match of the focused pane, starting at the
+// current one.
+func (m *TailModel) openMatchList() {
+	pane := m.focusedPane()
+	refs := m.paneRefs(pane)
+	if len(*refs.matches) == 0 {
+		return
+	}
+	m.matchListPane = pane
+	m.matchListCursor = 0
+	top := lineAtOffset(*refs.wrapped, refs.view.YOffset)
+	for i, line := range *refs.matches {
+		if line >= top {
+			m.matchListCursor = i
+			break
+		}
+	}
+	m.inMatchList = true
+}
+
+// jumpToMatch shows the line of the selected match at the top of its pane.
+func (m *TailModel) jumpToMatch() {
+	refs := m.paneRefs(m.matchListPane)
+	matches := *refs.matches
+	if m.matchListCursor < 0 || m.matchListCursor >= len(matches) {
+		return
+	}
+	m.following = false
+	refs.view.SetYOffset(lineOffset(*refs.wrapped, matches[m.matchListCursor]))
+}
+
+// renderMatchList draws the match list over the whole view.
+func (m TailModel) renderMatchList() string {
+	refs := m.paneRefs(m.matchListPane)
+	matches := *refs.matches
+	re := m.activeMatcher()
+
+	height := m.height - 4
+	if height < 3 {
+		height = 3
+	}
+	first := m.matchListCursor - height/2
+	if first > len(matches)-height {
+		first = len(matches) - height
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	width := m.width - 2
+	if width < 20 {
+		width = 20
+	}
+	var b strings.Builder
+	title := fmt.Sprintf("%s matches for %q: %d", strings.ToUpper(m.matchListPane), m.lastSearch, len(matches))
+	if opts := m.searchOpts.String(); opts != "" {
+		title += " (" + opts + ")"
+	}
+	b.WriteString(m.styles.Title.Render(title))
+	b.WriteString("\n\n")
+	for i := first; i < len(matches) && i < first+height; i++ {
+		line := stripANSI(m.displayLines(m.matchListPane)[matches[i]])
+		label := fmt.Sprintf("%7s  ", m.lineLabel(m.matchListPane, matches[i]))
+		if avail := width - len(label); runeLen(line) > avail {
+			line = runeSlice(line, 0, avail-1) + "…"
+		}
+		if i == m.matchListCursor {
+			b.WriteString(tailSelectionStyle.Render(label + line))
+		} else {
+			b.WriteString(label + renderLineForSearch(line, re))
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("\n" + hints("  ",
+		hint("select", scrollKeys.Up, scrollKeys.Down),
+		hint("jump", dialogKeys.Confirm),
+		hint("close", dialogKeys.Back)))
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCompileSearchOptions(t *testing.T) {
+	cases := []struct {
+		query string
+		opts  searchOptions
+		line  string
+		want  bool
+	}{
+		{"loss=", searchOptions{}, "step 10 LOSS=0.3", true},
+		{"loss=", searchOptions{caseSensitive: true}, "step 10 LOSS=0.3", false},
+		{"a.c", searchOptions{}, "abc", false},
+		{"a.c", searchOptions{regex: true}, "abc", true},
+		{`loss=\d+\.\d+`, searchOptions{regex: true}, "loss=0.25", true},
+		{"err", searchOptions{wholeWord: true}, "stderr: ok", false},
+		{"err", searchOptions{wholeWord: true}, "err: disk full", true},
+		{"nan|inf", searchOptions{regex: true, wholeWord: true}, "grad is inf", true},
+	}
+	for _, c := range cases {
+		re, err := compileSearch(c.query, c.opts)
+		if err != nil {
+			t.Fatalf("%q %+v: %v", c.query, c.opts, err)
+		}
+		if got := re.MatchString(c.line); got != c.want {
+			t.Errorf("%q %+v on %q = %v, want %v", c.query, c.opts, c.line, got, c.want)
+		}
+	}
+	if _, err := compileSearch("(unclosed", searchOptions{regex: true}); err == nil {
+		t.Fatalf("expected invalid regex to be rejected")
+	}
+}
+
+func TestSearchHistoryRecallsQueriesAndDraft(t *testing.T) {
+	h := &searchHistory{}
+	h.add("loss")
+	h.add("error")
+	h.add("loss") // moves to the end instead of duplicating
+	h.reset()
+
+	if q, _ := h.prev("typed"); q != "loss" {
+		t.Fatalf("prev = %q", q)
+	}
+	if q, _ := h.prev(""); q != "error" {
+		t.Fatalf("prev = %q", q)
+	}
+	if _, ok := h.prev(""); ok {
+		t.Fatalf("expected no entry before the oldest")
+	}
+	h.next()
+	if q, _ := h.next(); q != "typed" {
+		t.Fatalf("expected the draft after the newest entry, got %q", q)
+	}
+}
+
+func TestTailMatchCounterAndListJump(t *testing.T) {
+	m := NewTailModel("1", "", "", 80, 14, TailModeStdout)
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("step %d", i)
+		if i%10 == 0 {
+			line += fmt.Sprintf(" loss=%d", i)
+		}
+		m.stdoutLines = append(m.stdoutLines, line)
+	}
+	m.refreshStdoutContent()
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	m = model.(TailModel)
+	m.searchInput.SetValue(`loss=\d+`)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}, Alt: true})
+	m = model.(TailModel)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(TailModel)
+
+	if !m.searchOpts.regex || len(m.stdoutMatches) != 10 {
+		t.Fatalf("expected 10 regex matches, got %d (opts %+v)", len(m.stdoutMatches), m.searchOpts)
+	}
+	if got := m.matchCounter("stdout"); got != "2/10" {
+		t.Fatalf("counter after the first jump = %q", got)
+	}
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'L'}})
+	m = model.(TailModel)
+	if !m.inMatchList || !strings.Contains(m.View(), "loss=50") {
+		t.Fatalf("expected the match list to be shown")
+	}
+	for _, k := range []tea.KeyType{tea.KeyDown, tea.KeyDown, tea.KeyEnter} {
+		model, _ = m.Update(tea.KeyMsg{Type: k})
+		m = model.(TailModel)
+	}
+	if m.inMatchList || m.stdoutLines[lineAtOffset(m.wrappedStdout, m.stdoutView.YOffset)] != "step 30 loss=30" {
+		t.Fatalf("expected to jump to the selected match, top offset %d", m.stdoutView.YOffset)
+	}
+}
+
+func TestTailInvalidRegexKeepsSearchOpen(t *testing.T) {
+	m := NewTailModel("1", "", "", 80, 14, TailModeStdout)
+	m.searchOpts.regex = true
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	m = model.(TailModel)
+	m.searchInput.SetValue("(oops")
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(TailModel)
+	if !m.inSearchMode || m.searchErr == nil || m.lastSearch != "" {
+		t.Fatalf("expected the invalid pattern to be reported, not searched")
+	}
+}
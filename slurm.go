@@ -23,6 +23,8 @@ type Job struct {
 	Time      string
 	Nodes     string
 	NodeList  string
+	ExitCode  string // Only known from sacct, e.g. "1:0"
+	End       string // Only known from sacct; "Unknown" while running
 }
 
 // State returns the short state code (R, PD, etc.)
@@ -174,14 +176,28 @@ func parseSqueue(output string) []Job {
 
 // FetchJobsHistory fetches jobs using sacct (N day history)
 func FetchJobsHistory(days int) ([]Job, error) {
+	return FetchJobsSince(historyWindowStart(days))
+}
+
+// historyWindowStart returns local midnight N days ago, the start of the
+// history window.
+func historyWindowStart(days int) time.Time {
+	y, m, d := time.Now().AddDate(0, 0, -days).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// sacctTimeLayout is the format sacct uses for Start/End and --starttime.
+const sacctTimeLayout = "2006-01-02T15:04:05"
+
+// FetchJobsSince fetches the jobs that were in any state after start.
+func FetchJobsSince(start time.Time) ([]Job, error) {
 	user := CurrentUser()
-	startTime := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
 
 	args := []string{
 		"sacct", "-u", user,
-		"--format", "JobID,JobName,User,State,Partition,Elapsed,AllocNodes,NodeList",
+		"--format", "JobID,JobName,User,State,Partition,Elapsed,AllocNodes,NodeList,ExitCode,End",
 		"-X", "-P", "-n",
-		"--starttime", startTime,
+		"--starttime", start.Format(sacctTimeLayout),
 	}
 
 	out, err := RunCommand(args, 30*time.Second)
@@ -218,6 +234,12 @@ func parseSacct(output string) []Job {
 			Nodes:     strings.TrimSpace(parts[6]),
 			NodeList:  strings.TrimSpace(parts[7]),
 		}
+		if len(parts) > 8 {
+			job.ExitCode = strings.TrimSpace(parts[8])
+		}
+		if len(parts) > 9 {
+			job.End = strings.TrimSpace(parts[9])
+		}
 		jobs = append(jobs, job)
 	}
 	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
@@ -226,6 +248,26 @@ func parseSacct(output string) []Job {
 	return jobs
 }
 
+// FetchJobsByID fetches the current sacct record of specific jobs. Unlike
+// squeue it also knows jobs that already finished, so it is used to learn the
+// final state (and exit code) of jobs that disappeared from the live queue.
+func FetchJobsByID(ids []string) ([]Job, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := []string{
+		"sacct", "-j", strings.Join(ids, ","),
+		"--format", "JobID,JobName,User,State,Partition,Elapsed,AllocNodes,NodeList,ExitCode",
+		"-X", "-P", "-n",
+	}
+
+	out, err := RunCommand(args, 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return parseSacct(out), nil
+}
+
 // CancelJob cancels a job
 func CancelJob(jobID string) error {
 	_, err := RunCommand([]string{"scancel", jobID}, 5*time.Second)
@@ -359,6 +401,26 @@ func ResolveLogPaths(jobID string) (string, string, error) {
 	return "", "", fmt.Errorf("could not resolve logs (job may be purged from sacct or WorkDir unavailable); also checked archive convention in %s", logArchiveDir())
 }
 
+// ResolveWorkDir finds the working directory of a job: from scontrol for
+// jobs still in slurmctld memory, otherwise from sacct.
+func ResolveWorkDir(jobID string) (string, error) {
+	if out, err := RunCommand([]string{"scontrol", "show", "job", jobID}, 10*time.Second); err == nil {
+		if matches := regexp.MustCompile(`WorkDir=(\S+)`).FindStringSubmatch(out); len(matches) > 1 {
+			return matches[1], nil
+		}
+	}
+	out, err := RunCommand([]string{"sacct", "-j", jobID, "-o", "WorkDir", "-X", "-n", "-P"}, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if wd := strings.TrimSpace(line); wd != "" {
+			return wd, nil
+		}
+	}
+	return "", fmt.Errorf("no working directory known for job %s", jobID)
+}
+
 var (
 	outputFlagRe = regexp.MustCompile(`(?i)(?:^|\s)(-o|--output)\s*=?\s*(\S+)`)
 	errorFlagRe  = regexp.MustCompile(`(?i)(?:^|\s)(-e|--error)\s*=?\s*(\S+)`)
@@ -495,11 +557,11 @@ func logArchiveDir() string {
 		return expandHomePath(configured)
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil || home == "" {
+	dir := dashboardDir()
+	if dir == "" {
 		return ""
 	}
-	return filepath.Join(home, ".slurm-dashboard", "logs")
+	return filepath.Join(dir, "logs")
 }
 
 func expandHomePath(path string) string {
@@ -540,6 +602,12 @@ func resolveArchiveConventionPaths(jobID string) (string, string, bool) {
 		filepath.Join(root, jobID, "err.log"),
 	}
 
+	// Compressed copies, e.g. from automatic archiving or archive scripts.
+	for _, suffix := range compressedLogSuffixes {
+		stdoutCandidates = append(stdoutCandidates, filepath.Join(root, jobID+".out"+suffix))
+		stderrCandidates = append(stderrCandidates, filepath.Join(root, jobID+".err"+suffix))
+	}
+
 	stdoutPath := firstExistingFile(stdoutCandidates)
 	stderrPath := firstExistingFile(stderrCandidates)
 
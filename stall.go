@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A running job whose logs have not been written for a long time is often
+// hung (on NCCL, on I/O, ...) while Slurm still shows it running. Such jobs
+// are flagged in the job table and reported to hooks as STALLED.
+
+const (
+	defaultStallAfter = time.Hour
+	envStallAfter     = "SLURM_DASHBOARD_STALL_AFTER"
+	// stateStalled is the pseudo-state of the events of stalled jobs.
+	stateStalled = "STALLED"
+)
+
+// stallAfterFromEnv returns how long a running job may go without output
+// before it is flagged; 0 turns flagging off.
+func stallAfterFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv(envStallAfter))
+	if raw == "" {
+		return defaultStallAfter
+	}
+	if raw == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return defaultStallAfter
+	}
+	return d
+}
+
+// isStalled reports whether logs last written at last have been quiet for
+// longer than after.
+func isStalled(last time.Time, after time.Duration, now time.Time) bool {
+	return after > 0 && !last.IsZero() && now.Sub(last) >= after
+}
+
+// formatQuiet formats how long a job has written nothing.
+func formatQuiet(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1 min"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// stallTracker turns the log activity of running jobs into events: one when
+// a job stalls, and another only after it wrote output again and stalled
+// anew.
+type stallTracker struct {
+	stalled map[string]bool
+}
+
+func newStallTracker() *stallTracker {
+	return &stallTracker{stalled: map[string]bool{}}
+}
+
+// observe returns the events of the jobs that stalled since the previous
+// call. lastOutput holds when the logs of running jobs were last written.
+func (t *stallTracker) observe(jobs []Job, lastOutput map[string]time.Time, after time.Duration, now time.Time) []JobEvent {
+	if t == nil {
+		return nil
+	}
+	var events []JobEvent
+	seen := make(map[string]bool, len(lastOutput))
+	for _, job := range jobs {
+		last, ok := lastOutput[job.JobID]
+		if !ok || job.State() != "R" {
+			continue
+		}
+		seen[job.JobID] = true
+		if !isStalled(last, after, now) {
+			delete(t.stalled, job.JobID)
+			continue
+		}
+		if t.stalled[job.JobID] {
+			continue
+		}
+		t.stalled[job.JobID] = true
+		events = append(events, JobEvent{Job: job, PrevState: job.State(), State: stateStalled, Time: now, Quiet: now.Sub(last)})
+	}
+	for id := range t.stalled {
+		if !seen[id] {
+			delete(t.stalled, id)
+		}
+	}
+	return events
+}
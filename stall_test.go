@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStalledJobsAreFlaggedAndReportedOnce(t *testing.T) {
+	now := time.Now()
+	jobs := []Job{{JobID: "1", Name: "train", Status: "RUNNING"}, {JobID: "2", Name: "eval", Status: "RUNNING"}}
+	lastOutput := map[string]time.Time{"1": now.Add(-75 * time.Minute), "2": now.Add(-5 * time.Minute)}
+
+	stalls := newStallTracker()
+	events := stalls.observe(jobs, lastOutput, time.Hour, now)
+	if len(events) != 1 || events[0].Job.JobID != "1" || events[0].State != stateStalled {
+		t.Fatalf("expected job 1 to stall, got %+v", events)
+	}
+	if got := events[0].String(); got != "Job 1 (train) possibly stalled: no output for 1h15m" {
+		t.Fatalf("unexpected event text %q", got)
+	}
+	hook := HookConfig{URL: "http://x", States: []string{"STALLED"}}
+	if !hook.Matches(events[0]) || (HookConfig{URL: "http://x"}).Matches(events[0]) {
+		t.Fatalf("expected only hooks subscribed to STALLED to match")
+	}
+	if p := buildHookPayload("", events); p.Event != hookEventStalled || p.Jobs[0].Quiet != 75*60 {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+
+	if events := stalls.observe(jobs, lastOutput, time.Hour, now.Add(time.Minute)); len(events) != 0 {
+		t.Fatalf("expected a stalled job to be reported once, got %+v", events)
+	}
+	lastOutput["1"] = now
+	stalls.observe(jobs, lastOutput, time.Hour, now)
+	if events := stalls.observe(jobs, lastOutput, time.Hour, now.Add(2*time.Hour)); len(events) != 2 {
+		t.Fatalf("expected both jobs to stall anew, got %+v", events)
+	}
+
+	m := NewModel()
+	m.applyWindowSize(200, 40)
+	m.jobs, m.filtered = jobs, jobs
+	m.lastOutput = map[string]time.Time{"1": now.Add(-75 * time.Minute), "2": now.Add(-5 * time.Minute)}
+	m.stallAfter = time.Hour
+	m.updateTable()
+	rows := m.table.Rows()
+	if row := strings.Join(rows[0], "|"); !strings.Contains(row, "⚠ train") || !strings.Contains(row, "⚠ 1h15m ago") {
+		t.Fatalf("expected job 1 to be flagged, got %q", row)
+	}
+	if row := strings.Join(rows[1], "|"); strings.Contains(row, "⚠") || !strings.Contains(row, "5 min ago") {
+		t.Fatalf("expected job 2 to show its last output, got %q", row)
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ResolveLogPaths finds the job's own stdout and stderr, but job steps may
+// write elsewhere: `srun --output=%j.%t.out` writes a file per task. The log
+// view discovers those files and lets the user switch to them or follow
+// several at once.
+
+// maxJobLogFiles bounds how many files a pattern is expanded to.
+const maxJobLogFiles = 256
+
+// jobLogFile is an output file of a job: its own stdout or stderr, or the
+// output of a step or of one of the step's tasks or nodes.
+type jobLogFile struct {
+	label  string // "job", "step 0", "step 0 task 3", "step 1 node gpu01"
+	stream string // "stdout" or "stderr"
+	path   string
+	// Size and modification time when the file was found; modTime is zero
+	// for a file that did not exist.
+	size    int64
+	modTime time.Time
+}
+
+// logPatternVars are the values Slurm filename patterns expand to.
+type logPatternVars struct {
+	jobID       string
+	arrayJobID  string
+	arrayTaskID string
+	step        string // "" when the step is not known
+	user        string
+	name        string
+	workDir     string
+}
+
+// stepOutput is where a job step writes its output: a pattern as given to
+// srun, expanded per task or node.
+type stepOutput struct {
+	step   string // "" when not known
+	stdout string
+	stderr string
+}
+
+// scontrolFields parses the Key=Value fields of one-line scontrol output.
+// Values holding spaces keep only their first word.
+func scontrolFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// parseStepOutputs parses `scontrol -o show step` output, a step per line.
+func parseStepOutputs(out string) []stepOutput {
+	var steps []stepOutput
+	for _, line := range strings.Split(out, "\n") {
+		f := scontrolFields(line)
+		if f["StepId"] == "" || f["StdOut"] == "" && f["StdErr"] == "" {
+			continue
+		}
+		step := f["StepId"]
+		if i := strings.LastIndex(step, "."); i >= 0 {
+			step = step[i+1:]
+		}
+		steps = append(steps, stepOutput{step: step, stdout: f["StdOut"], stderr: f["StdErr"]})
+	}
+	return steps
+}
+
+// srunOutputPatterns returns the --output and --error patterns of the srun
+// commands of a batch script.
+func srunOutputPatterns(script string) []stepOutput {
+	var steps []stepOutput
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") || !runsCommand(trimmed, "srun") {
+			continue
+		}
+		out := parseFlagValue(trimmed, outputFlagRe)
+		errPath := parseFlagValue(trimmed, errorFlagRe)
+		if out != "" || errPath != "" {
+			steps = append(steps, stepOutput{stdout: out, stderr: errPath})
+		}
+	}
+	return steps
+}
+
+// runsCommand reports whether a command line runs a command, e.g.
+// "srun" in "OMP_NUM_THREADS=4 srun -n 8 ./app".
+func runsCommand(line, command string) bool {
+	for _, field := range strings.Fields(line) {
+		if field == command || strings.HasSuffix(field, "/"+command) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileLogPattern turns a Slurm filename pattern into a glob finding the
+// files it produced and a regexp capturing the fields it left open, named
+// after what they stand for ("" for fields not worth a label). Known fields
+// are filled in from vars; per-task and per-node ones (%t, %n, %N) and
+// unknown ones match any value.
+func compileLogPattern(pattern string, vars logPatternVars) (string, *regexp.Regexp, []string) {
+	var glob, re strings.Builder
+	var open []string
+	literal := func(s string) {
+		for _, r := range s {
+			if strings.ContainsRune(`*?[\`, r) {
+				glob.WriteByte('\\')
+			}
+			glob.WriteRune(r)
+		}
+		re.WriteString(regexp.QuoteMeta(s))
+	}
+	wildcard := func(name, class string) {
+		glob.WriteByte('*')
+		re.WriteString("(" + class + ")")
+		open = append(open, name)
+	}
+	pad := func(value string, width int) string {
+		if len(value) < width {
+			return strings.Repeat("0", width-len(value)) + value
+		}
+		return value
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			literal(pattern[i : i+1])
+			continue
+		}
+		i++
+		width := 0
+		for i < len(pattern)-1 && pattern[i] >= '0' && pattern[i] <= '9' {
+			width = width*10 + int(pattern[i]-'0')
+			i++
+		}
+		value := ""
+		switch pattern[i] {
+		case '%':
+			value = "%"
+		case 'j':
+			value = vars.jobID
+		case 'J':
+			value = vars.jobID
+			if vars.step != "" {
+				value += "." + vars.step
+			}
+		case 'A':
+			value = vars.arrayJobID
+		case 'a':
+			value = vars.arrayTaskID
+		case 's':
+			value = vars.step
+		case 'u':
+			value = vars.user
+		case 'x':
+			value = vars.name
+		}
+		switch {
+		case value != "":
+			literal(pad(value, width))
+		case pattern[i] == 't':
+			wildcard("task", `\d+`)
+		case pattern[i] == 'n':
+			wildcard("node", `\d+`)
+		case pattern[i] == 'N':
+			wildcard("node", `[^/]+`)
+		case pattern[i] == 's':
+			wildcard("step", `[^/.]+`)
+		default:
+			wildcard("", `[^/]*`)
+		}
+	}
+
+	path := glob.String()
+	expr := "^" + re.String() + "$"
+	if !filepath.IsAbs(pattern) && vars.workDir != "" {
+		dir := filepath.Clean(vars.workDir)
+		path = filepath.Join(strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(dir), path)
+		expr = "^" + regexp.QuoteMeta(dir+string(filepath.Separator)) + re.String() + "$"
+	}
+	return path, regexp.MustCompile(expr), open
+}
+
+// expandLogPattern finds the files a filename pattern produced, labelled
+// by the step, task or node each belongs to.
+func expandLogPattern(pattern, stream string, vars logPatternVars) []jobLogFile {
+	if pattern == "" {
+		return nil
+	}
+	glob, re, open := compileLogPattern(pattern, vars)
+	paths, err := filepath.Glob(glob)
+	if err != nil {
+		return nil
+	}
+	// Numbered files in numeric order: file.2 before file.10.
+	sort.SliceStable(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+
+	var files []jobLogFile
+	for _, path := range paths {
+		m := re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		var label []string
+		if vars.step != "" {
+			label = append(label, "step "+vars.step)
+		}
+		for k, name := range open {
+			if name != "" {
+				label = append(label, name+" "+m[k+1])
+			}
+		}
+		if len(label) == 0 {
+			label = append(label, "step")
+		}
+		files = append(files, jobLogFile{label: strings.Join(label, " "), stream: stream, path: path, size: info.Size(), modTime: info.ModTime()})
+		if len(files) == maxJobLogFiles {
+			break
+		}
+	}
+	return files
+}
+
+// jobPatternVars looks up what the filename patterns of a job expand to,
+// and the job's batch script when known.
+func jobPatternVars(jobID string) (logPatternVars, string) {
+	vars := logPatternVars{jobID: jobID, arrayJobID: jobID, user: CurrentUser()}
+	if base, task, ok := strings.Cut(jobID, "_"); ok {
+		vars.arrayJobID, vars.arrayTaskID = base, task
+	}
+
+	if out, err := RunCommand([]string{"scontrol", "-o", "show", "job", jobID}, 10*time.Second); err == nil {
+		f := scontrolFields(out)
+		vars.workDir = f["WorkDir"]
+		vars.name = f["JobName"]
+		if user, _, _ := strings.Cut(f["UserId"], "("); user != "" {
+			vars.user = user
+		}
+		if f["ArrayJobId"] != "" && f["ArrayTaskId"] != "" {
+			vars.arrayJobID, vars.arrayTaskID = f["ArrayJobId"], f["ArrayTaskId"]
+		}
+		if vars.workDir != "" {
+			return vars, f["Command"]
+		}
+	}
+
+	// Finished jobs: sacct knows the working directory and submit line.
+	out, err := RunCommand([]string{"sacct", "-j", jobID, "-o", "WorkDir,SubmitLine,JobName", "-X", "-n", "-P"}, 5*time.Second)
+	if err != nil {
+		return vars, ""
+	}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		if len(parts) < 3 || parts[0] == "" {
+			continue
+		}
+		vars.workDir, vars.name = parts[0], parts[2]
+		script := parseSubmitLineScriptPath(parts[1])
+		if script != "" && !filepath.IsAbs(script) {
+			script = filepath.Join(vars.workDir, script)
+		}
+		return vars, script
+	}
+	return vars, ""
+}
+
+// DiscoverJobLogs lists the output files of a job: its own stdout and
+// stderr, then the files of its steps, from the output of each step in
+// `scontrol show step` (while slurmctld knows the job) and the srun
+// commands of its batch script, with per-task and per-node patterns
+// expanded to the files they produced.
+func DiscoverJobLogs(jobID, stdout, stderr string) ([]jobLogFile, error) {
+	var files []jobLogFile
+	seen := make(map[string]bool)
+	add := func(f jobLogFile) {
+		if f.path != "" && !seen[f.path] {
+			seen[f.path] = true
+			if f.modTime.IsZero() {
+				if info, err := os.Stat(f.path); err == nil {
+					f.size, f.modTime = info.Size(), info.ModTime()
+				}
+			}
+			files = append(files, f)
+		}
+	}
+	add(jobLogFile{label: "job", stream: "stdout", path: stdout})
+	add(jobLogFile{label: "job", stream: "stderr", path: stderr})
+
+	vars, script := jobPatternVars(jobID)
+	var steps []stepOutput
+	out, stepErr := RunCommand([]string{"scontrol", "-o", "show", "step", jobID}, 10*time.Second)
+	if stepErr == nil {
+		steps = parseStepOutputs(out)
+	}
+	if script != "" {
+		if data, err := os.ReadFile(script); err == nil {
+			steps = append(steps, srunOutputPatterns(string(data))...)
+		}
+	}
+	for _, s := range steps {
+		v := vars
+		v.step = s.step
+		for _, f := range expandLogPattern(s.stdout, "stdout", v) {
+			add(f)
+		}
+		if s.stderr != s.stdout {
+			for _, f := range expandLogPattern(s.stderr, "stderr", v) {
+				add(f)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no output files found for job %s", jobID)
+	}
+	return files, nil
+}
+
+// jobLogSet is the output files of the job of a log view, discovered on
+// demand and kept across the views the picker switches between.
+type jobLogSet struct {
+	jobID          string
+	stdout, stderr string // the job's own logs
+	files          []jobLogFile
+	err            error
+	loading        bool
+}
+
+// jobLogsMsg delivers the discovered files of a job.
+type jobLogsMsg struct {
+	set   *jobLogSet
+	files []jobLogFile
+	err   error
+}
+
+func (s *jobLogSet) discoverCmd() tea.Cmd {
+	s.loading = true
+	jobID, stdout, stderr := s.jobID, s.stdout, s.stderr
+	return func() tea.Msg {
+		files, err := DiscoverJobLogs(jobID, stdout, stderr)
+		return jobLogsMsg{set: s, files: files, err: err}
+	}
+}
+
+// logPicker is the file picker of the log view.
+type logPicker struct {
+	cursor int
+	marked map[string]bool // paths to merge
+}
+
+// openLogPicker lists the output files of the job, discovering them the
+// first time.
+func (m *TailModel) openLogPicker() tea.Cmd {
+	if m.compare != nil {
+		m.notice = "the file picker is not available when comparing jobs"
+		return nil
+	}
+	m.logPicker = &logPicker{marked: make(map[string]bool)}
+	if m.jobLogs.files == nil && !m.jobLogs.loading {
+		return m.jobLogs.discoverCmd()
+	}
+	m.logPicker.cursor = m.currentLogFile()
+	return nil
+}
+
+// currentLogFile returns the index of the file the focused pane shows.
+func (m TailModel) currentLogFile() int {
+	path := m.panePath(m.focusedPane())
+	for i, f := range m.jobLogs.files {
+		if f.path == path {
+			return i
+		}
+	}
+	return 0
+}
+
+// openLogFile shows a file in the pane of its stream, keeping the view's
+// settings.
+func (m TailModel) openLogFile(f jobLogFile) (TailModel, tea.Cmd) {
+	stdout, stderr, mode := m.stdoutPath, m.stderrPath, m.mode
+	if f.stream == "stderr" {
+		stderr = f.path
+		if mode == TailModeStdout {
+			mode = TailModeStderr
+		}
+	} else {
+		stdout = f.path
+		if mode == TailModeStderr {
+			mode = TailModeStdout
+		}
+	}
+	next := NewTailModel(m.jobID, stdout, stderr, m.width, m.height, mode)
+	m.carrySettings(&next)
+	if mode == TailModeBoth {
+		next.activePane = 0
+		if f.stream == "stderr" {
+			next.activePane = 1
+		}
+	}
+	return next, tea.Batch(
+		closeFollowerCmd(m.stdoutFollower),
+		closeFollowerCmd(m.stderrFollower),
+		next.Init(),
+	)
+}
+
+// mergeLogFilesCmd opens the marked files, or all of them, in the multi-log
+// view.
+func (m TailModel) mergeLogFilesCmd() tea.Cmd {
+	var jobs []multiJob
+	for _, f := range m.jobLogs.files {
+		if len(m.logPicker.marked) > 0 && !m.logPicker.marked[f.path] {
+			continue
+		}
+		label := f.label
+		if f.stream == "stderr" {
+			label += " err"
+		}
+		jobs = append(jobs, multiJob{id: label, stdout: f.path, stderr: f.path})
+	}
+	if len(jobs) > maxMultiTailJobs {
+		jobs = jobs[:maxMultiTailJobs]
+	}
+	msg := multiTailPathsMsg{jobs: jobs, logsOf: m.jobID}
+	return func() tea.Msg { return msg }
+}
+
+// updateLogPicker handles the keys of the file picker.
+func (m TailModel) updateLogPicker(msg tea.KeyMsg) (TailModel, tea.Cmd) {
+	p, files := m.logPicker, m.jobLogs.files
+	switch {
+	case key.Matches(msg, scrollKeys.Up):
+		p.cursor--
+	case key.Matches(msg, scrollKeys.Down):
+		p.cursor++
+	case key.Matches(msg, dialogKeys.Home):
+		p.cursor = 0
+	case key.Matches(msg, dialogKeys.End):
+		p.cursor = len(files) - 1
+	case key.Matches(msg, dialogKeys.Toggle):
+		if p.cursor < len(files) {
+			path := files[p.cursor].path
+			p.marked[path] = !p.marked[path]
+			if !p.marked[path] {
+				delete(p.marked, path)
+			}
+			p.cursor++
+		}
+	case key.Matches(msg, dialogKeys.Confirm):
+		if p.cursor < len(files) {
+			m.logPicker = nil
+			return m.openLogFile(files[p.cursor])
+		}
+	case key.Matches(msg, dialogKeys.Merge):
+		if len(files) > 0 {
+			cmd := m.mergeLogFilesCmd()
+			m.logPicker = nil
+			return m, cmd
+		}
+	case key.Matches(msg, dialogKeys.Reload):
+		if !m.jobLogs.loading {
+			return m, m.jobLogs.discoverCmd()
+		}
+	case key.Matches(msg, dialogKeys.Back, dialogKeys.Close, tailKeys.LogFiles):
+		m.logPicker = nil
+		return m, nil
+	}
+	p.cursor = max(min(p.cursor, len(files)-1), 0)
+	return m, nil
+}
+
+// renderLogPicker draws the file picker over the whole view.
+func (m TailModel) renderLogPicker() string {
+	p, set := m.logPicker, m.jobLogs
+	height := max(m.height-4, 3)
+	first := max(min(p.cursor-height/2, len(set.files)-height), 0)
+	width := max(m.width-2, 20)
+	labelWidth := 0
+	for _, f := range set.files {
+		labelWidth = max(labelWidth, runeLen(f.label))
+	}
+	current := map[string]bool{}
+	for _, pane := range []string{"stdout", "stderr"} {
+		if m.mode == TailModeBoth || m.mode == TailModeMerged || m.focusedPane() == pane {
+			current[m.panePath(pane)] = true
+		}
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("Output files of job %s: %d", m.jobID, len(set.files))))
+	b.WriteString("\n\n")
+	switch {
+	case set.loading:
+		b.WriteString("Looking for the logs of the job's steps…\n")
+	case set.err != nil:
+		b.WriteString(fmt.Sprintf("⚠ %v\n", set.err))
+	}
+	for i := first; i < len(set.files) && i < first+height; i++ {
+		f := set.files[i]
+		mark := "  "
+		switch {
+		case p.marked[f.path]:
+			mark = "✓ "
+		case current[f.path]:
+			mark = "> "
+		}
+		row := fmt.Sprintf("%s%-*s  %-6s  %s", mark, labelWidth, f.label, f.stream, f.path)
+		if !f.modTime.IsZero() {
+			row += "  " + formatMem(float64(f.size)) + "  " + formatAge(f.modTime, now)
+		}
+		if runeLen(row) > width {
+			row = runeSlice(row, 0, width-1) + "…"
+		}
+		if i == p.cursor {
+			row = tailSelectionStyle.Render(row)
+		}
+		b.WriteString(row)
+		b.WriteByte('\n')
+	}
+	b.WriteString("\n" + hints("  ",
+		hint("select", scrollKeys.Up, scrollKeys.Down),
+		hint("show", dialogKeys.Confirm),
+		hint("mark", dialogKeys.Toggle),
+		hint("merge marked (or all)", dialogKeys.Merge),
+		hint("rescan", dialogKeys.Reload),
+		hint("close", dialogKeys.Back)))
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestExpandLogPatternLabelsTasksAndNodes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"123.0.0.out", "123.0.10.out", "123.0.1.out", "124.0.0.out", "123.1.gpu01.node.out", "train-123.03.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	labels := func(files []jobLogFile) []string {
+		var got []string
+		for _, f := range files {
+			got = append(got, f.label+" "+filepath.Base(f.path))
+		}
+		return got
+	}
+	vars := logPatternVars{jobID: "123", step: "0", name: "train", workDir: dir}
+
+	got := labels(expandLogPattern("%j.%s.%t.out", "stdout", vars))
+	want := []string{"step 0 task 0 123.0.0.out", "step 0 task 1 123.0.1.out", "step 0 task 10 123.0.10.out"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the tasks of step 0 in order, got %v", got)
+	}
+
+	vars.step = ""
+	if got := labels(expandLogPattern(filepath.Join(dir, "%j.%s.%N.node.out"), "stdout", vars)); !reflect.DeepEqual(got, []string{"step 1 node gpu01 123.1.gpu01.node.out"}) {
+		t.Fatalf("expected the node file of step 1, got %v", got)
+	}
+	if got := labels(expandLogPattern("%x-%j.%2t.log", "stderr", vars)); !reflect.DeepEqual(got, []string{"task 03 train-123.03.log"}) {
+		t.Fatalf("expected the padded task file, got %v", got)
+	}
+}
+
+func TestParseStepAndSrunOutputs(t *testing.T) {
+	out := "StepId=123.0 UserId=1000 StartTime=2024-05-01T10:00:00 State=RUNNING StdIn=/dev/null StdOut=/w/%j.%t.out StdErr=/w/%j.%t.err\n" +
+		"StepId=123.extern UserId=1000 State=RUNNING\n"
+	if got := parseStepOutputs(out); !reflect.DeepEqual(got, []stepOutput{{step: "0", stdout: "/w/%j.%t.out", stderr: "/w/%j.%t.err"}}) {
+		t.Fatalf("unexpected steps %v", got)
+	}
+
+	script := "#!/bin/bash\n#SBATCH --output=job.out\n# srun --output=ignored.out\nOMP_NUM_THREADS=4 srun -n 8 --output=rank-%t.out ./app\nsrun ./plain\n"
+	if got := srunOutputPatterns(script); !reflect.DeepEqual(got, []stepOutput{{stdout: "rank-%t.out"}}) {
+		t.Fatalf("unexpected srun patterns %v", got)
+	}
+}
+
+func TestTailLogPickerSwitchesAndMergesFiles(t *testing.T) {
+	m := NewTailModel("42", "/logs/42.out", "/logs/42.err", 100, 20, TailModeStdout)
+	m.jobLogs.files = []jobLogFile{
+		{label: "job", stream: "stdout", path: "/logs/42.out"},
+		{label: "job", stream: "stderr", path: "/logs/42.err"},
+		{label: "step 0 task 0", stream: "stdout", path: "/logs/42.0.0.out", size: 1536, modTime: time.Now()},
+		{label: "step 0 task 1", stream: "stdout", path: "/logs/42.0.1.out"},
+	}
+	update := func(msg tea.Msg) tea.Cmd {
+		model, cmd := m.Update(msg)
+		m = model.(TailModel)
+		return cmd
+	}
+	press := func(keys string) tea.Cmd {
+		var cmd tea.Cmd
+		for _, r := range keys {
+			cmd = update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+		return cmd
+	}
+
+	if cmd := press("F"); cmd != nil || !m.InOverlay() || !strings.Contains(m.View(), "Output files of job 42: 4") {
+		t.Fatalf("expected the picker with the known files:\n%s", m.View())
+	}
+	if !strings.Contains(m.View(), "42.0.0.out  1.5K  just now") {
+		t.Fatalf("expected the size and age found with the file:\n%s", m.View())
+	}
+	press("jj")
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.InOverlay() || m.stdoutPath != "/logs/42.0.0.out" || m.stderrPath != "/logs/42.err" || m.mode != TailModeStdout {
+		t.Fatalf("expected the task file in the stdout pane, got %q", m.stdoutPath)
+	}
+
+	press("F")
+	if m.logPicker.cursor != 2 {
+		t.Fatalf("expected the picker to start at the file shown, got %d", m.logPicker.cursor)
+	}
+	update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+	update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+	cmd := press("m")
+	msg, ok := cmd().(multiTailPathsMsg)
+	if !ok || msg.logsOf != "42" || len(msg.jobs) != 2 || msg.jobs[1] != (multiJob{id: "step 0 task 1", stdout: "/logs/42.0.1.out", stderr: "/logs/42.0.1.out"}) {
+		t.Fatalf("expected the marked files to be merged, got %+v", msg)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	envHistoryDB = "SLURM_DASHBOARD_HISTORY_DB"
+
+	// The database is opened per operation with a short lock timeout so the
+	// TUI, `watch` and other instances can share it.
+	storeLockTimeout = time.Second
+
+	// sacct deltas overlap the previous sync a little so jobs that changed
+	// while the last query ran are not missed.
+	storeSyncOverlap = 10 * time.Minute
+)
+
+var (
+	storeJobsBucket = []byte("jobs")
+	storeMetaBucket = []byte("meta")
+
+	storeLastSyncKey   = []byte("last_sync")
+	storeSyncedFromKey = []byte("synced_from")
+)
+
+// storedJob is the persisted record of a job.
+type storedJob struct {
+	Job       Job       `json:"job"`
+	Details   string    `json:"details,omitempty"`
+	Stdout    string    `json:"stdout,omitempty"`
+	Stderr    string    `json:"stderr,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// seenAt is the time used to place a job in the history window: its end time
+// when sacct reported one, otherwise when the dashboard last saw it.
+func (r storedJob) seenAt() time.Time {
+	if end, err := time.ParseInLocation(sacctTimeLayout, r.Job.End, time.Local); err == nil {
+		return end
+	}
+	return r.LastSeen
+}
+
+// jobStore is the local job history database (bbolt). It keeps every job
+// seen in live and history mode, plus details and resolved log paths, so
+// history survives sacct retention and loads without querying sacct.
+type jobStore struct {
+	path string
+
+	mu      sync.Mutex
+	written map[string]Job // last job record written, to skip no-op updates
+}
+
+// historyDBPath returns the database location. SLURM_DASHBOARD_HISTORY_DB
+// overrides the default ~/.slurm-dashboard/history.db; "off" disables it.
+func historyDBPath() string {
+	if configured := strings.TrimSpace(os.Getenv(envHistoryDB)); configured != "" {
+		switch strings.ToLower(configured) {
+		case "off", "none", "false", "0":
+			return ""
+		}
+		return expandHomePath(configured)
+	}
+	dir := dashboardDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "history.db")
+}
+
+// openJobStore returns nil when the store is disabled.
+func openJobStore(path string) *jobStore {
+	if path == "" {
+		return nil
+	}
+	return &jobStore{path: path, written: map[string]Job{}}
+}
+
+func (s *jobStore) with(readOnly bool, fn func(tx *bolt.Tx) error) error {
+	if s == nil {
+		return errors.New("job store disabled")
+	}
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(s.path); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(s.path, 0o600, &bolt.Options{Timeout: storeLockTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if readOnly {
+		return db.View(fn)
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{storeJobsBucket, storeMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func getStoredJob(b *bolt.Bucket, id string) (storedJob, bool) {
+	var rec storedJob
+	if b == nil {
+		return rec, false
+	}
+	data := b.Get([]byte(id))
+	if data == nil || json.Unmarshal(data, &rec) != nil {
+		return storedJob{}, false
+	}
+	return rec, true
+}
+
+func putStoredJob(b *bolt.Bucket, rec storedJob) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(rec.Job.JobID), data)
+}
+
+// updateJob applies fn to the stored record of a job (creating it if needed).
+func (s *jobStore) updateJob(id string, fn func(rec *storedJob)) error {
+	return s.with(false, func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeJobsBucket)
+		rec, ok := getStoredJob(b, id)
+		if !ok {
+			rec = storedJob{Job: Job{JobID: id}, FirstSeen: time.Now()}
+		}
+		fn(&rec)
+		return putStoredJob(b, rec)
+	})
+}
+
+// RecordJobs upserts job records. Jobs unchanged since the last write from
+// this process are skipped, which spares finished and pending jobs on every
+// refresh; running jobs are rewritten each time as their elapsed time grows.
+func (s *jobStore) RecordJobs(jobs []Job) error {
+	if s == nil || len(jobs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []Job
+	for _, job := range jobs {
+		if prev, ok := s.written[job.JobID]; !ok || prev != job {
+			changed = append(changed, job)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	err := s.with(false, func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeJobsBucket)
+		for _, job := range changed {
+			rec, ok := getStoredJob(b, job.JobID)
+			if !ok {
+				rec.FirstSeen = now
+			}
+			rec.Job = mergeJobRecord(rec.Job, job)
+			rec.LastSeen = now
+			if err := putStoredJob(b, rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, job := range changed {
+			s.written[job.JobID] = job
+		}
+	}
+	return err
+}
+
+// mergeJobRecord overlays a fresh observation on a stored one, keeping
+// sacct-only fields that squeue does not report.
+func mergeJobRecord(old, fresh Job) Job {
+	if fresh.ExitCode == "" {
+		fresh.ExitCode = old.ExitCode
+	}
+	if fresh.End == "" {
+		fresh.End = old.End
+	}
+	if fresh.NodeList == "" {
+		fresh.NodeList = old.NodeList
+	}
+	return fresh
+}
+
+// RecordDetails stores the raw details text shown in the details panel.
+func (s *jobStore) RecordDetails(id, details string) error {
+	if s == nil || strings.TrimSpace(details) == "" {
+		return nil
+	}
+	return s.updateJob(id, func(rec *storedJob) { rec.Details = details })
+}
+
+// RecordLogPaths stores the resolved stdout/stderr paths of a job.
+func (s *jobStore) RecordLogPaths(id, stdout, stderr string) error {
+	if s == nil || (stdout == "" && stderr == "") {
+		return nil
+	}
+	return s.updateJob(id, func(rec *storedJob) {
+		rec.Stdout = stdout
+		rec.Stderr = stderr
+	})
+}
+
+// Lookup returns the stored record of a job.
+func (s *jobStore) Lookup(id string) (storedJob, bool) {
+	var rec storedJob
+	var ok bool
+	err := s.with(true, func(tx *bolt.Tx) error {
+		rec, ok = getStoredJob(tx.Bucket(storeJobsBucket), id)
+		return nil
+	})
+	return rec, err == nil && ok
+}
+
+// Jobs returns the stored jobs seen at or after since, newest first.
+func (s *jobStore) Jobs(since time.Time) ([]Job, error) {
+	var recs []storedJob
+	err := s.with(true, func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeJobsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, data []byte) error {
+			var rec storedJob
+			if json.Unmarshal(data, &rec) != nil {
+				return nil
+			}
+			if !rec.seenAt().Before(since) {
+				recs = append(recs, rec)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, 0, len(recs))
+	for _, rec := range recs {
+		jobs = append(jobs, rec.Job)
+	}
+	sortJobsNewestFirst(jobs)
+	return jobs, nil
+}
+
+func (s *jobStore) syncState() (lastSync, syncedFrom time.Time) {
+	_ = s.with(true, func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeMetaBucket)
+		if b == nil {
+			return nil
+		}
+		_ = lastSync.UnmarshalText(b.Get(storeLastSyncKey))
+		_ = syncedFrom.UnmarshalText(b.Get(storeSyncedFromKey))
+		return nil
+	})
+	return lastSync, syncedFrom
+}
+
+func (s *jobStore) setSyncState(lastSync, syncedFrom time.Time) error {
+	return s.with(false, func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeMetaBucket)
+		for key, t := range map[string]time.Time{string(storeLastSyncKey): lastSync, string(storeSyncedFromKey): syncedFrom} {
+			text, err := t.MarshalText()
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SyncHistory brings the store up to date with sacct and returns the jobs of
+// the history window. Only the delta since the last sync is requested from
+// sacct, unless the window reaches further back than anything synced so far.
+func (s *jobStore) SyncHistory(days int, fetch func(time.Time) ([]Job, error)) ([]Job, error) {
+	windowStart := historyWindowStart(days)
+	lastSync, syncedFrom := s.syncState()
+
+	queryStart := windowStart
+	if !lastSync.IsZero() && !syncedFrom.After(windowStart) {
+		queryStart = lastSync.Add(-storeSyncOverlap)
+	} else {
+		syncedFrom = windowStart
+	}
+
+	started := time.Now()
+	fresh, err := fetch(queryStart)
+	if err != nil {
+		return nil, err
+	}
+	// Without the store (e.g. locked by another dashboard) the delta is not
+	// the window: ask sacct for all of it.
+	fullWindow := func() ([]Job, error) {
+		if queryStart.Equal(windowStart) {
+			return fresh, nil
+		}
+		return fetch(windowStart)
+	}
+	if err := s.RecordJobs(fresh); err != nil {
+		return fullWindow()
+	}
+	_ = s.setSyncState(started, syncedFrom)
+
+	jobs, err := s.Jobs(windowStart)
+	if err != nil {
+		return fullWindow()
+	}
+	return jobs, nil
+}
+
+// sortJobsNewestFirst orders jobs by descending job ID (Slurm IDs grow
+// monotonically), with array tasks ordered by task ID.
+func sortJobsNewestFirst(jobs []Job) {
+	key := func(id string) (int, int) {
+		base, task, _ := strings.Cut(id, "_")
+		b, _ := strconv.Atoi(base)
+		t, err := strconv.Atoi(task)
+		if err != nil {
+			t = -1
+		}
+		return b, t
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		bi, ti := key(jobs[i].JobID)
+		bj, tj := key(jobs[j].JobID)
+		if bi != bj {
+			return bi > bj
+		}
+		return ti > tj
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestJobStoreSyncHistoryQueriesOnlyDelta(t *testing.T) {
+	store := openJobStore(filepath.Join(t.TempDir(), "history.db"))
+
+	var queries []time.Time
+	fetch := func(start time.Time) ([]Job, error) {
+		queries = append(queries, start)
+		if len(queries) == 1 {
+			return []Job{
+				{JobID: "100", Name: "old", Status: "COMPLETED", End: time.Now().Add(-time.Hour).Format(sacctTimeLayout)},
+				{JobID: "101", Name: "running", Status: "RUNNING", End: "Unknown"},
+			}, nil
+		}
+		return []Job{{JobID: "101", Name: "running", Status: "FAILED", ExitCode: "1:0", End: time.Now().Format(sacctTimeLayout)}}, nil
+	}
+
+	jobs, err := store.SyncHistory(3, fetch)
+	if err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].JobID != "101" {
+		t.Fatalf("expected both jobs newest first, got %+v", jobs)
+	}
+	if !queries[0].Equal(historyWindowStart(3)) {
+		t.Fatalf("expected first sync to query the whole window, got %s", queries[0])
+	}
+
+	jobs, err = store.SyncHistory(3, fetch)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if !queries[1].After(historyWindowStart(3)) {
+		t.Fatalf("expected second sync to only query the delta, got %s", queries[1])
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected cached job to be kept alongside the delta, got %+v", jobs)
+	}
+	if jobs[0].State() != "F" || jobs[0].ExitCode != "1:0" {
+		t.Fatalf("expected delta to update job 101, got %+v", jobs[0])
+	}
+
+	// A wider window than anything synced so far needs a full query again.
+	if _, err := store.SyncHistory(30, fetch); err != nil {
+		t.Fatalf("wider sync: %v", err)
+	}
+	if !queries[2].Equal(historyWindowStart(30)) {
+		t.Fatalf("expected wider window to trigger a full query, got %s", queries[2])
+	}
+}
+
+func TestJobStoreSyncHistoryFallsBackToTheWholeWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store := openJobStore(path)
+	if _, err := store.SyncHistory(3, func(time.Time) ([]Job, error) {
+		return []Job{{JobID: "100", Status: "COMPLETED", End: time.Now().Format(sacctTimeLayout)}}, nil
+	}); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	// Another dashboard takes the store while sacct is queried for the delta.
+	var other *bolt.DB
+	var queries []time.Time
+	jobs, err := store.SyncHistory(3, func(start time.Time) ([]Job, error) {
+		queries = append(queries, start)
+		if len(queries) == 1 {
+			var err error
+			if other, err = bolt.Open(path, 0o600, nil); err != nil {
+				t.Fatal(err)
+			}
+			return []Job{{JobID: "101", Status: "RUNNING"}}, nil
+		}
+		return []Job{{JobID: "101", Status: "RUNNING"}, {JobID: "100", Status: "COMPLETED"}}, nil
+	})
+	other.Close()
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if len(queries) != 2 || !queries[1].Equal(historyWindowStart(3)) || len(jobs) != 2 {
+		t.Fatalf("expected the whole window from sacct, queried %v, got %+v", queries, jobs)
+	}
+}
+
+func TestJobStoreKeepsDetailsAndLogPaths(t *testing.T) {
+	store := openJobStore(filepath.Join(t.TempDir(), "history.db"))
+
+	if err := store.RecordJobs([]Job{{JobID: "7", Name: "train", Status: "R"}}); err != nil {
+		t.Fatalf("record jobs: %v", err)
+	}
+	if err := store.RecordDetails("7", "JobId=7 JobName=train"); err != nil {
+		t.Fatalf("record details: %v", err)
+	}
+	if err := store.RecordLogPaths("7", "/work/7.out", "/work/7.err"); err != nil {
+		t.Fatalf("record paths: %v", err)
+	}
+	// A later squeue observation must not wipe sacct-only fields or paths.
+	if err := store.RecordJobs([]Job{{JobID: "7", Name: "train", Status: "CG"}}); err != nil {
+		t.Fatalf("record jobs: %v", err)
+	}
+
+	rec, ok := store.Lookup("7")
+	if !ok {
+		t.Fatalf("expected job 7 to be stored")
+	}
+	if rec.Job.Status != "CG" || rec.Details == "" || rec.Stdout != "/work/7.out" || rec.Stderr != "/work/7.err" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
+
+func TestSortJobsNewestFirstOrdersArrayTasks(t *testing.T) {
+	jobs := []Job{{JobID: "9"}, {JobID: "10_2"}, {JobID: "10_10"}, {JobID: "11"}}
+	sortJobsNewestFirst(jobs)
+	want := []string{"11", "10_10", "10_2", "9"}
+	for i, id := range want {
+		if jobs[i].JobID != id {
+			t.Fatalf("position %d: got %s, want %s", i, jobs[i].JobID, id)
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
 	osc52 "github.com/aymanbagabas/go-osc52/v2"
 	"github.com/charmbracelet/bubbles/key"
@@ -30,6 +28,7 @@ const (
 	TailModeBoth TailMode = iota
 	TailModeStdout
 	TailModeStderr
+	TailModeMerged // both streams interleaved in one pane
 )
 
 // TailKeyMap defines keybindings for the tail view
@@ -54,6 +53,26 @@ type TailKeyMap struct {
 	CopyMode      key.Binding
 	ViewPager     key.Binding
 	CopyAll       key.Binding
+	Export        key.Binding
+	MatchList     key.Binding
+	Filter        key.Binding
+	MoreContext   key.Binding
+	LessContext   key.Binding
+	NextError     key.Binding
+	PrevError     key.Binding
+	ShowMerged    key.Binding
+	Timestamps    key.Binding
+	ToggleColors  key.Binding
+	Metrics       key.Binding
+	SyncScroll    key.Binding
+	DiffLines     key.Binding
+	Bookmark      key.Binding
+	Annotate      key.Binding
+	NextBookmark  key.Binding
+	PrevBookmark  key.Binding
+	Bookmarks     key.Binding
+	LogFiles      key.Binding
+	Palette       key.Binding
 	ToggleHelp    key.Binding
 }
 
@@ -63,8 +82,8 @@ func (k TailKeyMap) ShortHelp() []key.Binding {
 
 func (k TailKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.ShowStdout, k.ShowStderr, k.ShowBoth, k.NextPane, k.ToggleLayout, k.ToggleBorders, k.ToggleMouse, k.CopySelection, k.CopyMode, k.ViewPager, k.CopyAll, k.ToggleHelp},
-		{k.Follow, k.Pause, k.Clear, k.Bottom, k.Search, k.FindNext, k.FindPrev, k.Quit},
+		{k.ShowStdout, k.ShowStderr, k.ShowBoth, k.ShowMerged, k.Timestamps, k.NextPane, k.ToggleLayout, k.ToggleBorders, k.ToggleMouse, k.ToggleColors, k.CopySelection, k.CopyMode, k.ViewPager, k.CopyAll, k.Export, k.LogFiles, k.Palette, k.ToggleHelp},
+		{k.Follow, k.Pause, k.Clear, k.Bottom, k.Search, k.FindNext, k.FindPrev, k.MatchList, k.Filter, k.MoreContext, k.LessContext, k.NextError, k.PrevError, k.Metrics, k.SyncScroll, k.DiffLines, k.Bookmark, k.Annotate, k.NextBookmark, k.PrevBookmark, k.Bookmarks, k.Quit},
 	}
 }
 
@@ -78,33 +97,54 @@ var tailKeys = TailKeyMap{
 	ShowStdout:    key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "stdout")),
 	ShowStderr:    key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "stderr")),
 	ShowBoth:      key.NewBinding(key.WithKeys("l"), key.WithHelp("l", "both")),
+	ShowMerged:    key.NewBinding(key.WithKeys("M"), key.WithHelp("M", "merged")),
+	Timestamps:    key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "timestamps")),
 	NextPane:      key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "switch pane")),
 	ToggleLayout:  key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "layout")),
 	ToggleBorders: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "borders")),
 	ToggleMouse:   key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "mouse")),
+	ToggleColors:  key.NewBinding(key.WithKeys("C"), key.WithHelp("C", "log colors")),
 	Search:        key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "search")),
 	FindNext:      key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "next match")),
 	FindPrev:      key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "prev match")),
+	MatchList:     key.NewBinding(key.WithKeys("L"), key.WithHelp("L", "match list")),
+	NextError:     key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "next error")),
+	PrevError:     key.NewBinding(key.WithKeys("["), key.WithHelp("[", "prev error")),
+	Metrics:       key.NewBinding(key.WithKeys("P"), key.WithHelp("P", "metrics")),
+	SyncScroll:    key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "sync scroll (compare)")),
+	DiffLines:     key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "diff (compare)")),
+	Bookmark:      key.NewBinding(key.WithKeys("B"), key.WithHelp("B", "bookmark top line")),
+	Annotate:      key.NewBinding(key.WithKeys("A"), key.WithHelp("A", "note on top line")),
+	NextBookmark:  key.NewBinding(key.WithKeys("}"), key.WithHelp("}", "next bookmark")),
+	PrevBookmark:  key.NewBinding(key.WithKeys("{"), key.WithHelp("{", "prev bookmark")),
+	Bookmarks:     key.NewBinding(key.WithKeys("'"), key.WithHelp("'", "bookmark list")),
+	LogFiles:      key.NewBinding(key.WithKeys("F"), key.WithHelp("F", "step/task logs")),
+	Filter:        key.NewBinding(key.WithKeys("&"), key.WithHelp("&", "filter lines")),
+	MoreContext:   key.NewBinding(key.WithKeys("+"), key.WithHelp("+", "more context")),
+	LessContext:   key.NewBinding(key.WithKeys("-"), key.WithHelp("-", "less context")),
 	CopySelection: key.NewBinding(key.WithKeys("ctrl+y"), key.WithHelp("^y", "copy sel")),
 	CopyMode:      key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy mode")),
 	ViewPager:     key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "view in vim")),
 	CopyAll:       key.NewBinding(key.WithKeys("Y"), key.WithHelp("Y", "copy pane")),
+	Export:        key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "export to file")),
+	Palette:       key.NewBinding(key.WithKeys(":", "ctrl+p"), key.WithHelp(":/^p", "commands")),
 	ToggleHelp:    key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "more keys")),
 }
 
+// logLineMsg carries a batch of lines appended to a followed log.
 type logLineMsg struct {
 	pane     string // "stdout" or "stderr"
-	line     string
-	err      error
+	follower *logFollower
+	lines    []string
+	live     string
 	terminal bool
 }
 
 type tailStartMsg struct {
 	pane         string
 	initialLines []string
-	reader       *bufio.Reader
-	cmd          *exec.Cmd
-	pipe         *os.File
+	follower     *logFollower
+	scrollback   *paneScrollback
 	startErr     error
 }
 
@@ -125,6 +165,24 @@ type TailModel struct {
 	wrappedStdout []string
 	wrappedStderr []string
 
+	// Merged mode pane: both streams in arrival order.
+	mergedView     viewport.Model
+	mergedEntries  []mergedEntry
+	mergedLines    []string
+	wrappedMerged  []string
+	mergedLevels   []lineLevel
+	mergedMatches  []int
+	mergedBuilder  *strings.Builder
+	mergedFilter   *paneFilter
+	showTimestamps bool
+
+	stripColors bool // render logs without their own colors
+
+	// Error/warning level of each displayed line, from the log rules.
+	stdoutLevels []lineLevel
+	stderrLevels []lineLevel
+	rules        *logRuleSet
+
 	// Cached, incrementally-built viewport content for each pane. This avoids
 	// re-joining all lines on every appended log line.
 	//
@@ -141,17 +199,19 @@ type TailModel struct {
 	prevMouseEnabled bool
 	prevActivePane   int
 
-	// Readers for active streams
-	stdoutReader *bufio.Reader
-	stderrReader *bufio.Reader
+	// Followers of the active streams (nil for static logs).
+	stdoutFollower *logFollower
+	stderrFollower *logFollower
 
-	// Underlying pipe read ends (closed on cleanup).
-	stdoutPipe *os.File
-	stderrPipe *os.File
+	// Progress bars still being drawn on the last, unterminated line of each
+	// stream; shown below the pane's lines until the line is complete.
+	stdoutLive string
+	stderrLive string
 
-	// Keep commands alive
-	stdoutCmd *exec.Cmd
-	stderrCmd *exec.Cmd
+	// Where each pane's lines are in its log, for loading earlier and later
+	// parts of it from disk (nil when the log could not be read).
+	stdoutScrollback *paneScrollback
+	stderrScrollback *paneScrollback
 
 	paused    bool
 	following bool
@@ -167,6 +227,47 @@ type TailModel struct {
 	searchInput  textinput.Model
 	inSearchMode bool
 	lastSearch   string
+	searchOpts   searchOptions
+	searchErr    error          // invalid regex typed
+	history      *searchHistory // shared with other log views
+
+	// Lines of each pane matching the search, kept up to date as lines
+	// arrive, for the match counter and list.
+	stdoutMatches []int
+	stderrMatches []int
+
+	inMatchList     bool
+	matchListPane   string
+	matchListCursor int
+
+	// Metrics extracted from stdout, plotted in the metrics panel.
+	metrics   *metricsView
+	inMetrics bool
+
+	// The two jobs compared, nil unless the view compares jobs.
+	compare *compareState
+
+	// The export path prompt (nil when closed), the outcome of the last
+	// export or copy, and the jobs of the main view, for export headers.
+	export *exportPrompt
+	notice string
+	jobs   []Job
+
+	// Bookmarks of the jobs shown, and the note prompt and bookmark list
+	// (nil when closed).
+	bookmarks    *bookmarkStore
+	annotate     *annotatePrompt
+	bookmarkList *bookmarkList
+
+	// The output files of the job, and the file picker (nil when closed).
+	jobLogs   *jobLogSet
+	logPicker *logPicker
+
+	// Grep mode filters; filterPrompt means the search input reads a filter
+	// pattern instead of a search.
+	stdoutFilter *paneFilter
+	stderrFilter *paneFilter
+	filterPrompt bool
 
 	selectionPane   string
 	selectionAnchor selectionPoint
@@ -202,8 +303,11 @@ func DefaultTailStyles() *TailStyles {
 	}
 }
 
-func (m TailModel) InSearchMode() bool {
-	return m.inSearchMode
+// InOverlay reports whether the search input, match list, metrics panel,
+// export or note prompt, bookmark list or file picker is open; they take
+// all keys, including the ones that otherwise leave the log view.
+func (m TailModel) InOverlay() bool {
+	return m.inSearchMode || m.inMatchList || m.inMetrics || m.export != nil || m.annotate != nil || m.bookmarkList != nil || m.logPicker != nil
 }
 
 // Helper for hidden border
@@ -247,6 +351,15 @@ func NewTailModel(jobID, stdoutPath, stderrPath string, width, height int, mode
 		following:     true,
 		showBorders:   true,
 		styles:        DefaultTailStyles(),
+		history:       &searchHistory{},
+		stdoutFilter:  newPaneFilter(),
+		stderrFilter:  newPaneFilter(),
+		mergedFilter:  newPaneFilter(),
+		mergedBuilder: &strings.Builder{},
+		rules:         defaultLogRuleSet,
+		metrics:       newMetricsView(defaultMetricExtractor),
+		bookmarks:     newBookmarkStore(),
+		jobLogs:       &jobLogSet{jobID: jobID, stdout: stdoutPath, stderr: stderrPath},
 	}
 
 	// Search init
@@ -296,18 +409,43 @@ func NewTailModel(jobID, stdoutPath, stderrPath string, width, height int, mode
 		stdoutWidth = fullWidth
 		stderrWidth = fullWidth
 	}
+	stdoutWidth -= logMarkerWidth + bookmarkGutterWidth
+	stderrWidth -= logMarkerWidth + bookmarkGutterWidth
 
 	m.stdoutView = viewport.New(stdoutWidth, vpHeight)
+	m.stdoutView.KeyMap = viewportKeyMap()
 	m.stdoutView.SetContent("Initializing stdout tail...")
 
 	m.stderrView = viewport.New(stderrWidth, vpHeight)
+	m.stderrView.KeyMap = viewportKeyMap()
 	m.stderrView.SetContent("Initializing stderr tail...")
 
+	m.mergedView = viewport.New(stdoutWidth, vpHeight)
+	m.mergedView.KeyMap = viewportKeyMap()
+
 	m.recalculateLayout()
 
 	return m
 }
 
+// carrySettings gives a view replacing this one on other logs the settings
+// and state the views share.
+func (m TailModel) carrySettings(next *TailModel) {
+	next.mouseEnabled = m.mouseEnabled
+	next.history = m.history
+	next.rules = m.rules
+	next.metrics = newMetricsView(m.metrics.extractor)
+	next.stripColors = m.stripColors
+	next.showBorders = m.showBorders
+	next.stacked = m.stacked
+	next.lastSearch = m.lastSearch
+	next.searchOpts = m.searchOpts
+	next.bookmarks = m.bookmarks
+	next.jobs = m.jobs
+	next.jobLogs = m.jobLogs
+	next.recalculateLayout()
+}
+
 func (m *TailModel) recalculateLayout() {
 	if m.width == 0 || m.height == 0 {
 		return
@@ -315,7 +453,7 @@ func (m *TailModel) recalculateLayout() {
 
 	// height - 5 to be safe (Title + Border + Buffer)
 	vpHeight := m.height - 5
-	if m.inSearchMode {
+	if m.inSearchMode || m.export != nil || m.annotate != nil {
 		vpHeight -= searchOverlayHeight
 	}
 	if vpHeight < 5 {
@@ -366,11 +504,16 @@ func (m *TailModel) recalculateLayout() {
 		stdoutWidth = avail
 		stderrWidth = avail
 	}
+	// Room for the bookmark gutter and error markers beside each pane.
+	stdoutWidth -= logMarkerWidth + bookmarkGutterWidth
+	stderrWidth -= logMarkerWidth + bookmarkGutterWidth
 
 	m.stdoutView.Width = stdoutWidth
 	m.stdoutView.Height = stdoutHeight
 	m.stderrView.Width = stderrWidth
 	m.stderrView.Height = stderrHeight
+	m.mergedView.Width = stdoutWidth
+	m.mergedView.Height = stdoutHeight
 
 	m.refreshViewportContent()
 
@@ -383,64 +526,108 @@ func (m *TailModel) recalculateLayout() {
 
 func (m TailModel) Init() tea.Cmd {
 	var cmds []tea.Cmd
-	if m.mode == TailModeBoth || m.mode == TailModeStdout {
+	both := m.mode == TailModeBoth || m.mode == TailModeMerged
+	if both || m.mode == TailModeStdout {
 		cmds = append(cmds, m.startTailCmd("stdout", m.stdoutPath))
 	}
-	if m.mode == TailModeBoth || m.mode == TailModeStderr {
+	if both || m.mode == TailModeStderr {
 		cmds = append(cmds, m.startTailCmd("stderr", m.stderrPath))
 	}
 	return tea.Batch(cmds...)
 }
 
-var ansiCursorRegexp = regexp.MustCompile(`\x1b\[[0-9;]*[A-KSTf]`)
-
-// Helper to clean log lines (handle CR and ANSI cursor codes)
+// Helper to clean log lines (handle CR and escape sequences other than
+// colors)
 func cleanLogLine(line string) string {
-	// 1. Remove ANSI cursor movement codes
-	line = ansiCursorRegexp.ReplaceAllString(line, "")
+	// 1. Handle CR the way a terminal does; this needs the erase-line
+	// sequences progress bars send
+	line = collapseCR(line)
 
-	// 2. Handle CR
-	// Trim trailing CR to avoid losing the line content if it ends with CR
-	line = strings.TrimRight(line, "\r")
-	if idx := strings.LastIndex(line, "\r"); idx != -1 {
-		return line[idx+1:]
-	}
-	return line
+	// 2. Remove cursor movement and other non-SGR escape sequences
+	return dropNonSGR(line)
 }
 
-func (m *TailModel) appendLogLine(pane string, lines *[]string, wrapped *[]string, b *strings.Builder, view *viewport.Model, text string) {
-	cleanLine := cleanLogLine(text)
-	*lines = append(*lines, cleanLine)
-	if MaxLogLines > 0 && len(*lines) > MaxLogLines {
-		*lines = (*lines)[1:]
+// appendLogLine appends one or more lines to a pane, re-rendering its
+// content once per batch.
+func (m *TailModel) appendLogLine(pane string, lines *[]string, wrapped *[]string, b *strings.Builder, view *viewport.Model, texts ...string) {
+	if len(texts) == 0 {
+		return
 	}
+	stickToBottom := m.following && !m.paused && view.AtBottom()
+	needle := m.activeMatcher()
 
-	wrappedLine := m.wrapLine(cleanLine, view.Width)
-	*wrapped = append(*wrapped, wrappedLine)
+	linesRemoved := 0
+	for _, text := range texts {
+		*lines = append(*lines, cleanLogLine(text))
+		if MaxLogLines > 0 && len(*lines) > MaxLogLines {
+			*lines = (*lines)[1:]
+			linesRemoved++
+			if sb := m.paneRefs(pane).scrollback; sb != nil {
+				sb.trimmed++
+				sb.firstLine++
+			}
+		}
+	}
+
+	if d, _ := m.paneDiff(pane); d != nil {
+		// New lines can move the alignment of both panes.
+		other := m.paneRefs(otherPane(pane)).view
+		otherToBottom := m.following && !m.paused && other.AtBottom()
+		m.refreshPaneContent(pane)
+		if stickToBottom {
+			view.GotoBottom()
+		}
+		if otherToBottom {
+			other.GotoBottom()
+		}
+		return
+	}
+
+	// What the pane displays: every line, or what passes its filter.
+	shownRemoved, shown := linesRemoved, *lines
+	if added := len(texts); added < len(shown) {
+		shown = shown[len(shown)-added:]
+	}
+	if f := m.paneRefs(pane).filter; f.active() {
+		shownRemoved, shown = f.update(*lines, linesRemoved, len(texts))
+	}
 
 	visualLinesRemoved := 0
-	trimmedWrapped := false
-	if MaxLogLines > 0 && len(*wrapped) > MaxLogLines {
-		removedBlock := (*wrapped)[0]
-		visualLinesRemoved = visualLineCount(removedBlock)
-		*wrapped = (*wrapped)[1:]
-		trimmedWrapped = true
+	if shownRemoved > len(*wrapped) {
+		shownRemoved = len(*wrapped)
+	}
+	for _, block := range (*wrapped)[:shownRemoved] {
+		visualLinesRemoved += visualLineCount(block)
+	}
+	*wrapped = (*wrapped)[shownRemoved:]
+	levels := m.paneRefs(pane).levels
+	if shownRemoved <= len(*levels) {
+		*levels = (*levels)[shownRemoved:]
 	}
-	m.adjustSelectionAfterTrim(pane, visualLinesRemoved)
 
-	stickToBottom := m.following && !m.paused && view.AtBottom()
+	var appended strings.Builder
+	for _, line := range shown {
+		level := m.classifyLine(pane, line)
+		*levels = append(*levels, level)
+		wrappedLine := m.wrapLine(line, view.Width)
+		*wrapped = append(*wrapped, wrappedLine)
+		for _, visual := range parseStyledLines(wrappedLine) {
+			if b.Len() > 0 || appended.Len() > 0 {
+				appended.WriteByte('\n')
+			}
+			appended.WriteString(renderStyledLine(visual, needle, level, 0, 0, !m.stripColors))
+		}
+	}
+	m.adjustSelectionAfterTrim(pane, visualLinesRemoved)
+	m.updateMatches(pane, needle, shownRemoved, len(shown))
 
-	needle := strings.ToLower(m.activeSearchTerm())
-	if trimmedWrapped {
+	if shownRemoved > 0 {
 		// Can't efficiently remove from the front; rebuild.
 		m.rebuildPaneContent(pane, b, *wrapped, needle)
 	} else {
-		if b.Len() > 0 {
-			b.WriteByte('\n')
-		}
-		b.WriteString(renderLineForSearch(wrappedLine, needle))
+		b.WriteString(appended.String())
 	}
-	view.SetContent(b.String())
+	m.showPaneContent(pane)
 
 	if stickToBottom {
 		view.GotoBottom()
@@ -463,7 +650,7 @@ func (m *TailModel) wrapLine(line string, width int) string {
 }
 
 func (m *TailModel) activeSearchTerm() string {
-	if m.inSearchMode {
+	if m.inSearchMode && !m.filterPrompt {
 		if val := strings.TrimSpace(m.searchInput.Value()); val != "" {
 			return val
 		}
@@ -522,15 +709,21 @@ func runeSlice(s string, start, end int) string {
 	return string(r[start:end])
 }
 
+// paneVisualLines returns the text of the lines a pane shows, as wrapped.
 func (m TailModel) paneVisualLines(pane string) []string {
+	var lines []string
 	switch pane {
 	case "stdout":
-		return flattenWrappedLines(m.wrappedStdout)
+		lines = flattenWrappedLines(m.wrappedStdout)
 	case "stderr":
-		return flattenWrappedLines(m.wrappedStderr)
-	default:
-		return nil
+		lines = flattenWrappedLines(m.wrappedStderr)
+	case "merged":
+		lines = flattenWrappedLines(m.wrappedMerged)
+	}
+	for i, line := range lines {
+		lines[i] = stripANSI(line)
 	}
+	return lines
 }
 
 func (m TailModel) paneGeometry(pane string) (paneGeometry, bool) {
@@ -542,9 +735,9 @@ func (m TailModel) paneGeometry(pane string) (paneGeometry, bool) {
 		return paneGeometry{
 			x:             x,
 			y:             y,
-			width:         vpWidth + borderX,
+			width:         vpWidth + bookmarkGutterWidth + logMarkerWidth + borderX,
 			height:        headerHeight + vpHeight + borderY,
-			contentX:      x + 1,
+			contentX:      x + 1 + bookmarkGutterWidth,
 			contentY:      y + headerHeight + 1,
 			contentWidth:  vpWidth,
 			contentHeight: vpHeight,
@@ -562,6 +755,11 @@ func (m TailModel) paneGeometry(pane string) (paneGeometry, bool) {
 			return paneGeometry{}, false
 		}
 		return makeGeom(0, 0, m.stderrView.Width, m.stderrView.Height), true
+	case TailModeMerged:
+		if pane != "merged" {
+			return paneGeometry{}, false
+		}
+		return makeGeom(0, 0, m.mergedView.Width, m.mergedView.Height), true
 	default:
 		stdoutGeom := makeGeom(0, 0, m.stdoutView.Width, m.stdoutView.Height)
 		stderrGeom := makeGeom(0, 0, m.stderrView.Width, m.stderrView.Height)
@@ -570,7 +768,7 @@ func (m TailModel) paneGeometry(pane string) (paneGeometry, bool) {
 			stderrGeom.contentY = stderrGeom.y + headerHeight + 1
 		} else {
 			stderrGeom.x = stdoutGeom.width
-			stderrGeom.contentX = stderrGeom.x + 1
+			stderrGeom.contentX = stderrGeom.x + 1 + bookmarkGutterWidth
 		}
 		if pane == "stdout" {
 			return stdoutGeom, true
@@ -598,6 +796,13 @@ func (m TailModel) paneFromMouse(x, y int) string {
 			}
 		}
 		return ""
+	case TailModeMerged:
+		if g, ok := m.paneGeometry("merged"); ok {
+			if x >= g.x && x < g.x+g.width && y >= g.y && y < g.y+g.height {
+				return "merged"
+			}
+		}
+		return ""
 	default:
 		if g, ok := m.paneGeometry("stdout"); ok {
 			if x >= g.x && x < g.x+g.width && y >= g.y && y < g.y+g.height {
@@ -626,6 +831,10 @@ func (m TailModel) paneSelectionPoint(pane string, x, y int, clampToViewport boo
 
 	localX := x - geom.contentX
 	localY := y - geom.contentY
+	if localX < 0 && localX >= -bookmarkGutterWidth {
+		// The bookmark gutter is the start of its lines.
+		localX = 0
+	}
 
 	if clampToViewport {
 		if localX < 0 {
@@ -650,6 +859,8 @@ func (m TailModel) paneSelectionPoint(pane string, x, y int, clampToViewport boo
 		vp = m.stdoutView
 	case "stderr":
 		vp = m.stderrView
+	case "merged":
+		vp = m.mergedView
 	default:
 		return selectionPoint{}, false
 	}
@@ -683,6 +894,8 @@ func (m *TailModel) refreshPaneContent(pane string) {
 		m.refreshStdoutContent()
 	case "stderr":
 		m.refreshStderrContent()
+	case "merged":
+		m.refreshMergedContent()
 	}
 }
 
@@ -819,96 +1032,110 @@ func (m TailModel) selectedText() string {
 	return b.String()
 }
 
-func renderLineForSearch(line, needle string) string {
-	if needle == "" {
-		return line
-	}
-	return highlightMatches(line, needle)
-}
-
-func renderDecoratedLine(line, needle string, selStart, selEnd int, selected bool) string {
-	if !selected {
-		return renderLineForSearch(line, needle)
-	}
-	prefix := runeSlice(line, 0, selStart)
-	selection := runeSlice(line, selStart, selEnd)
-	suffix := runeSlice(line, selEnd, runeLen(line))
-
-	var b strings.Builder
-	b.WriteString(renderLineForSearch(prefix, needle))
-	b.WriteString(tailSelectionStyle.Render(renderLineForSearch(selection, needle)))
-	b.WriteString(renderLineForSearch(suffix, needle))
-	return b.String()
+// renderLineForSearch renders the text of a line with the search matches
+// highlighted.
+func renderLineForSearch(line string, needle *regexp.Regexp) string {
+	return renderStyledLine(parseStyledLines(stripANSI(line))[0], needle, levelNone, 0, 0, false)
 }
 
-func (m *TailModel) rebuildPaneContent(pane string, b *strings.Builder, wrapped []string, needle string) {
+func (m *TailModel) rebuildPaneContent(pane string, b *strings.Builder, wrapped []string, needle *regexp.Regexp) {
 	b.Reset()
+	levels := *m.paneRefs(pane).levels
 	lineIndex := 0
 	for blockIndex, block := range wrapped {
-		lines := strings.Split(block, "\n")
-		for i, line := range lines {
+		level := levelNone
+		if blockIndex < len(levels) {
+			level = levels[blockIndex]
+		}
+		for i, line := range parseStyledLines(block) {
 			if blockIndex > 0 || i > 0 {
 				b.WriteByte('\n')
 			}
-			selStart, selEnd, selected := m.selectionBoundsForLine(pane, lineIndex, line)
-			b.WriteString(renderDecoratedLine(line, needle, selStart, selEnd, selected))
+			selStart, selEnd, selected := m.selectionBoundsForLine(pane, lineIndex, styledPlain(line))
+			if !selected {
+				selStart, selEnd = 0, 0
+			}
+			b.WriteString(renderStyledLine(line, needle, level, selStart, selEnd, !m.stripColors))
 			lineIndex++
 		}
 	}
 }
 
-func highlightMatches(line, needle string) string {
-	if needle == "" || strings.TrimSpace(line) == "" {
-		return line
-	}
-
-	lowerLine := strings.ToLower(line)
-	var b strings.Builder
-	i := 0
-
-	for i < len(line) {
-		idx := strings.Index(lowerLine[i:], needle)
-		if idx == -1 {
-			b.WriteString(line[i:])
-			break
+// updateMatches keeps a pane's match indexes in step after removed displayed
+// lines were dropped from its front and added ones appended.
+func (m *TailModel) updateMatches(pane string, needle *regexp.Regexp, removed, added int) {
+	refs := m.paneRefs(pane)
+	matches := (*refs.matches)[:0]
+	for _, i := range *refs.matches {
+		if i -= removed; i >= 0 {
+			matches = append(matches, i)
 		}
-		start := i + idx
-		end := start + len(needle)
-		b.WriteString(line[i:start])
-		match := strings.ToUpper(line[start:end])
-		b.WriteString(searchHighlightStyle.Render(match))
-		i = end
 	}
-	return b.String()
+	from := len(m.displayLines(pane)) - added
+	if from < 0 {
+		from = 0
+	}
+	*refs.matches = append(matches, m.findMatches(pane, from, needle)...)
+}
+
+// withLogMarkers renders a pane's view between its bookmark gutter and
+// marker column.
+func (m TailModel) withLogMarkers(pane string, vp viewport.Model) string {
+	return lipgloss.JoinHorizontal(lipgloss.Top, m.renderBookmarkGutter(pane), vp.View(), m.renderLogMarkers(pane))
 }
 
 func (m *TailModel) refreshViewportContent() {
 	m.refreshStdoutContent()
 	m.refreshStderrContent()
+	if m.mode == TailModeMerged {
+		m.refreshMergedContent()
+	}
 }
 
 func (m *TailModel) refreshStdoutContent() {
+	if m.updateDiff() {
+		// The other pane shows the new alignment too.
+		defer m.refreshStderrContent()
+	}
+	if m.stdoutFilter.active() {
+		m.stdoutFilter.rebuild(m.stdoutLines)
+	}
 	m.wrappedStdout = m.wrappedStdout[:0]
-	for _, line := range m.stdoutLines {
+	m.stdoutLevels = m.classifyLines("stdout", m.displayLines("stdout"))
+	m.markDiffLevels("stdout")
+	for _, line := range m.displayLines("stdout") {
 		m.wrappedStdout = append(m.wrappedStdout, m.wrapLine(line, m.stdoutView.Width))
 	}
 	if m.stdoutBuilder == nil {
 		m.stdoutBuilder = &strings.Builder{}
 	}
-	m.rebuildPaneContent("stdout", m.stdoutBuilder, m.wrappedStdout, strings.ToLower(m.activeSearchTerm()))
-	m.stdoutView.SetContent(m.stdoutBuilder.String())
+	needle := m.activeMatcher()
+	m.stdoutMatches = m.findMatches("stdout", 0, needle)
+	m.rebuildPaneContent("stdout", m.stdoutBuilder, m.wrappedStdout, needle)
+	m.showPaneContent("stdout")
 }
 
 func (m *TailModel) refreshStderrContent() {
+	if m.updateDiff() {
+		// The other pane shows the new alignment too.
+		defer m.refreshStdoutContent()
+	}
+	if m.stderrFilter.active() {
+		m.stderrFilter.rebuild(m.stderrLines)
+	}
 	m.wrappedStderr = m.wrappedStderr[:0]
-	for _, line := range m.stderrLines {
+	m.stderrLevels = m.classifyLines("stderr", m.displayLines("stderr"))
+	m.markDiffLevels("stderr")
+	for _, line := range m.displayLines("stderr") {
 		m.wrappedStderr = append(m.wrappedStderr, m.wrapLine(line, m.stderrView.Width))
 	}
 	if m.stderrBuilder == nil {
 		m.stderrBuilder = &strings.Builder{}
 	}
-	m.rebuildPaneContent("stderr", m.stderrBuilder, m.wrappedStderr, strings.ToLower(m.activeSearchTerm()))
-	m.stderrView.SetContent(m.stderrBuilder.String())
+	needle := m.activeMatcher()
+	m.stderrMatches = m.findMatches("stderr", 0, needle)
+	m.rebuildPaneContent("stderr", m.stderrBuilder, m.wrappedStderr, needle)
+	m.showPaneContent("stderr")
 }
 
 func (m *TailModel) enterCopyMode() tea.Cmd {
@@ -990,28 +1217,98 @@ func (m *TailModel) openInPagerCmd(path string) tea.Cmd {
 }
 
 func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.update(msg)
+	if t, ok := model.(TailModel); ok && t.compare != nil && t.compare.sync {
+		t.syncScroll()
+		return t, cmd
+	}
+	return model, cmd
+}
+
+func (m TailModel) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
 
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		m.notice = ""
+		if m.export != nil {
+			return m.updateExport(msg)
+		}
+		if m.annotate != nil {
+			return m.updateAnnotate(msg)
+		}
+		if m.bookmarkList != nil {
+			return m.updateBookmarkList(msg)
+		}
+		if m.logPicker != nil {
+			return m.updateLogPicker(msg)
+		}
+	}
+
 	if m.inSearchMode {
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
-			switch msg.String() {
-			case "enter":
+			switch {
+			case key.Matches(msg, dialogKeys.Confirm):
+				query := m.searchInput.Value()
+				if m.filterPrompt {
+					if err := m.applyFilterInput(query); err != nil {
+						m.searchErr = err
+						return m, nil
+					}
+					m.history.add(query)
+					m.inSearchMode, m.filterPrompt, m.searchErr = false, false, nil
+					m.searchInput.Blur()
+					m.recalculateLayout()
+					return m, nil
+				}
+				if _, err := compileSearch(strings.TrimSpace(query), m.searchOpts); err != nil {
+					// Keep the input open so the pattern can be fixed.
+					m.searchErr = err
+					return m, nil
+				}
 				m.inSearchMode = false
-				m.lastSearch = m.searchInput.Value()
-				m.performSearch(m.lastSearch, true)
+				m.searchErr = nil
+				m.lastSearch = query
+				m.history.add(query)
+				searchCmd := m.performSearch(m.lastSearch, true)
 				m.refreshViewportContent()
 				m.searchInput.Blur()
 				m.recalculateLayout()
-				return m, nil
-			case "esc":
-				m.inSearchMode = false
+				return m, searchCmd
+			case key.Matches(msg, dialogKeys.Back):
+				m.inSearchMode, m.filterPrompt = false, false
+				m.searchErr = nil
 				m.searchInput.Blur()
 				m.refreshViewportContent()
 				m.recalculateLayout()
 				return m, nil
+			case key.Matches(msg, dialogKeys.HistoryPrev):
+				if query, ok := m.history.prev(m.searchInput.Value()); ok {
+					m.searchInput.SetValue(query)
+					m.searchInput.CursorEnd()
+				}
+			case key.Matches(msg, dialogKeys.HistoryNext):
+				if query, ok := m.history.next(); ok {
+					m.searchInput.SetValue(query)
+					m.searchInput.CursorEnd()
+				}
+			case key.Matches(msg, dialogKeys.SearchRegex):
+				m.searchOpts.regex = !m.searchOpts.regex
+			case key.Matches(msg, dialogKeys.SearchCase):
+				m.searchOpts.caseSensitive = !m.searchOpts.caseSensitive
+			case key.Matches(msg, dialogKeys.SearchWord):
+				m.searchOpts.wholeWord = !m.searchOpts.wholeWord
+			default:
+				m.searchInput, cmd = m.searchInput.Update(msg)
+				cmds = append(cmds, cmd)
+			}
+			m.searchErr = nil
+			if !m.filterPrompt {
+				_, m.searchErr = compileSearch(strings.TrimSpace(m.searchInput.Value()), m.searchOpts)
 			}
+			m.refreshViewportContent()
+			return m, tea.Batch(cmds...)
 		}
 		m.searchInput, cmd = m.searchInput.Update(msg)
 		cmds = append(cmds, cmd)
@@ -1019,6 +1316,55 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 	}
 
+	if m.inMatchList {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			matches := *m.paneRefs(m.matchListPane).matches
+			page := m.height - 4
+			switch {
+			case key.Matches(msg, scrollKeys.Up):
+				m.matchListCursor--
+			case key.Matches(msg, scrollKeys.Down):
+				m.matchListCursor++
+			case key.Matches(msg, scrollKeys.PageUp):
+				m.matchListCursor -= page
+			case key.Matches(msg, scrollKeys.PageDown):
+				m.matchListCursor += page
+			case key.Matches(msg, dialogKeys.Home):
+				m.matchListCursor = 0
+			case key.Matches(msg, dialogKeys.End):
+				m.matchListCursor = len(matches) - 1
+			case key.Matches(msg, dialogKeys.Confirm):
+				m.jumpToMatch()
+				m.inMatchList = false
+			case key.Matches(msg, dialogKeys.Back, dialogKeys.Close, tailKeys.MatchList):
+				m.inMatchList = false
+			}
+			if m.matchListCursor >= len(matches) {
+				m.matchListCursor = len(matches) - 1
+			}
+			if m.matchListCursor < 0 {
+				m.matchListCursor = 0
+			}
+			return m, nil
+		}
+	}
+
+	if m.inMetrics {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, scrollKeys.Up):
+				m.metrics.moveCursor(-1)
+			case key.Matches(msg, scrollKeys.Down):
+				m.metrics.moveCursor(1)
+			case key.Matches(msg, dialogKeys.Toggle, dialogKeys.Confirm):
+				m.metrics.toggle()
+			case key.Matches(msg, dialogKeys.Back, dialogKeys.Close, tailKeys.Metrics):
+				m.inMetrics = false
+			}
+			return m, nil
+		}
+	}
+
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		// Guard against transient zero-size events by reusing the last known
@@ -1048,225 +1394,35 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.recalculateLayout()
 
 	case tea.KeyMsg:
-		switch {
-		case key.Matches(msg, tailKeys.Quit):
-			// Cleanup tail subprocesses and close pipes. Return no message; parent
-			// handles switching back to the main view.
-			stdoutCmd := m.stdoutCmd
-			stderrCmd := m.stderrCmd
-			stdoutPipe := m.stdoutPipe
-			stderrPipe := m.stderrPipe
-
-			m.stdoutCmd = nil
-			m.stderrCmd = nil
-			m.stdoutReader = nil
-			m.stderrReader = nil
-			m.stdoutPipe = nil
-			m.stderrPipe = nil
-
-			return m, tea.Batch(
-				cleanupProcessCmd(stdoutCmd, stdoutPipe),
-				cleanupProcessCmd(stderrCmd, stderrPipe),
-			)
-		case key.Matches(msg, tailKeys.Pause):
-			m.paused = !m.paused
-		case key.Matches(msg, tailKeys.Follow):
-			m.following = !m.following
-			if m.following {
-				m.stdoutView.GotoBottom()
-				m.stderrView.GotoBottom()
-			}
-		case key.Matches(msg, tailKeys.Clear):
-			m.stdoutLines = []string{}
-			m.stderrLines = []string{}
-			m.wrappedStdout = []string{}
-			m.wrappedStderr = []string{}
-			m.clearSelection()
-			if m.stdoutBuilder != nil {
-				m.stdoutBuilder.Reset()
-			}
-			if m.stderrBuilder != nil {
-				m.stderrBuilder.Reset()
-			}
-			m.stdoutView.SetContent("")
-			m.stderrView.SetContent("")
-		case key.Matches(msg, tailKeys.Bottom):
-			m.following = true
-			// Consume this key: the underlying viewport uses "b" for PageUp.
-			// If we fall through to viewport.Update, we'd jump to bottom and then
-			// immediately page up (making "b" feel like it doesn't reach bottom).
-			// In Both mode, apply to the active pane only.
-			switch m.mode {
-			case TailModeStdout:
-				m.stdoutView.GotoBottom()
-			case TailModeStderr:
-				m.stderrView.GotoBottom()
-			default: // TailModeBoth
-				if m.activePane == 0 {
-					m.stdoutView.GotoBottom()
-				} else {
-					m.stderrView.GotoBottom()
-				}
-			}
-			return m, tea.Batch(cmds...)
-		case key.Matches(msg, tailKeys.Top):
-			m.following = false
-			// In Both mode, apply to the active pane only.
-			switch m.mode {
-			case TailModeStdout:
-				m.stdoutView.GotoTop()
-			case TailModeStderr:
-				m.stderrView.GotoTop()
-			default: // TailModeBoth
-				if m.activePane == 0 {
-					m.stdoutView.GotoTop()
-				} else {
-					m.stderrView.GotoTop()
-				}
-			}
-			return m, tea.Batch(cmds...)
-		case key.Matches(msg, tailKeys.CopyMode):
-			var copyCmd tea.Cmd
-			if m.copyMode {
-				copyCmd = m.exitCopyMode()
-			} else {
-				copyCmd = m.enterCopyMode()
-			}
-			if copyCmd != nil {
-				cmds = append(cmds, copyCmd)
-			}
-		case key.Matches(msg, tailKeys.ShowStdout):
-			m.mode = TailModeStdout
-			if m.mouseEnabled {
-				m.mouseEnabled = false // Auto-disable mouse for easier copying
-				cmds = append(cmds, tea.DisableMouse)
-			}
-			m.recalculateLayout()
-		case key.Matches(msg, tailKeys.ShowStderr):
-			m.mode = TailModeStderr
-			if m.mouseEnabled {
-				m.mouseEnabled = false // Auto-disable mouse for easier copying
-				cmds = append(cmds, tea.DisableMouse)
-			}
-			m.recalculateLayout()
-		case key.Matches(msg, tailKeys.ShowBoth):
-			if m.copyMode {
-				if copyCmd := m.exitCopyMode(); copyCmd != nil {
-					cmds = append(cmds, copyCmd)
-				}
-			}
-			m.mode = TailModeBoth
-			// Optional: Restore mouse? Let's leave it to manual toggle or user preference
-			// m.mouseEnabled = true
-			// cmds = append(cmds, tea.EnableMouseCellMotion)
-			m.recalculateLayout()
-		case key.Matches(msg, tailKeys.NextPane):
-			if m.mode == TailModeBoth {
-				m.activePane = (m.activePane + 1) % 2
-			}
-		case key.Matches(msg, tailKeys.ToggleLayout):
-			if m.copyMode && m.mode != TailModeBoth {
-				break
-			}
-			m.stacked = !m.stacked
-			m.recalculateLayout()
-		case key.Matches(msg, tailKeys.ToggleBorders):
-			if m.copyMode {
-				break
-			}
-			m.showBorders = !m.showBorders
-		case key.Matches(msg, tailKeys.ToggleMouse):
-			m.mouseEnabled = !m.mouseEnabled
-		case key.Matches(msg, tailKeys.Search):
-			m.inSearchMode = true
-			if focusCmd := m.searchInput.Focus(); focusCmd != nil {
-				cmds = append(cmds, focusCmd)
-			}
-			m.searchInput.SetValue("")
-			m.recalculateLayout()
-			return m, tea.Batch(cmds...)
-		case key.Matches(msg, tailKeys.FindNext):
-			if m.lastSearch != "" {
-				m.performSearch(m.lastSearch, true)
-			}
-		case key.Matches(msg, tailKeys.FindPrev):
-			if m.lastSearch != "" {
-				m.performSearch(m.lastSearch, false)
-			}
-		case key.Matches(msg, tailKeys.CopySelection):
-			if selected := m.selectedText(); selected != "" {
-				cmds = append(cmds, osc52CopyCmd(selected))
-			}
-			return m, tea.Batch(cmds...)
-		case key.Matches(msg, tailKeys.CopyAll):
-			var lines []string
-			switch m.mode {
-			case TailModeStdout:
-				lines = m.stdoutLines
-			case TailModeStderr:
-				lines = m.stderrLines
-			case TailModeBoth:
-				if m.activePane == 1 {
-					lines = m.stderrLines
-				} else {
-					lines = m.stdoutLines
-				}
-			}
-			if len(lines) > 0 {
-				text := strings.Join(lines, "\n")
-				cmds = append(cmds, osc52CopyCmd(text))
-			}
-			// Don't fall through to viewport.Update for this key
-			return m, tea.Batch(cmds...)
-		case key.Matches(msg, tailKeys.ViewPager):
-			var path string
-			switch m.mode {
-			case TailModeStdout:
-				path = m.stdoutPath
-			case TailModeStderr:
-				path = m.stderrPath
-			case TailModeBoth:
-				if m.activePane == 1 {
-					path = m.stderrPath
-				} else {
-					path = m.stdoutPath
-				}
-			}
-			if path != "" {
-				if pagerCmd := m.openInPagerCmd(path); pagerCmd != nil {
-					cmds = append(cmds, pagerCmd)
-				}
+		if action := pressedAction(msg, &tailKeys); action != nil {
+			actionCmd, done := m.handleAction(action)
+			cmds = append(cmds, actionCmd)
+			if done {
+				return m, tea.Batch(cmds...)
 			}
 		}
 
-		// Detect scrolling keys to disable follow
-		// viewport keys: k, j, up, down, pgup, pgdown
-		// We can just check the string
-		k := msg.String()
-		if k == "up" || k == "k" || k == "pgup" || k == "wheel up" {
+		// Scrolling up stops following. Scrolling past the edge of the
+		// window loads more of the log.
+		focused := m.paneRefs(m.focusedPane())
+		switch {
+		case key.Matches(msg, scrollKeys.Up, scrollKeys.PageUp, scrollKeys.HalfPageUp):
 			m.following = false
-		}
-		// If we scroll down and hit bottom, maybe re-enable?
-		// For now, let's just disable on scroll up.
-
-		// Dispatch to appropriate viewport
-		if m.mode == TailModeStdout {
-			m.stdoutView, cmd = m.stdoutView.Update(msg)
-			cmds = append(cmds, cmd)
-		} else if m.mode == TailModeStderr {
-			m.stderrView, cmd = m.stderrView.Update(msg)
-			cmds = append(cmds, cmd)
-		} else {
-			// In Both mode, send to active pane only for scrolling/interactions
-			if m.activePane == 0 {
-				m.stdoutView, cmd = m.stdoutView.Update(msg)
-				cmds = append(cmds, cmd)
-			} else {
-				m.stderrView, cmd = m.stderrView.Update(msg)
-				cmds = append(cmds, cmd)
+			if focused.view.AtTop() {
+				cmds = append(cmds, m.loadEarlierCmd(m.focusedPane()))
+			}
+		case key.Matches(msg, scrollKeys.Down, scrollKeys.PageDown, scrollKeys.HalfPageDown):
+			if focused.view.AtBottom() {
+				cmds = append(cmds, m.loadLaterCmd(m.focusedPane()))
 			}
 		}
 
+		// Dispatch to the focused viewport; in Both mode that is the active
+		// pane.
+		view := m.paneRefs(m.focusedPane()).view
+		*view, cmd = view.Update(msg)
+		cmds = append(cmds, cmd)
+
 	case tea.MouseMsg:
 		pane := m.paneFromMouse(msg.X, msg.Y)
 		if pane == "stdout" {
@@ -1282,25 +1438,19 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if isWheelMouse(msg) {
 			targetPane := pane
 			if targetPane == "" {
-				if m.mode == TailModeStdout {
-					targetPane = "stdout"
-				} else if m.mode == TailModeStderr {
-					targetPane = "stderr"
-				} else if m.activePane == 1 {
-					targetPane = "stderr"
-				} else {
-					targetPane = "stdout"
-				}
+				targetPane = m.focusedPane()
 			}
 
-			if targetPane == "stdout" {
-				m.stdoutView, cmd = m.stdoutView.Update(msg)
-				cmds = append(cmds, cmd)
-			} else if targetPane == "stderr" {
-				m.stderrView, cmd = m.stderrView.Update(msg)
-				cmds = append(cmds, cmd)
+			if view := m.paneRefs(targetPane).view; isWheelUp(msg) && view.AtTop() {
+				cmds = append(cmds, m.loadEarlierCmd(targetPane))
+			} else if !isWheelUp(msg) && view.AtBottom() {
+				cmds = append(cmds, m.loadLaterCmd(targetPane))
 			}
 
+			view := m.paneRefs(targetPane).view
+			*view, cmd = view.Update(msg)
+			cmds = append(cmds, cmd)
+
 			if m.selecting && m.selectionPane != "" {
 				if pt, ok := m.paneSelectionPoint(m.selectionPane, msg.X, msg.Y, true); ok {
 					if pt != m.selectionCursor {
@@ -1353,10 +1503,22 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.selecting = false
 		}
 
+	case jobLogsMsg:
+		set := msg.set
+		set.loading, set.err = false, msg.err
+		if msg.files != nil {
+			set.files = msg.files
+		}
+		if m.logPicker != nil && set == m.jobLogs {
+			m.logPicker.cursor = m.currentLogFile()
+		}
+		return m, nil
+
 	case tailStartMsg:
 		// Set initial content in one shot to avoid visible "scrolling down" when
 		// loading a lot of historical lines.
 		if msg.pane == "stdout" {
+			m.stdoutLive = ""
 			m.stdoutLines = m.stdoutLines[:0]
 			for _, line := range msg.initialLines {
 				m.stdoutLines = append(m.stdoutLines, cleanLogLine(line))
@@ -1364,21 +1526,27 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if MaxLogLines > 0 && len(m.stdoutLines) > MaxLogLines {
 				m.stdoutLines = m.stdoutLines[len(m.stdoutLines)-MaxLogLines:]
 			}
+			m.stdoutScrollback = msg.scrollback
+			m.numberBookmarkedLines("stdout")
+			if msg.startErr == nil {
+				m.metrics.add(msg.initialLines)
+			}
 			m.refreshStdoutContent()
+			m.recordMerged("stdout", time.Time{}, m.stdoutLines)
 			if m.following && !m.paused {
 				m.stdoutView.GotoBottom()
 			}
 
-			if msg.startErr != nil {
-				// Error already explained in initialLines; don't start reader
+			if msg.startErr != nil || msg.follower == nil {
+				// Error already explained in initialLines, or a static
+				// (compressed or rotated) log; nothing to follow
 				break
 			}
 
-			m.stdoutReader = msg.reader
-			m.stdoutCmd = msg.cmd
-			m.stdoutPipe = msg.pipe
-			cmds = append(cmds, m.waitForLine("stdout", m.stdoutReader))
+			m.stdoutFollower = msg.follower
+			cmds = append(cmds, m.waitForLine("stdout", m.stdoutFollower))
 		} else {
+			m.stderrLive = ""
 			m.stderrLines = m.stderrLines[:0]
 			for _, line := range msg.initialLines {
 				m.stderrLines = append(m.stderrLines, cleanLogLine(line))
@@ -1386,189 +1554,428 @@ func (m TailModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if MaxLogLines > 0 && len(m.stderrLines) > MaxLogLines {
 				m.stderrLines = m.stderrLines[len(m.stderrLines)-MaxLogLines:]
 			}
+			m.stderrScrollback = msg.scrollback
+			m.numberBookmarkedLines("stderr")
 			m.refreshStderrContent()
+			m.recordMerged("stderr", time.Time{}, m.stderrLines)
 			if m.following && !m.paused {
 				m.stderrView.GotoBottom()
 			}
 
-			if msg.startErr != nil {
-				// Error already explained in initialLines; don't start reader
+			if msg.startErr != nil || msg.follower == nil {
+				// Error already explained in initialLines, or a static
+				// (compressed or rotated) log; nothing to follow
 				break
 			}
 
-			m.stderrReader = msg.reader
-			m.stderrCmd = msg.cmd
-			m.stderrPipe = msg.pipe
-			cmds = append(cmds, m.waitForLine("stderr", m.stderrReader))
+			m.stderrFollower = msg.follower
+			cmds = append(cmds, m.waitForLine("stderr", m.stderrFollower))
 		}
 
-	case logLineMsg:
-		lineHasContent := msg.err == nil || msg.line != ""
+	case scrollbackMsg:
+		cmds = append(cmds, m.applyScrollback(msg))
 
+	case logLineMsg:
+		// Batches from a follower that was already replaced or stopped are
+		// stale.
 		if msg.pane == "stdout" {
-			if lineHasContent {
-				if m.stdoutBuilder == nil {
-					m.stdoutBuilder = &strings.Builder{}
-				}
-				m.appendLogLine("stdout", &m.stdoutLines, &m.wrappedStdout, m.stdoutBuilder, &m.stdoutView, msg.line)
+			if msg.follower != m.stdoutFollower || msg.terminal {
+				break
 			}
-
-			if msg.err != nil {
-				errLine := "EOF (tail exited)"
-				if msg.err != io.EOF {
-					errLine = fmt.Sprintf("Error reading: %v", msg.err)
-				}
-				if m.stdoutBuilder == nil {
-					m.stdoutBuilder = &strings.Builder{}
-				}
-				m.appendLogLine("stdout", &m.stdoutLines, &m.wrappedStdout, m.stdoutBuilder, &m.stdoutView, errLine)
+			if m.stdoutBuilder == nil {
+				m.stdoutBuilder = &strings.Builder{}
 			}
-
-			if !msg.terminal {
-				cmds = append(cmds, m.waitForLine("stdout", m.stdoutReader))
-			} else {
-				// Ensure resources are released if the tail process exits.
-				stdoutCmd := m.stdoutCmd
-				stdoutPipe := m.stdoutPipe
-				m.stdoutCmd = nil
-				m.stdoutReader = nil
-				m.stdoutPipe = nil
-				cmds = append(cmds, cleanupProcessCmd(stdoutCmd, stdoutPipe))
+			liveChanged := m.setLiveLine("stdout", msg.live)
+			m.appendLogLine("stdout", &m.stdoutLines, &m.wrappedStdout, m.stdoutBuilder, &m.stdoutView, msg.lines...)
+			m.metrics.add(msg.lines)
+			m.recordMerged("stdout", time.Now(), msg.lines)
+			if liveChanged && len(msg.lines) == 0 {
+				m.showLiveLine("stdout")
 			}
+			cmds = append(cmds, m.waitForLine("stdout", m.stdoutFollower))
 		} else {
-			if lineHasContent {
-				if m.stderrBuilder == nil {
-					m.stderrBuilder = &strings.Builder{}
-				}
-				m.appendLogLine("stderr", &m.stderrLines, &m.wrappedStderr, m.stderrBuilder, &m.stderrView, msg.line)
+			if msg.follower != m.stderrFollower || msg.terminal {
+				break
 			}
-
-			if msg.err != nil {
-				errLine := "EOF (tail exited)"
-				if msg.err != io.EOF {
-					errLine = fmt.Sprintf("Error reading: %v", msg.err)
-				}
-				if m.stderrBuilder == nil {
-					m.stderrBuilder = &strings.Builder{}
-				}
-				m.appendLogLine("stderr", &m.stderrLines, &m.wrappedStderr, m.stderrBuilder, &m.stderrView, errLine)
+			if m.stderrBuilder == nil {
+				m.stderrBuilder = &strings.Builder{}
 			}
-
-			if !msg.terminal {
-				cmds = append(cmds, m.waitForLine("stderr", m.stderrReader))
-			} else {
-				stderrCmd := m.stderrCmd
-				stderrPipe := m.stderrPipe
-				m.stderrCmd = nil
-				m.stderrReader = nil
-				m.stderrPipe = nil
-				cmds = append(cmds, cleanupProcessCmd(stderrCmd, stderrPipe))
+			liveChanged := m.setLiveLine("stderr", msg.live)
+			m.appendLogLine("stderr", &m.stderrLines, &m.wrappedStderr, m.stderrBuilder, &m.stderrView, msg.lines...)
+			m.recordMerged("stderr", time.Now(), msg.lines)
+			if liveChanged && len(msg.lines) == 0 {
+				m.showLiveLine("stderr")
 			}
+			cmds = append(cmds, m.waitForLine("stderr", m.stderrFollower))
 		}
 	}
-
 	return m, tea.Batch(cmds...)
 }
 
-func (m *TailModel) performSearch(query string, forward bool) {
-	if query == "" {
-		return
+// runAction runs an action of the log view as its key does, for the
+// command palette.
+func (m TailModel) runAction(action *key.Binding) (TailModel, tea.Cmd) {
+	m.notice = ""
+	cmd, _ := m.handleAction(action)
+	if m.compare != nil && m.compare.sync {
+		m.syncScroll()
 	}
-	query = strings.ToLower(query) // Case insensitive for now
-
-	// Helper to get active state
-	var lines []string
-	var vp *viewport.Model
-
-	// If in both mode, search active pane
-	// If single mode, search that mode
+	return m, cmd
+}
 
-	if m.mode == TailModeStdout {
-		lines = m.wrappedStdout
-		vp = &m.stdoutView
-	} else if m.mode == TailModeStderr {
-		lines = m.wrappedStderr
-		vp = &m.stderrView
-	} else {
-		if m.activePane == 0 {
-			lines = m.wrappedStdout
-			vp = &m.stdoutView
+// handleAction runs an action of the log view. done reports that the
+// action is complete; otherwise its key also scrolls the focused pane.
+func (m *TailModel) handleAction(action *key.Binding) (cmd tea.Cmd, done bool) {
+	var cmds []tea.Cmd
+	switch {
+	case action == &tailKeys.Quit:
+		// Stop the followers. Return no message; parent handles switching
+		// back to the main view.
+		stdoutFollower := m.stdoutFollower
+		stderrFollower := m.stderrFollower
+
+		m.stdoutFollower = nil
+		m.stderrFollower = nil
+
+		return tea.Batch(
+			closeFollowerCmd(stdoutFollower),
+			closeFollowerCmd(stderrFollower),
+		), true
+	case action == &tailKeys.Pause:
+		m.paused = !m.paused
+	case action == &tailKeys.Follow:
+		m.following = !m.following
+		if m.following {
+			m.stdoutView.GotoBottom()
+			m.stderrView.GotoBottom()
+			// Panes scrolled back beyond their window show the end again.
+			cmds = append(cmds, m.reattachCmd("stdout"), m.reattachCmd("stderr"))
+		}
+	case action == &tailKeys.Clear:
+		if m.stdoutScrollback != nil {
+			m.stdoutScrollback.cleared(len(m.stdoutLines))
+		}
+		if m.stderrScrollback != nil {
+			m.stderrScrollback.cleared(len(m.stderrLines))
+		}
+		m.stdoutLines = []string{}
+		m.stderrLines = []string{}
+		m.wrappedStdout = []string{}
+		m.wrappedStderr = []string{}
+		m.stdoutLevels, m.stderrLevels = nil, nil
+		m.mergedEntries = nil
+		m.refreshMergedContent()
+		m.clearSelection()
+		if m.stdoutBuilder != nil {
+			m.stdoutBuilder.Reset()
+		}
+		if m.stderrBuilder != nil {
+			m.stderrBuilder.Reset()
+		}
+		m.stdoutView.SetContent("")
+		m.stderrView.SetContent("")
+	case action == &tailKeys.Bottom:
+		m.following = true
+		// Consume this key: the underlying viewport uses "b" for PageUp.
+		// If we fall through to viewport.Update, we'd jump to bottom and then
+		// immediately page up (making "b" feel like it doesn't reach bottom).
+		// In Both mode, apply to the active pane only.
+		pane := m.focusedPane()
+		m.paneRefs(pane).view.GotoBottom()
+		cmds = append(cmds, m.reattachCmd(pane))
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.Top:
+		m.following = false
+		// In Both mode, apply to the active pane only. Beyond the window,
+		// jump to the start of the log.
+		pane := m.focusedPane()
+		m.paneRefs(pane).view.GotoTop()
+		if sb := m.paneRefs(pane).scrollback; sb != nil && !sb.reachesStart() {
+			cmds = append(cmds, m.jumpCmd(pane, logPos{}))
+		}
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.CopyMode:
+		var copyCmd tea.Cmd
+		if m.copyMode {
+			copyCmd = m.exitCopyMode()
 		} else {
-			lines = m.wrappedStderr
-			vp = &m.stderrView
+			copyCmd = m.enterCopyMode()
+		}
+		if copyCmd != nil {
+			cmds = append(cmds, copyCmd)
+		}
+	case action == &tailKeys.ShowStdout && m.compare != nil:
+		*m, cmd = m.switchCompareStream("stdout")
+		return cmd, true
+	case action == &tailKeys.ShowStderr && m.compare != nil:
+		*m, cmd = m.switchCompareStream("stderr")
+		return cmd, true
+	case action == &tailKeys.ShowMerged && m.compare != nil:
+		// Both panes already show one stream.
+		return nil, true
+	case action == &tailKeys.SyncScroll && m.compare != nil:
+		m.compare.sync = !m.compare.sync
+		// Both panes count as moved: the focused one leads.
+		m.compare.offsets = [2]int{-1, -1}
+		return nil, true
+	case action == &tailKeys.DiffLines && m.compare != nil:
+		m.toggleDiff()
+		return nil, true
+	case action == &tailKeys.ShowStdout:
+		m.mode = TailModeStdout
+		if m.mouseEnabled {
+			m.mouseEnabled = false // Auto-disable mouse for easier copying
+			cmds = append(cmds, tea.DisableMouse)
+		}
+		m.recalculateLayout()
+	case action == &tailKeys.ShowStderr:
+		m.mode = TailModeStderr
+		if m.mouseEnabled {
+			m.mouseEnabled = false // Auto-disable mouse for easier copying
+			cmds = append(cmds, tea.DisableMouse)
+		}
+		m.recalculateLayout()
+	case action == &tailKeys.ShowBoth:
+		if m.copyMode {
+			if copyCmd := m.exitCopyMode(); copyCmd != nil {
+				cmds = append(cmds, copyCmd)
+			}
+		}
+		m.mode = TailModeBoth
+		// Optional: Restore mouse? Let's leave it to manual toggle or user preference
+		// m.mouseEnabled = true
+		// cmds = append(cmds, tea.EnableMouseCellMotion)
+		m.recalculateLayout()
+	case action == &tailKeys.ShowMerged:
+		if m.copyMode {
+			if copyCmd := m.exitCopyMode(); copyCmd != nil {
+				cmds = append(cmds, copyCmd)
+			}
+		}
+		m.mode = TailModeMerged
+		m.recalculateLayout()
+		if m.following && !m.paused {
+			m.mergedView.GotoBottom()
+		}
+	case action == &tailKeys.Timestamps:
+		m.showTimestamps = !m.showTimestamps
+		if m.mode == TailModeMerged {
+			m.refreshMergedContent()
+		}
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.NextPane:
+		if m.mode == TailModeBoth {
+			m.activePane = (m.activePane + 1) % 2
+		}
+	case action == &tailKeys.ToggleLayout:
+		if m.copyMode && m.mode != TailModeBoth {
+			break
+		}
+		m.stacked = !m.stacked
+		m.recalculateLayout()
+	case action == &tailKeys.ToggleBorders:
+		if m.copyMode {
+			break
+		}
+		m.showBorders = !m.showBorders
+	case action == &tailKeys.ToggleMouse:
+		m.mouseEnabled = !m.mouseEnabled
+	case action == &tailKeys.ToggleColors:
+		m.stripColors = !m.stripColors
+		m.refreshViewportContent()
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.Search:
+		m.inSearchMode = true
+		if focusCmd := m.searchInput.Focus(); focusCmd != nil {
+			cmds = append(cmds, focusCmd)
+		}
+		m.searchInput.SetValue("")
+		m.history.reset()
+		m.recalculateLayout()
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.FindNext:
+		if m.lastSearch != "" {
+			cmds = append(cmds, m.performSearch(m.lastSearch, true))
+		}
+	case action == &tailKeys.FindPrev:
+		if m.lastSearch != "" {
+			cmds = append(cmds, m.performSearch(m.lastSearch, false))
+		}
+	case action == &tailKeys.Filter:
+		m.inSearchMode = true
+		m.filterPrompt = true
+		if focusCmd := m.searchInput.Focus(); focusCmd != nil {
+			cmds = append(cmds, focusCmd)
+		}
+		m.searchInput.SetValue("")
+		m.history.reset()
+		m.recalculateLayout()
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.MoreContext:
+		m.changeFilterContext(1)
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.LessContext:
+		m.changeFilterContext(-1)
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.NextError:
+		m.jumpToError(true)
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.PrevError:
+		m.jumpToError(false)
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.MatchList:
+		if m.lastSearch != "" {
+			m.openMatchList()
+		}
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.Metrics:
+		m.inMetrics = true
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.Export:
+		return m.openExport(), true
+	case action == &tailKeys.Bookmark:
+		m.toggleBookmark()
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.Annotate:
+		return m.openAnnotate(), true
+	case action == &tailKeys.NextBookmark:
+		return m.jumpToBookmark(true), true
+	case action == &tailKeys.PrevBookmark:
+		return m.jumpToBookmark(false), true
+	case action == &tailKeys.Bookmarks:
+		m.openBookmarkList()
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.LogFiles:
+		return m.openLogPicker(), true
+	case action == &tailKeys.CopySelection:
+		if selected := m.selectedText(); selected != "" && !m.copyTooLarge(selected) {
+			cmds = append(cmds, osc52CopyCmd(selected))
+		}
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.CopyAll:
+		// With a filter, copy what the pane shows.
+		lines := m.displayLines(m.focusedPane())
+		if len(lines) > 0 {
+			if text := stripANSI(strings.Join(lines, "\n")); !m.copyTooLarge(text) {
+				cmds = append(cmds, osc52CopyCmd(text))
+			}
+		}
+		// Don't fall through to viewport.Update for this key
+		return tea.Batch(cmds...), true
+	case action == &tailKeys.ViewPager:
+		var path string
+		switch m.mode {
+		case TailModeStdout:
+			path = m.stdoutPath
+		case TailModeStderr:
+			path = m.stderrPath
+		case TailModeBoth:
+			if m.activePane == 1 {
+				path = m.stderrPath
+			} else {
+				path = m.stdoutPath
+			}
+		}
+		if path != "" {
+			if pagerCmd := m.openInPagerCmd(path); pagerCmd != nil {
+				cmds = append(cmds, pagerCmd)
+			}
 		}
 	}
+	return tea.Batch(cmds...), false
+}
 
-	if len(lines) == 0 {
-		return
+// performSearch jumps to the next (or previous) line of the focused pane
+// containing query. When the pane holds only part of the log, a search that
+// runs off the window continues on disk and the returned command loads the
+// window around the match; otherwise it wraps around within the pane.
+func (m *TailModel) performSearch(query string, forward bool) tea.Cmd {
+	if query == "" {
+		return nil
+	}
+	re, err := compileSearch(strings.TrimSpace(query), m.searchOpts)
+	if err != nil || re == nil {
+		return nil
+	}
+	pane := m.focusedPane()
+	refs := m.paneRefs(pane)
+	lines, wrapped, vp := m.displayLines(pane), *refs.wrapped, refs.view
+	if len(lines) == 0 || len(wrapped) != len(lines) {
+		return nil
+	}
+	shownMatch := func(i int) bool {
+		return re.MatchString(stripANSI(lines[i])) && m.rawIndex(pane, i) >= 0
 	}
 
-	currentY := vp.YOffset
-	foundIndex := -1
+	// Lines wrap over several visual lines; YOffset counts visual lines.
+	starts := make([]int, len(wrapped))
+	current, visual := 0, 0
+	for i, block := range wrapped {
+		starts[i] = visual
+		if visual <= vp.YOffset {
+			current = i
+		}
+		visual += visualLineCount(block)
+	}
 
-	if forward {
-		// Start from next line
-		start := currentY + 1
-		if start >= len(lines) {
-			start = 0
-		} // wrap around? or stop? let's wrap
+	foundIndex := -1
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for i := current + step; i >= 0 && i < len(lines); i += step {
+		if shownMatch(i) {
+			foundIndex = i
+			break
+		}
+	}
 
-		for i := start; i < len(lines); i++ {
-			if strings.Contains(strings.ToLower(lines[i]), query) {
-				foundIndex = i
-				break
+	if foundIndex == -1 {
+		if sb := refs.scrollback; sb != nil && !sb.wholeLogLoaded() {
+			match := func(line string) bool { return re.MatchString(stripANSI(line)) }
+			if f := refs.filter; f.active() {
+				// Only lines the filter shows are worth jumping to.
+				match = func(line string) bool { return re.MatchString(stripANSI(line)) && f.matches(line) }
 			}
+			return m.searchLogCmd(pane, match, forward)
 		}
 		// Wrap around
-		if foundIndex == -1 {
-			for i := 0; i < start; i++ {
-				if strings.Contains(strings.ToLower(lines[i]), query) {
-					foundIndex = i
-					break
-				}
-			}
-		}
-	} else {
-		// Backward
-		start := currentY - 1
-		if start < 0 {
-			start = len(lines) - 1
-		}
-
-		for i := start; i >= 0; i-- {
-			if strings.Contains(strings.ToLower(lines[i]), query) {
+		for n := 1; n <= len(lines); n++ {
+			i := ((current+step*n)%len(lines) + len(lines)) % len(lines)
+			if shownMatch(i) {
 				foundIndex = i
 				break
 			}
 		}
-		// Wrap around
-		if foundIndex == -1 {
-			for i := len(lines) - 1; i > start; i-- {
-				if strings.Contains(strings.ToLower(lines[i]), query) {
-					foundIndex = i
-					break
-				}
-			}
-		}
 	}
 
 	if foundIndex != -1 {
 		m.following = false // Disable follow on jump
-		vp.YOffset = foundIndex
-
-		// Persist changes to the struct copies?
-		// NOTE: m.stdoutView is a Value type in the struct, so updating 'vp' pointer
-		// updates the field because we took address &m.stdoutView
-		// Wait, m is receiver (m *TailModel), so it works.
+		vp.SetYOffset(starts[foundIndex])
 	}
+	return nil
 }
 
 func (m TailModel) View() string {
+	if m.inMatchList {
+		return m.renderMatchList()
+	}
+	if m.bookmarkList != nil {
+		return m.renderBookmarkList()
+	}
+	if m.logPicker != nil {
+		return m.renderLogPicker()
+	}
+	if m.inMetrics {
+		return m.renderMetrics()
+	}
 	if m.copyMode {
 		var content string
 		switch m.mode {
 		case TailModeStderr:
 			content = m.stderrView.View()
+		case TailModeMerged:
+			content = m.mergedView.View()
 		case TailModeBoth:
 			if m.activePane == 1 {
 				content = m.stderrView.View()
@@ -1582,6 +1989,12 @@ func (m TailModel) View() string {
 		if m.inSearchMode {
 			return m.renderSearchOverlay(content)
 		}
+		if m.export != nil {
+			return m.renderExportOverlay(content)
+		}
+		if m.annotate != nil {
+			return m.renderAnnotateOverlay(content)
+		}
 		return content
 	}
 
@@ -1629,12 +2042,36 @@ func (m TailModel) View() string {
 			status = " [FOLLOW]"
 		}
 
+		if d, _ := m.paneDiff(pane); d == nil {
+			if f := m.paneRefs(pane).filter; f.active() {
+				status += " [grep: " + f.String() + "]"
+			}
+		}
+		if m.compare != nil {
+			status += m.compare.status()
+		}
+		if errors, warnings := m.levelCounts(pane); errors+warnings > 0 {
+			status += fmt.Sprintf(" [%dE %dW]", errors, warnings)
+		}
+		if counter := m.matchCounter(pane); counter != "" {
+			status += " [" + counter + "]"
+		}
+		if sb := m.paneRefs(pane).scrollback; sb != nil {
+			if sb.loading {
+				status += " [LOADING]"
+			} else if sb.detached && !sb.atEnd {
+				status += " [SCROLLBACK]"
+			}
+		}
 		if m.mouseEnabled {
 			status += " [MOUSE]"
 		}
 		if m.hasSelectionInPane(pane) {
 			status += " [SEL]"
 		}
+		if m.notice != "" && isActive {
+			status += " [" + m.notice + "]"
+		}
 
 		// Add active indicator
 		prefix := "  "
@@ -1688,13 +2125,27 @@ func (m TailModel) View() string {
 		if m.inSearchMode {
 			return m.renderSearchOverlay(content)
 		}
+		if m.export != nil {
+			return m.renderExportOverlay(content)
+		}
+		if m.annotate != nil {
+			return m.renderAnnotateOverlay(content)
+		}
 		return content
 	}
 
 	if m.mode == TailModeStdout {
 		content := lipgloss.JoinVertical(lipgloss.Left,
 			header("STDOUT", "stdout", m.stdoutPath, m.stdoutView, true),
-			stdoutStyle.Render(m.stdoutView.View()),
+			stdoutStyle.Render(m.withLogMarkers("stdout", m.stdoutView)),
+		)
+		return wrapIfSearch(content)
+	}
+
+	if m.mode == TailModeMerged {
+		content := lipgloss.JoinVertical(lipgloss.Left,
+			header("MERGED", "merged", m.mergedPath(), m.mergedView, true),
+			stdoutStyle.Render(m.withLogMarkers("merged", m.mergedView)),
 		)
 		return wrapIfSearch(content)
 	}
@@ -1702,7 +2153,7 @@ func (m TailModel) View() string {
 	if m.mode == TailModeStderr {
 		content := lipgloss.JoinVertical(lipgloss.Left,
 			header("STDERR", "stderr", m.stderrPath, m.stderrView, true),
-			stderrStyle.Render(m.stderrView.View()),
+			stderrStyle.Render(m.withLogMarkers("stderr", m.stderrView)),
 		)
 		return wrapIfSearch(content)
 	}
@@ -1711,14 +2162,19 @@ func (m TailModel) View() string {
 	stdoutActive := m.activePane == 0
 	stderrActive := m.activePane == 1
 
+	stdoutName, stderrName := "STDOUT", "STDERR"
+	if m.compare != nil {
+		stdoutName, stderrName = m.compare.title(0), m.compare.title(1)
+	}
+
 	left := lipgloss.JoinVertical(lipgloss.Left,
-		header("STDOUT", "stdout", m.stdoutPath, m.stdoutView, stdoutActive),
-		stdoutStyle.Render(m.stdoutView.View()),
+		header(stdoutName, "stdout", m.stdoutPath, m.stdoutView, stdoutActive),
+		stdoutStyle.Render(m.withLogMarkers("stdout", m.stdoutView)),
 	)
 
 	right := lipgloss.JoinVertical(lipgloss.Left,
-		header("STDERR", "stderr", m.stderrPath, m.stderrView, stderrActive),
-		stderrStyle.Render(m.stderrView.View()),
+		header(stderrName, "stderr", m.stderrPath, m.stderrView, stderrActive),
+		stderrStyle.Render(m.withLogMarkers("stderr", m.stderrView)),
 	)
 
 	if m.stacked {
@@ -1738,11 +2194,38 @@ func (m TailModel) renderSearchOverlay(content string) string {
 		displayValue += " ▍"
 	}
 
+	toggle := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+
 	builder := &strings.Builder{}
-	builder.WriteString("\n/ Search: ")
+	if m.filterPrompt {
+		builder.WriteString("\n" + tailKeys.Filter.Help().Key + " Filter: ")
+	} else {
+		builder.WriteString("\n" + tailKeys.Search.Help().Key + " Search: ")
+	}
 	builder.WriteString(displayValue)
 	builder.WriteString("\n")
-	builder.WriteString("Press Enter to jump, Esc to cancel")
+	if m.searchErr != nil {
+		builder.WriteString(fmt.Sprintf("⚠ %v", m.searchErr))
+	} else if m.filterPrompt {
+		builder.WriteString(hints(", ",
+			hint("add pattern (regex; !pattern hides matches; empty clears the filter)", dialogKeys.Confirm),
+			hint("cancel", dialogKeys.Back),
+			hint("history", dialogKeys.HistoryPrev, dialogKeys.HistoryNext)))
+	} else {
+		builder.WriteString(hints(" · ",
+			hints(", ",
+				hint("jump", dialogKeys.Confirm),
+				hint("cancel", dialogKeys.Back),
+				hint("history", dialogKeys.HistoryPrev, dialogKeys.HistoryNext)),
+			hint("regex: "+toggle(m.searchOpts.regex), dialogKeys.SearchRegex),
+			hint("case: "+toggle(m.searchOpts.caseSensitive), dialogKeys.SearchCase),
+			hint("word: "+toggle(m.searchOpts.wholeWord), dialogKeys.SearchWord)))
+	}
 	builder.WriteString("\n\n")
 	builder.WriteString(content)
 
@@ -1753,120 +2236,88 @@ func (m TailModel) renderSearchOverlay(content string) string {
 
 func (m *TailModel) startTailCmd(pane, path string) tea.Cmd {
 	return func() tea.Msg {
-		if path == "" {
-			archiveDir := logArchiveDir()
-			archiveHint := "  • No archived log found in the convention directory"
-			if archiveDir != "" {
-				archiveHint = fmt.Sprintf("  • No archived log found in %s", archiveDir)
-			}
-			return tailStartMsg{
-				pane: pane,
-				initialLines: []string{
-					"⚠ No log path available",
-					"",
-					"This can happen when:",
-					"  • Job is too old (purged from sacct)",
-					"  • scontrol/sacct couldn't resolve paths",
-					archiveHint,
-					"  • Job was submitted without output files",
-					"",
-					"Convention for finished jobs:",
-					"  • ~/.slurm-dashboard/logs/<jobid>.out",
-					"  • ~/.slurm-dashboard/logs/<jobid>.err",
-					"  • Override dir with SLURM_DASHBOARD_LOG_ARCHIVE_DIR",
-				},
-				startErr: fmt.Errorf("no path provided"),
-			}
-		}
-
-		// Two-phase startup:
-		//  1) Load initial history with `tail -n <N>` in one shot.
-		//  2) Start follow with `tail -n 0 -F` so we don't replay history line-by-line.
-		//
-		// This avoids the UI visibly "scrolling down" when opening very long logs.
-		linesArg := "+1"
-		if MaxLogLines > 0 {
-			linesArg = strconv.Itoa(MaxLogLines)
-		}
-
-		var initialLines []string
-		if out, err := exec.Command("tail", "-n", linesArg, path).CombinedOutput(); err == nil {
-			initialLines = splitTailOutput(out)
-			if len(initialLines) == 0 {
-				initialLines = []string{"(file exists but is empty)"}
-			}
-		} else {
-			// File might not exist yet (job pending/starting) or be inaccessible
-			initialLines = splitTailOutput(out)
-			if len(initialLines) == 0 {
-				initialLines = []string{
-					fmt.Sprintf("⚠ Cannot read: %s", path),
-					"",
-					fmt.Sprintf("Error: %v", err),
-					"",
-					"Waiting for file to appear (tail -F)...",
-				}
-			}
-		}
-
-		cmd := exec.Command("tail", "-n", "0", "-F", path)
+		return startTail(pane, path)
+	}
+}
 
-		// Create a pipe to capture both stdout and stderr
-		r, w, err := os.Pipe()
-		if err != nil {
-			return tailStartMsg{pane: pane, initialLines: initialLines, startErr: fmt.Errorf("creating pipe: %w", err)}
+// startTail reads the end of a log and starts following it.
+func startTail(pane, path string) tailStartMsg {
+	if path == "" {
+		archiveDir := logArchiveDir()
+		archiveHint := "  • No archived log found in the convention directory"
+		if archiveDir != "" {
+			archiveHint = fmt.Sprintf("  • No archived log found in %s", archiveDir)
+		}
+		return tailStartMsg{
+			pane: pane,
+			initialLines: []string{
+				"⚠ No log path available",
+				"",
+				"This can happen when:",
+				"  • Job is too old (purged from sacct)",
+				"  • scontrol/sacct couldn't resolve paths",
+				archiveHint,
+				"  • Job was submitted without output files",
+				"",
+				"Convention for finished jobs:",
+				"  • ~/.slurm-dashboard/logs/<jobid>.out",
+				"  • ~/.slurm-dashboard/logs/<jobid>.err",
+				"  • Override dir with SLURM_DASHBOARD_LOG_ARCHIVE_DIR",
+			},
+			startErr: fmt.Errorf("no path provided"),
+		}
+	}
+
+	// Two-phase startup:
+	//  1) Load initial history natively in one shot: compressed logs are
+	//     decompressed and rotated generations (train.log.1, ...) are
+	//     prepended, so the family reads as one stream.
+	//  2) Follow from where the initial read stopped, in batches.
+	//
+	// This avoids the UI visibly "scrolling down" when opening very long logs.
+	source := newLogSource(path)
+	lines, atStart, end, err := source.tail(MaxLogLines)
+	sb := &paneScrollback{source: source, path: path, static: isStaticLog(path), atStart: atStart, numbered: atStart, start: end}
+	if len(lines) > 0 {
+		sb.start = lines[0].pos
+	}
+	initialLines := texts(lines)
+	if err == nil {
+		if len(initialLines) == 0 {
+			initialLines = []string{"(file exists but is empty)"}
+			sb.trimmed, sb.firstLine = -1, -1
 		}
-
-		cmd.Stdout = w
-		cmd.Stderr = w
-
-		if err := cmd.Start(); err != nil {
-			w.Close()
-			r.Close()
-			return tailStartMsg{pane: pane, initialLines: initialLines, startErr: err}
+	} else {
+		// File might not exist yet (job pending/starting) or be inaccessible
+		initialLines = []string{
+			fmt.Sprintf("⚠ Cannot read: %s", path),
+			"",
+			fmt.Sprintf("Error: %v", err),
+			"",
+			"Waiting for file to appear...",
 		}
-
-		// Close write end in parent so that when child closes it (on exit), scanner sees EOF
-		w.Close()
-
-		reader := bufio.NewReader(r)
-		// We need to pass this reader back to the model to loop on it
-
-		// Also, we need to keep the process reference somewhere if we want to kill it.
-		// Ideally, we wrap this in a struct that we pass back.
-
-		return tailStartMsg{pane: pane, initialLines: initialLines, reader: reader, cmd: cmd, pipe: r}
+		sb.trimmed, sb.firstLine = -len(initialLines), -len(initialLines)
+		sb.start, sb.atStart, sb.numbered = logPos{file: end.file}, true, true
 	}
-}
 
-func splitTailOutput(out []byte) []string {
-	s := strings.TrimRight(string(out), "\r\n")
-	if s == "" {
-		return nil
+	// Compressed logs and rotated generations never grow: no follower.
+	if err == nil && sb.static {
+		return tailStartMsg{pane: pane, initialLines: initialLines, scrollback: sb}
 	}
-	lines := strings.Split(s, "\n")
-	for i := range lines {
-		lines[i] = strings.TrimRight(lines[i], "\r")
-	}
-	return lines
+
+	return tailStartMsg{pane: pane, initialLines: initialLines, scrollback: sb, follower: startLogFollower(path, end.offset)}
 }
 
-func (m *TailModel) waitForLine(pane string, reader *bufio.Reader) tea.Cmd {
+func (m *TailModel) waitForLine(pane string, follower *logFollower) tea.Cmd {
 	return func() tea.Msg {
-		if reader == nil {
-			return logLineMsg{pane: pane, err: fmt.Errorf("log reader not initialized"), terminal: true}
-		}
-
-		line, err := reader.ReadString('\n')
-		line = strings.TrimRight(line, "\r\n")
-
-		return logLineMsg{pane: pane, line: line, err: err, terminal: err != nil}
+		lines, live, ok := follower.Next()
+		return logLineMsg{pane: pane, follower: follower, lines: lines, live: live, terminal: !ok}
 	}
 }
 
 func osc52CopyCmd(text string) tea.Cmd {
 	return func() tea.Msg {
-		seq := osc52.New(text).Limit(100 * 1024)
+		seq := osc52.New(text).Limit(osc52Limit)
 
 		term := strings.ToLower(os.Getenv("TERM"))
 		if tmux := os.Getenv("TMUX"); tmux != "" || strings.HasPrefix(term, "tmux") {
@@ -1880,15 +2331,12 @@ func osc52CopyCmd(text string) tea.Cmd {
 	}
 }
 
-func cleanupProcessCmd(cmd *exec.Cmd, pipe *os.File) tea.Cmd {
+func closeFollowerCmd(follower *logFollower) tea.Cmd {
+	if follower == nil {
+		return nil
+	}
 	return func() tea.Msg {
-		if cmd != nil && cmd.Process != nil {
-			_ = cmd.Process.Kill()
-			_ = cmd.Wait()
-		}
-		if pipe != nil {
-			_ = pipe.Close()
-		}
+		follower.Close()
 		return nil
 	}
 }
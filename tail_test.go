@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -134,3 +137,83 @@ func TestTailMouseWheelExtendsSelectionWhileDragging(t *testing.T) {
 		t.Fatalf("expected %d selected lines, got %d", expectedLines, gotLines)
 	}
 }
+
+// runTailCmd runs cmd and feeds the messages it produces back into the model.
+// Commands still blocked after a moment are waiting for a followed log to
+// grow and are left behind.
+func runTailCmd(t *testing.T, m TailModel, cmd tea.Cmd) TailModel {
+	t.Helper()
+	if cmd == nil {
+		return m
+	}
+	result := make(chan tea.Msg, 1)
+	go func() { result <- cmd() }()
+	var msg tea.Msg
+	select {
+	case msg = <-result:
+	case <-time.After(100 * time.Millisecond):
+		return m
+	}
+	switch msg := msg.(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			m = runTailCmd(t, m, c)
+		}
+	case tailStartMsg, scrollbackMsg:
+		model, next := m.Update(msg)
+		m = runTailCmd(t, model.(TailModel), next)
+	}
+	return m
+}
+
+func TestTailScrollsBackBeyondTheInMemoryWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.out")
+	var b strings.Builder
+	for i := 0; i < MaxLogLines+2500; i++ {
+		fmt.Fprintf(&b, "line %05d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewTailModel("1", path, "", 80, 20, TailModeStdout)
+	m = runTailCmd(t, m, m.startTailCmd("stdout", path))
+	defer m.stdoutFollower.Close()
+	if m.stdoutLines[0] != "line 02500" || m.stdoutScrollback.reachesStart() {
+		t.Fatalf("expected the last %d lines, first is %q", MaxLogLines, m.stdoutLines[0])
+	}
+
+	// Scrolling up at the top of the window loads the chunk before it.
+	m.stdoutView.GotoTop()
+	model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'k'}})
+	m = runTailCmd(t, model.(TailModel), cmd)
+	if len(m.stdoutLines) != MaxLogLines || m.stdoutLines[0] != fmt.Sprintf("line %05d", 2500-logChunkLines) {
+		t.Fatalf("expected a chunk to be prepended, got %d lines from %q", len(m.stdoutLines), m.stdoutLines[0])
+	}
+	if m.stdoutFollower != nil || !m.stdoutScrollback.detached || m.following {
+		t.Fatalf("scrolling back should stop following")
+	}
+	if top := m.stdoutLines[m.stdoutView.YOffset]; top != "line 02499" {
+		t.Fatalf("expected the view to stay near where it was, top line %q", top)
+	}
+
+	// A search that misses the window continues on disk.
+	model, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	m = model.(TailModel)
+	m.searchInput.SetValue("line 00007")
+	model, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = runTailCmd(t, model.(TailModel), cmd)
+	if top := m.stdoutLines[m.stdoutView.YOffset]; top != "line 00007" {
+		t.Fatalf("expected the match at the top of the view, got %q", top)
+	}
+
+	// Bottom shows the end of the log again and resumes following.
+	model, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'G'}})
+	m = runTailCmd(t, model.(TailModel), cmd)
+	if last := m.stdoutLines[len(m.stdoutLines)-1]; last != fmt.Sprintf("line %05d", MaxLogLines+2499) {
+		t.Fatalf("expected the end of the log, got %q", last)
+	}
+	if m.stdoutFollower == nil || m.stdoutScrollback.detached || !m.stdoutView.AtBottom() {
+		t.Fatalf("expected the pane to follow the log again")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	waitMinInterval = 2 * time.Second
+	waitMaxInterval = 30 * time.Second
+	exitWaitTimeout = 124 // same as coreutils timeout(1)
+)
+
+// parseInterleaved parses flags that may appear before, between or after
+// positional arguments (`wait 123 --timeout 1h 456`), which flag.Parse alone
+// does not support.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// slurmExitStatus maps a finished job to a process exit code. Slurm reports
+// "status:signal"; a signal is mapped to 128+signal like a shell does. Jobs
+// that did not complete but report status 0 (cancelled, timed out, node
+// failure) still map to 1 so callers never mistake them for success.
+func slurmExitStatus(job Job) int {
+	status, signal := 0, 0
+	if code := strings.TrimSpace(job.ExitCode); code != "" {
+		parts := strings.SplitN(code, ":", 2)
+		status, _ = strconv.Atoi(parts[0])
+		if len(parts) == 2 {
+			signal, _ = strconv.Atoi(parts[1])
+		}
+	}
+	switch {
+	case signal != 0:
+		return 128 + signal
+	case status != 0:
+		return status
+	case job.State() != "CD":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// logStreamer copies a job's log file to an output as it grows, starting at
+// the beginning of the file. It waits for the file to appear.
+type logStreamer struct {
+	path   string
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex // shared by all streamers writing to out
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func startLogStreamer(path, prefix string, out io.Writer, mu *sync.Mutex) *logStreamer {
+	s := &logStreamer{path: path, prefix: prefix, out: out, mu: mu, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *logStreamer) run() {
+	defer close(s.done)
+	var f *os.File
+	for f == nil {
+		var err error
+		if f, err = os.Open(s.path); err == nil {
+			break
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			s.write(partial)
+			partial = ""
+			continue
+		}
+		select {
+		case <-s.stop:
+			// Flush whatever the job wrote last.
+			if rest, _ := io.ReadAll(reader); len(rest) > 0 || partial != "" {
+				for _, l := range strings.SplitAfter(partial+string(rest), "\n") {
+					if l != "" {
+						s.write(l)
+					}
+				}
+			}
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (s *logStreamer) write(line string) {
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprint(s.out, s.prefix+line)
+}
+
+// Close stops following and waits until the remaining output is written.
+func (s *logStreamer) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func waitUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: slurm-dashboard wait [flags] JOBID...\n\n")
+		fmt.Fprintf(fs.Output(), "Blocks until the jobs finish, printing state changes to stderr, and exits with\n")
+		fmt.Fprintf(fs.Output(), "the job's Slurm exit code (%d on timeout).\n\n", exitWaitTimeout)
+		fs.PrintDefaults()
+	}
+}
+
+// runWait implements `slurm-dashboard wait`.
+func runWait(args []string) int {
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 0, "give up after this long (0 = wait forever)")
+	waitAny := fs.Bool("any", false, "return as soon as any job finishes")
+	waitAll := fs.Bool("all", false, "wait for all jobs to finish (default)")
+	tail := fs.Bool("tail", false, "stream the jobs' stdout to this terminal while waiting")
+	stream := fs.String("stream", "stdout", "log to stream with --tail: stdout or stderr")
+	fs.Usage = waitUsage(fs)
+	ids, err := parseInterleaved(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if len(ids) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *waitAny && *waitAll {
+		fmt.Fprintln(os.Stderr, "wait: --any and --all are mutually exclusive")
+		return exitUsage
+	}
+	if *stream != "stdout" && *stream != "stderr" {
+		fmt.Fprintln(os.Stderr, "wait: --stream must be stdout or stderr")
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	w := newWatcher(ids)
+	if _, err := w.prime(); err != nil {
+		fmt.Fprintf(os.Stderr, "wait: %v\n", err)
+		return exitUsage
+	}
+	for _, job := range w.watched() {
+		fmt.Fprintf(os.Stderr, "%s Job %s (%s) %s\n", time.Now().Format("15:04:05"), job.JobID, job.Name, job.State())
+	}
+
+	var outMu sync.Mutex
+	streamers := map[string]*logStreamer{}
+	startStreams := func() {
+		if !*tail {
+			return
+		}
+		for _, job := range w.watched() {
+			if _, ok := streamers[job.JobID]; ok || job.IsPending() {
+				continue
+			}
+			stdoutPath, stderrPath, err := ResolveLogPaths(job.JobID)
+			path := stdoutPath
+			if *stream == "stderr" {
+				path = stderrPath
+			}
+			if err != nil || path == "" {
+				fmt.Fprintf(os.Stderr, "wait: cannot resolve %s of job %s: %v\n", *stream, job.JobID, err)
+				streamers[job.JobID] = nil
+				continue
+			}
+			prefix := ""
+			if len(w.watched()) > 1 {
+				prefix = "[" + job.JobID + "] "
+			}
+			streamers[job.JobID] = startLogStreamer(path, prefix, os.Stdout, &outMu)
+		}
+	}
+	stopStreams := func() {
+		for _, s := range streamers {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}
+	defer stopStreams()
+
+	interval := waitMinInterval
+	for {
+		startStreams()
+		if job, ok := w.waitResult(*waitAny); ok {
+			stopStreams()
+			streamers = nil
+			if job.JobID == "" {
+				fmt.Fprintln(os.Stderr, "wait: jobs are no longer known to Slurm")
+				return exitWatchFailed
+			}
+			return slurmExitStatus(job)
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Fprintf(os.Stderr, "wait: timed out after %s\n", *timeout)
+				return exitWaitTimeout
+			}
+			return exitInterrupted
+		case <-time.After(interval):
+		}
+
+		events, err := w.poll()
+		for _, ev := range events {
+			fmt.Fprintf(os.Stderr, "%s %s\n", ev.Time.Format("15:04:05"), ev)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wait: %v\n", err)
+		}
+
+		// Poll quickly right after something changed, then back off.
+		if len(events) > 0 {
+			interval = waitMinInterval
+		} else if interval = interval * 3 / 2; interval > waitMaxInterval {
+			interval = waitMaxInterval
+		}
+	}
+}
+
+// waitResult reports whether wait is over and the job whose exit status it
+// exits with: the first job to finish with anyJob, otherwise the first
+// failure once all are done. The job is empty when Slurm forgot them all.
+func (w *watcher) waitResult(anyJob bool) (Job, bool) {
+	jobs := w.watched()
+	if anyJob {
+		for _, job := range jobs {
+			if job.IsHistorical() {
+				return job, true
+			}
+		}
+		return Job{}, len(jobs) == 0
+	}
+	if !w.done() {
+		return Job{}, false
+	}
+	for _, job := range jobs {
+		if slurmExitStatus(job) != 0 {
+			return job, true
+		}
+	}
+	if len(jobs) > 0 {
+		return jobs[0], true
+	}
+	return Job{}, true
+}
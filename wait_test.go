@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlurmExitStatus(t *testing.T) {
+	tests := []struct {
+		job  Job
+		want int
+	}{
+		{Job{Status: "COMPLETED", ExitCode: "0:0"}, 0},
+		{Job{Status: "FAILED", ExitCode: "3:0"}, 3},
+		{Job{Status: "CANCELLED by 123", ExitCode: "0:15"}, 143},
+		{Job{Status: "TIMEOUT", ExitCode: "0:0"}, 1},
+		{Job{Status: "COMPLETED"}, 0},
+	}
+	for _, tc := range tests {
+		if got := slurmExitStatus(tc.job); got != tc.want {
+			t.Errorf("slurmExitStatus(%+v) = %d, want %d", tc.job, got, tc.want)
+		}
+	}
+}
+
+func TestParseInterleavedAcceptsFlagsAfterPositionals(t *testing.T) {
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 0, "")
+	anyFlag := fs.Bool("any", false, "")
+
+	ids, err := parseInterleaved(fs, []string{"123", "--timeout", "5m", "456", "--any"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"123", "456"}) {
+		t.Fatalf("unexpected positionals %v", ids)
+	}
+	if *timeout != 5*time.Minute || !*anyFlag {
+		t.Fatalf("flags after positionals were not parsed: timeout=%s any=%v", *timeout, *anyFlag)
+	}
+}
+
+func TestLogStreamerCopiesGrowingFileAndFlushesOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.out")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var out bytes.Buffer
+	var mu sync.Mutex
+	s := startLogStreamer(path, "[1] ", &out, &mu)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString("second\nno newline")
+	f.Close()
+	s.Close()
+
+	if got, want := out.String(), "[1] first\n[1] second\n[1] no newline\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWaitRightAfterSubmittingAnArray(t *testing.T) {
+	q := &fakeQueue{
+		snapshots: [][]Job{{{JobID: "123_[1-100]", Status: "PD"}}, {}},
+		final: map[string]Job{
+			"123_1": {JobID: "123_1", Status: "COMPLETED", ExitCode: "0:0"},
+			"123_2": {JobID: "123_2", Status: "FAILED", ExitCode: "2:0"},
+		},
+	}
+	w := newFakeWatcher([]string{"123"}, q)
+	if _, err := w.prime(); err != nil {
+		t.Fatalf("prime: %v", err)
+	}
+	for _, anyJob := range []bool{false, true} {
+		if job, ok := w.waitResult(anyJob); ok {
+			t.Fatalf("expected wait (any=%v) to wait for the pending array, got %+v", anyJob, job)
+		}
+	}
+
+	if _, err := w.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	job, ok := w.waitResult(false)
+	if !ok || job.JobID != "123_2" || slurmExitStatus(job) != 2 {
+		t.Fatalf("expected wait to exit with the failed task, got %+v", job)
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	exitWatchFailed = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// watcher runs the dashboard's polling loop without the TUI: it fetches the
+// live queue, resolves jobs that left it through sacct and reports the
+// resulting transitions. It is shared by the watch and wait subcommands.
+type watcher struct {
+	ids     []string // requested job IDs; empty means every job of the user
+	tracker *jobTracker
+
+	// Running jobs whose logs were quiet for stallAfter are reported as
+	// STALLED, as in the TUI.
+	stallAfter time.Duration
+	stalls     *stallTracker
+	logPaths   *logPathCache
+
+	fetchLive func() ([]Job, error)
+	fetchByID func([]string) ([]Job, error)
+}
+
+func newWatcher(ids []string) *watcher {
+	return &watcher{
+		ids:        ids,
+		tracker:    newJobTracker(),
+		stallAfter: stallAfterFromEnv(),
+		stalls:     newStallTracker(),
+		logPaths:   newLogPathCache(),
+		fetchLive:  FetchJobsSqueue,
+		fetchByID:  FetchJobsByID,
+	}
+}
+
+// jobMatchesID reports whether a job is (a task of) the requested job ID, so
+// watching an array's parent ID covers all of its tasks.
+func jobMatchesID(jobID, id string) bool {
+	return jobID == id || strings.HasPrefix(jobID, id+"_")
+}
+
+func (w *watcher) wanted(job Job) bool {
+	if len(w.ids) == 0 {
+		return true
+	}
+	for _, id := range w.ids {
+		if jobMatchesID(job.JobID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *watcher) filter(jobs []Job) []Job {
+	var out []Job
+	for _, job := range jobs {
+		if w.wanted(job) {
+			out = append(out, job)
+		}
+	}
+	return out
+}
+
+// prime records the initial state. Requested jobs that are not in the live
+// queue (already finished) are looked up in sacct; IDs unknown to both are
+// returned as an error.
+func (w *watcher) prime() ([]Job, error) {
+	live, err := w.fetchLive()
+	if err != nil {
+		return nil, err
+	}
+	jobs := w.filter(live)
+
+	var absent []string
+	for _, id := range w.ids {
+		found := false
+		for _, job := range jobs {
+			if jobMatchesID(job.JobID, id) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			absent = append(absent, id)
+		}
+	}
+	if len(absent) > 0 {
+		final, err := w.fetchByID(absent)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, w.filter(final)...)
+		var unknown []string
+		for _, id := range absent {
+			if len(matchingJobs(jobs, id)) == 0 {
+				unknown = append(unknown, id)
+			}
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("unknown job(s): %s", strings.Join(unknown, ", "))
+		}
+	}
+
+	w.tracker.Observe(jobs)
+	return jobs, nil
+}
+
+// poll fetches the queue once and returns the transitions since the last
+// poll, including final states of jobs that left the queue.
+func (w *watcher) poll() ([]JobEvent, error) {
+	live, err := w.fetchLive()
+	if err != nil {
+		return nil, err
+	}
+	jobs := w.filter(live)
+	events := w.tracker.Observe(jobs)
+
+	if missing := w.tracker.Missing(jobs); len(missing) > 0 {
+		final, err := w.fetchByID(sacctIDs(missing))
+		if err != nil {
+			return events, err
+		}
+		events = append(events, w.tracker.Resolve(missing, final)...)
+	}
+	return events, nil
+}
+
+// stalled returns the events of the watched running jobs whose logs went
+// quiet since the last call.
+func (w *watcher) stalled(now time.Time) []JobEvent {
+	if w.stallAfter <= 0 {
+		return nil
+	}
+	jobs := w.watched()
+	running := map[string]bool{}
+	lastOutput := map[string]time.Time{}
+	for _, job := range jobs {
+		if job.State() != "R" {
+			continue
+		}
+		running[job.JobID] = true
+		if last := lastWritten(w.logPaths.lookup(job.JobID, nil)); !last.IsZero() {
+			lastOutput[job.JobID] = last
+		}
+	}
+	w.logPaths.retain(running)
+	return w.stalls.observe(jobs, lastOutput, w.stallAfter, now)
+}
+
+func matchingJobs(jobs []Job, id string) []Job {
+	var out []Job
+	for _, job := range jobs {
+		if jobMatchesID(job.JobID, id) {
+			out = append(out, job)
+		}
+	}
+	return out
+}
+
+// watched returns the tracked jobs the watcher is responsible for. A pending
+// array range stands for its tasks until they start.
+func (w *watcher) watched() []Job {
+	var jobs []Job
+	for _, job := range w.tracker.jobs {
+		if w.wanted(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	return jobs
+}
+
+// done reports whether every watched job reached a terminal state. With
+// explicit IDs, an ID whose jobs were all forgotten (purged from sacct) also
+// counts as done.
+func (w *watcher) done() bool {
+	for _, job := range w.watched() {
+		if !job.IsHistorical() {
+			return false
+		}
+	}
+	return true
+}
+
+// failed returns the watched jobs that ended in a state other than COMPLETED,
+// plus requested IDs that can no longer be found.
+func (w *watcher) failed() []string {
+	var failed []string
+	jobs := w.watched()
+	for _, job := range jobs {
+		if job.IsHistorical() && job.State() != "CD" {
+			failed = append(failed, job.JobID)
+		}
+	}
+	for _, id := range w.ids {
+		if len(matchingJobs(jobs, id)) == 0 {
+			failed = append(failed, id)
+		}
+	}
+	return failed
+}
+
+// watchLogEntry is one line of the watch JSON lines log.
+type watchLogEntry struct {
+	Time   string   `json:"time"`
+	Event  string   `json:"event"`
+	Job    *hookJob `json:"job,omitempty"`
+	Jobs   []string `json:"jobs,omitempty"`
+	Failed []string `json:"failed,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// watchLogger writes watchLogEntry lines. Hook failures are logged from the
+// dispatcher's goroutines, hence the mutex.
+type watchLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (l *watchLogger) log(entry watchLogEntry) {
+	if l == nil || l.enc == nil {
+		return
+	}
+	entry.Time = time.Now().Format(time.RFC3339)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(entry)
+}
+
+func (l *watchLogger) event(ev JobEvent) {
+	job := newHookJob(ev)
+	event := hookEventStateChanged
+	if ev.State == stateStalled {
+		event = hookEventStalled
+	}
+	l.log(watchLogEntry{Event: event, Job: &job})
+}
+
+func (l *watchLogger) err(err error) {
+	l.log(watchLogEntry{Event: "error", Error: err.Error()})
+}
+
+// openWatchLog opens the JSON lines log for appending. "-" means stdout.
+func openWatchLog(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func defaultWatchLogPath() string {
+	dir := dashboardDir()
+	if dir == "" {
+		return "watch.jsonl"
+	}
+	return filepath.Join(dir, "watch.jsonl")
+}
+
+func watchUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: slurm-dashboard watch [flags] [JOBID...]\n\n")
+		fmt.Fprintf(fs.Output(), "Polls the queue without the TUI, logs state changes as JSON lines, fires\n")
+		fmt.Fprintf(fs.Output(), "configured hooks and archives the logs of finished jobs. Exits once the given\n")
+		fmt.Fprintf(fs.Output(), "jobs (default: all of your jobs) reach a terminal state; the exit code is 1 if\n")
+		fmt.Fprintf(fs.Output(), "any of them did not complete.\n\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runWatch implements `slurm-dashboard watch`.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	logPath := fs.String("log", defaultWatchLogPath(), "JSON lines event log (\"-\" for stdout)")
+	interval := fs.Duration("interval", refreshInterval, "polling interval")
+	forever := fs.Bool("forever", false, "keep watching new jobs instead of exiting when all are done")
+	quiet := fs.Bool("quiet", false, "do not print state changes to stderr")
+	fs.Usage = watchUsage(fs)
+	ids, err := parseInterleaved(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "watch: --interval must be positive")
+		return exitUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		return exitUsage
+	}
+
+	out, err := openWatchLog(expandHomePath(*logPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch: opening log: %v\n", err)
+		return exitUsage
+	}
+	defer out.Close()
+	logger := &watchLogger{enc: json.NewEncoder(out)}
+
+	reportErr := func(err error) {
+		logger.err(err)
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		}
+	}
+	hooks := NewHookDispatcher(cfg.Hooks, reportErr)
+	defer hooks.Close()
+	archiver := NewLogArchiver(cfg.Archive, reportErr)
+	defer archiver.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := newWatcher(ids)
+	if _, err := w.prime(); err != nil {
+		fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		return exitUsage
+	}
+	logger.log(watchLogEntry{Event: "watch_started", Jobs: jobIDs(w.watched())})
+
+	report := func(events []JobEvent) {
+		for _, ev := range events {
+			logger.event(ev)
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "%s %s\n", ev.Time.Format("15:04:05"), ev)
+			}
+		}
+		hooks.Fire(events)
+		archiver.Archive(events)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for *forever || !w.done() {
+		select {
+		case <-ctx.Done():
+			logger.log(watchLogEntry{Event: "watch_interrupted"})
+			return exitInterrupted
+		case <-ticker.C:
+		}
+		events, err := w.poll()
+		report(append(events, w.stalled(time.Now())...))
+		if err != nil {
+			logger.err(err)
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+			}
+		}
+	}
+
+	failed := w.failed()
+	logger.log(watchLogEntry{Event: "watch_finished", Failed: failed})
+	if len(failed) > 0 {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "watch: not completed: %s\n", strings.Join(failed, ", "))
+		}
+		return exitWatchFailed
+	}
+	return 0
+}
+
+func jobIDs(jobs []Job) []string {
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.JobID)
+	}
+	return ids
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeQueue replays squeue snapshots and answers sacct lookups from a fixed
+// table of final states.
+type fakeQueue struct {
+	snapshots [][]Job
+	final     map[string]Job
+	polls     int
+}
+
+func (q *fakeQueue) live() ([]Job, error) {
+	snap := q.snapshots[q.polls]
+	if q.polls < len(q.snapshots)-1 {
+		q.polls++
+	}
+	return snap, nil
+}
+
+func (q *fakeQueue) byID(ids []string) ([]Job, error) {
+	var jobs []Job
+	for _, id := range ids {
+		for jobID, job := range q.final {
+			if jobMatchesID(jobID, id) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+func newFakeWatcher(ids []string, q *fakeQueue) *watcher {
+	w := newWatcher(ids)
+	w.fetchLive = q.live
+	w.fetchByID = q.byID
+	return w
+}
+
+func TestWatcherExitsWhenRequestedJobsFinish(t *testing.T) {
+	q := &fakeQueue{
+		snapshots: [][]Job{
+			{{JobID: "1", Status: "R"}, {JobID: "2", Status: "PD"}, {JobID: "3", Status: "R"}},
+			{{JobID: "2", Status: "R"}, {JobID: "3", Status: "R"}},
+			{{JobID: "3", Status: "R"}},
+		},
+		final: map[string]Job{
+			"1": {JobID: "1", Status: "COMPLETED", ExitCode: "0:0"},
+			"2": {JobID: "2", Status: "FAILED", ExitCode: "1:0"},
+		},
+	}
+	w := newFakeWatcher([]string{"1", "2"}, q)
+	if _, err := w.prime(); err != nil {
+		t.Fatalf("prime: %v", err)
+	}
+
+	events, err := w.poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected PD→R and R→CD events, got %v", events)
+	}
+	if w.done() {
+		t.Fatalf("job 2 is still running; watcher should not be done")
+	}
+
+	if _, err := w.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if !w.done() {
+		t.Fatalf("expected watcher to be done once jobs 1 and 2 finished (job 3 is not watched)")
+	}
+	if got := w.failed(); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Fatalf("expected job 2 to be reported as failed, got %v", got)
+	}
+}
+
+func TestWatcherPrimeResolvesFinishedAndUnknownJobs(t *testing.T) {
+	q := &fakeQueue{
+		snapshots: [][]Job{{}},
+		final:     map[string]Job{"5_1": {JobID: "5_1", Status: "COMPLETED"}, "5_2": {JobID: "5_2", Status: "COMPLETED"}},
+	}
+	w := newFakeWatcher([]string{"5"}, q)
+	if _, err := w.prime(); err != nil {
+		t.Fatalf("prime: %v", err)
+	}
+	if !w.done() || len(w.failed()) != 0 {
+		t.Fatalf("expected finished array to be done without failures, failed=%v", w.failed())
+	}
+
+	w = newFakeWatcher([]string{"404"}, q)
+	if _, err := w.prime(); err == nil {
+		t.Fatalf("expected an error for a job unknown to squeue and sacct")
+	}
+}
+
+func TestWatcherWaitsForPendingArrayRange(t *testing.T) {
+	q := &fakeQueue{
+		snapshots: [][]Job{
+			{{JobID: "123_[1-100]", Status: "PD"}},
+			{{JobID: "123_1", Status: "R"}, {JobID: "123_[2-100]", Status: "PD"}},
+			{},
+		},
+		final: map[string]Job{"123_1": {JobID: "123_1", Status: "COMPLETED"}},
+	}
+	w := newFakeWatcher([]string{"123"}, q)
+	if _, err := w.prime(); err != nil {
+		t.Fatalf("prime: %v", err)
+	}
+	if got := jobIDs(w.watched()); !reflect.DeepEqual(got, []string{"123_[1-100]"}) || w.done() || len(w.failed()) != 0 {
+		t.Fatalf("expected the pending range to be watched, got %v", got)
+	}
+
+	if _, err := w.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if got := jobIDs(w.watched()); !reflect.DeepEqual(got, []string{"123_1", "123_[2-100]"}) || w.done() {
+		t.Fatalf("expected the first task and the rest of the range, got %v", got)
+	}
+
+	// The other tasks were cancelled before they started.
+	q.final["123_[2-100]"] = Job{JobID: "123_[2-100]", Status: "CANCELLED"}
+	events, err := w.poll()
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(events) != 2 || !w.done() || !reflect.DeepEqual(w.failed(), []string{"123_[2-100]"}) {
+		t.Fatalf("expected the range to end cancelled, events %v, failed %v", events, w.failed())
+	}
+}
+
+func TestWatcherReportsStalledJobs(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "9.out")
+	if err := os.WriteFile(log, []byte("epoch 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	os.Chtimes(log, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+
+	q := &fakeQueue{snapshots: [][]Job{{{JobID: "9", Name: "train", Status: "R"}}}}
+	w := newFakeWatcher(nil, q)
+	w.stallAfter = time.Hour
+	w.logPaths.resolve = func(string) (string, string, error) { return log, "", nil }
+	if _, err := w.prime(); err != nil {
+		t.Fatalf("prime: %v", err)
+	}
+	events := w.stalled(now)
+	if len(events) != 1 || events[0].State != stateStalled || events[0].Job.JobID != "9" {
+		t.Fatalf("expected job 9 to be reported stalled, got %v", events)
+	}
+	if events := w.stalled(now.Add(time.Minute)); len(events) != 0 {
+		t.Fatalf("expected a stalled job to be reported once, got %v", events)
+	}
+}